@@ -6,6 +6,11 @@ import { Message, MessageType } from "moqjs/src/messages";
 import { varint } from "moqjs/src/varint";
 
 import { MetaWorkerMessage } from "./interface/WorkerMessage";
+import { ChannelStatus } from "./interface/ChannelStatus";
+import { Track } from "./interface/TracksJSON";
+
+import { parseLocObject } from "./utils/LocObject";
+import { ladder } from "./utils/Ladder";
 
 import MetaObjectPayloadWorker from "./worker/MetaObjectPayloadWorker?worker";
 import VideoDecoderWorker from "./worker/VideoDecoderWorker?worker";
@@ -19,8 +24,11 @@ let sessionInternal: Session | null = null;
 let selectedChannel = "";
 let selectedTrackInternal = "";
 let videoTracks: string[] = [];
+let trackPackagings: Record<string, string> = {}; // packaging of each track from the catalog, "chunk" or "loc"
+let trackKinds: Record<string, string> = {}; // media kind of each track from the catalog, "video" or "audio"
+let catalogTracks: Track[] = []; // the catalog's tracks, renditions are switched along their ladder
 
-let mediaType = new Map<string, number>(); // tracks the media type (video, audio etc.) for each subscription, possible keys: "hd", "md", "audio"
+let mediaType = new Map<string, number>(); // tracks the media type (video, audio etc.) for each subscription, keys: "audio" & the watched video track
 
 let audioTimestampRef = 0; // reference timestamp for audio chunks (first audio chunk timestamp)
 let videoTimestampRef = 0; // reference timestamp for video frames (first video frame timestamp)
@@ -30,7 +38,7 @@ function App() {
 
   const [session, setSession] = useState<Session | null>(null); // UI: session
 
-  const [channelListObj, setChannelList] = useState<string[]>([]); // UI: channel list
+  const [channelListObj, setChannelList] = useState<ChannelStatus[]>([]); // UI: channel list
   const [trackListObj, setTrackList] = useState<string[]>([]); // UI: resolution(track) list
   const [selectedTrack, setSelectedTrack] = useState<string>(""); // UI: selected resolution(track)
 
@@ -47,7 +55,11 @@ function App() {
 
   async function connect() {
     try {
-      const url = "https://10.0.2.1:443/webtransport/audience";
+      let url = "https://10.0.2.1:443/webtransport/audience";
+      const token = new URLSearchParams(window.location.search).get("token"); // viewer token of private channels, e.g. from a shared link
+      if (token) {
+        url += `?token=${encodeURIComponent(token)}`;
+      }
       const s = await Session.connect(url); // create new Session and handle handshake internally for control stream
       controlMessageListener(s);
       sessionInternal = s;
@@ -84,6 +96,7 @@ function App() {
         sessionInternal = null;
         selectedChannel = "";
         videoTracks = [];
+        catalogTracks = [];
         audioContextRef.current?.close();
         canvas = null;
         context = null;
@@ -106,7 +119,7 @@ function App() {
             const { action, channelList }: MetaWorkerMessage = e.data;
             if (action == "channelList" && channelList) {
               setChannelList(channelList);
-              console.log(`🔻 🅾️channelList🅾️: ${channelList}`);
+              console.log(`🔻 🅾️channelList🅾️: ${channelList.map((channel) => channel.name)}`);
             }
           };
           channelListWorker.postMessage({ action: "channels", readableStream }, [readableStream]);
@@ -116,18 +129,32 @@ function App() {
           const tracksWorker = new MetaObjectPayloadWorker();
           console.log(`🔔 Meta Worker (tracks) created for subscription (${subId})`);
           tracksWorker.onmessage = async (e: { data: MetaWorkerMessage }) => {
-            const { action, trackNames }: MetaWorkerMessage = e.data;
+            const { action, trackNames, trackPackagings: packagings, trackKinds: kinds, tracks }: MetaWorkerMessage =
+              e.data;
             if (action == "trackNames" && trackNames) {
+              trackPackagings = packagings ?? {};
+              trackKinds = kinds ?? {};
+              catalogTracks = tracks ?? [];
+              const catalogUpdate = videoTracks.length > 0; // every catalog update is a new group on the catalogTrack
               videoTracks = trackNames;
               setTrackList(trackNames);
               console.log(`🔻 🅾️tracks🅾️: ${trackNames}`);
+              if (catalogUpdate) {
+                // already subscribed, the server ends the subscription of a removed track with SUBSCRIBE_DONE
+                if (!trackNames.includes(selectedTrackInternal) && trackNames.length > 0) {
+                  console.log(`🔔 Track ${selectedTrackInternal} removed from catalog, switching to ${trackNames[0]}`);
+                  setSelectedTrack(trackNames[0]);
+                  selectedTrackInternal = trackNames[0];
+                }
+                return;
+              }
 
               // subscribe to selected channel's default media tracks
               console.log("🔔 Sub to selectedChannel's media tracks(defaults): ", selectedChannel);
               await sessionInternal?.subscribe(selectedChannel, "audio");
-              console.log(" tracks[0]:", videoTracks[0]); // default video track "hd"
+              console.log(" tracks[0]:", videoTracks[0]); // videoTracks: ["hd", "md"]
 
-              const defaultVideoTrack = videoTracks[0]; // videoTracks: ["hd", "md", "hd-ra", "md-ra"]
+              const defaultVideoTrack = ladder(catalogTracks, videoTracks[0])[0] ?? videoTracks[0]; // best rendition, "hd"
               await sessionInternal?.subscribe(selectedChannel, defaultVideoTrack);
               setSelectedTrack(defaultVideoTrack);
               selectedTrackInternal = defaultVideoTrack;
@@ -138,70 +165,25 @@ function App() {
 
         default: //! S0: get media stream objs
           // register sub type in mediaType
-          // there will always be exactly 2 items in this mediaType map: first one is "audio", second one is video("hd"(default) or "md")
+          // there will always be exactly 2 items in this mediaType map: first one is "audio", second one is the watched video track
           if (!mediaType.has("audio")) {
             mediaType.set("audio", Number(subId));
             console.log(`🔔 Added to mediaType map: (audio,${Number(subId)})`);
           } else {
-            if (!mediaType.has("hd") && !mediaType.has("md") && !mediaType.has("hd-ra") && !mediaType.has("md-ra")) {
-              // add default video track (hd) to mediaType map
-              mediaType.set("hd", Number(subId));
-              console.log(`🔔 Added to mediaType map: (${"hd"},${Number(subId)})`);
-            } else if (mediaType.has("hd")) {
-              // change from hd to md
-              console.log(`🔔 Deleting mediaType map: (hd, ${mediaType.get("hd")}`);
-              mediaType.delete("hd");
-              if (selectedTrackInternal === "hd-ra") {
-                mediaType.set(selectedTrackInternal, Number(subId));
-                console.log(`🔔 Updated mediaType map: (hd-ra,${Number(subId)})`);
-              } else if (selectedTrackInternal === "md") {
-                mediaType.set("md", Number(subId));
-                console.log(`🔔 Updated mediaType map: (md,${Number(subId)})`);
-              } else {
-                console.log(`❌ Invalid track change from hd to ${selectedTrackInternal})`);
-              }
-            } else if (mediaType.has("md")) {
-              // change from md to hd
-              console.log(`🔔 Deleting mediaType map: (md, ${mediaType.get("md")}`);
-              mediaType.delete("md");
-              if (selectedTrackInternal === "md-ra") {
-                mediaType.set(selectedTrackInternal, Number(subId));
-                console.log(`🔔 Updated mediaType map: (md-ra,${Number(subId)})`);
-              } else if (selectedTrackInternal === "hd") {
-                mediaType.set("hd", Number(subId));
-                console.log(`🔔 Updated mediaType map: (hd,${Number(subId)})`);
-              } else {
-                console.log(`❌ Invalid track change from md to ${selectedTrackInternal}`);
-              }
-            } else if (mediaType.has("hd-ra")) {
-              // change from hd-ra to hd
-              console.log(`🔔 Deleting mediaType map: (hd-ra, ${mediaType.get("hd-ra")}`);
-              mediaType.delete("hd-ra");
-              if (selectedTrackInternal === "hd") {
-                mediaType.set("hd", Number(subId));
-                console.log(`🔔 Updated mediaType map: (hd,${Number(subId)})`);
-              } else if (selectedTrackInternal === "md") {
-                mediaType.set("md", Number(subId));
-                console.log(`🔔 Updated mediaType map: (md,${Number(subId)})`);
-              } else {
-                console.log(`❌ Invalid track change from hd-ra to ${selectedTrackInternal}`);
-              }
-            } else if (mediaType.has("md-ra")) {
-              // change from md-ra to md
-              console.log(`🔔 Deleting mediaType map: (md-ra, ${mediaType.get("md-ra")}`);
-              mediaType.delete("md-ra");
-              if (selectedTrackInternal === "md") {
-                mediaType.set("md", Number(subId));
-                console.log(`🔔 Updated mediaType map: (md,${Number(subId)})`);
-              } else if (selectedTrackInternal === "hd") {
-                mediaType.set("hd", Number(subId));
-                console.log(`🔔 Updated mediaType map: (hd,${Number(subId)})`);
-              } else {
-                console.log(`❌ Invalid track change from md-ra to ${selectedTrackInternal}`);
+            // the selected video track, the default one, a rendition switched to or the track replacing a removed one
+            for (const [name, id] of mediaType) {
+              if (name !== "audio" && name !== selectedTrackInternal) {
+                console.log(`🔔 Deleting mediaType map: (${name}, ${id})`);
+                mediaType.delete(name);
               }
             }
+            mediaType.set(selectedTrackInternal, Number(subId));
+            console.log(`🔔 Updated mediaType map: (${selectedTrackInternal},${Number(subId)})`);
           }
 
+          const trackName = [...mediaType.entries()].find(([, id]) => id === Number(subId))?.[0] ?? "";
+          const packaging = trackPackagings[trackName] ?? "chunk";
+          const kind = trackKinds[trackName];
           const reader = readableStream.getReader();
           while (true) {
             const { done, value } = await reader.read();
@@ -211,7 +193,15 @@ function App() {
             if (value) {
               // console.log(`🔔 Received chunk: ${value.length} bytes`);
               try {
-                deserializeEncodedChunk(value); // Process the chunk asynchronously to avoid blocking the stream
+                // Process the chunk asynchronously to avoid blocking the stream
+                if (packaging === "loc") {
+                  if (kind !== "audio" && kind !== "video") {
+                    throw new Error(`no media kind for LOC track ${trackName} in the catalog`);
+                  }
+                  deserializeLocObject(value, kind);
+                } else {
+                  deserializeEncodedChunk(value);
+                }
               } catch (err) {
                 console.log("❌ Error in deserializing chunks (extracting video frames/audio chunks):", err);
               }
@@ -267,49 +257,24 @@ function App() {
 
         case MessageType.SubscribeDone:
           console.log("🔻 🏁 SUBSCRIBE_DONE:", m);
-          // changing video track resolution
-          if (mediaType.get("hd")) {
-            if (selectedTrackInternal === "hd-ra") {
-              session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 RA-down, subscribed to track: ${selectedTrackInternal} on channel ${selectedChannel}`);
-            } else if (selectedTrackInternal === "md") {
-              session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 Subscribed to track: ${selectedTrackInternal} on channel ${selectedChannel}`);
-            } else {
-              console.log(`❌ Invalid track change from hd to ${selectedTrackInternal}`);
-            }
-          }
-          if (mediaType.get("md")) {
-            if (selectedTrackInternal === "md-ra") {
-              session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 RA-down, subscribed to track: ${selectedTrackInternal} on channel ${selectedChannel}`);
-            } else if (selectedTrackInternal === "hd") {
-              session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 Subscribed to track: ${selectedTrackInternal} on channel ${selectedChannel}`);
-            } else {
-              console.log(`❌ Invalid track change from md to ${selectedTrackInternal}`);
-            }
+          // track removed from the catalog, resubscribe to the track selected instead
+          const endedTrack = [...mediaType.entries()].find(([, id]) => id === Number(m.subscribeId))?.[0];
+          if (endedTrack && endedTrack !== "audio" && !videoTracks.includes(endedTrack)) {
+            mediaType.delete(endedTrack);
+            session.subscribe(selectedChannel, selectedTrackInternal);
+            console.log(`🆕 Track ${endedTrack} removed, subscribed to track: ${selectedTrackInternal}`);
+            break;
           }
-          if (mediaType.get("hd-ra")) {
-            if (selectedTrackInternal === "hd") {
+          // changing video track resolution, the track change or rate adaptation selected the track to switch to before
+          // unsubscribing the watched one
+          if (endedTrack && endedTrack !== "audio") {
+            if (endedTrack !== selectedTrackInternal) {
               session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 RA-up, subscribed to track: ${selectedTrackInternal} on channel ${selectedChannel}`);
-            } else if (selectedTrackInternal === "md") {
-              session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 Cross-subscribed from hd-ra to ${selectedTrackInternal} on channel ${selectedChannel}`);
-            } else {
-              console.log(`❌ Invalid track change from hd-ra to ${selectedTrackInternal}`);
-            }
-          }
-          if (mediaType.get("md-ra")) {
-            if (selectedTrackInternal === "md") {
-              session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 RA-up, subscribed to track: ${selectedTrackInternal} on channel ${selectedChannel}`);
-            } else if (selectedTrackInternal === "hd") {
-              session.subscribe(selectedChannel, selectedTrackInternal);
-              console.log(`🆕 Cross-subscribed from md-ra to ${selectedTrackInternal} on channel ${selectedChannel}`);
+              console.log(
+                `🆕 Switched from track ${endedTrack}, subscribed to track: ${selectedTrackInternal} on channel ${selectedChannel}`,
+              );
             } else {
-              console.log(`❌ Invalid track change from md-ra to ${selectedTrackInternal}`);
+              console.log(`❌ Subscription of the watched track ${endedTrack} ended`);
             }
           }
           break;
@@ -431,55 +396,12 @@ function App() {
       switch (type) {
         case "video":
           const videoData = view.buffer.slice(14, chunkSize + 4);
-          const evc = new EncodedVideoChunk({
-            type: key,
-            timestamp: timestamp,
-            data: videoData,
-          });
-          latencyLogging && console.log(`🧪 🎬 obj latency ${timestamp} #3: ${Date.now()}`);
-          if (videoTimestampRef === 0 || timestamp < videoTimestampRef) {
-            videoTimestampRef = timestamp;
-            // console.log(`🔔 Reference timestamp for video frames: ${videoTimestampRef} @ ${Date.now()}`);
-            try {
-              videoDecoderWorker.postMessage({ action: "videoTimestampRef", timestamp });
-            } catch (err) {
-              throw new Error(`❌ Error in posting videoTimestampRef to worker: ${err}`);
-            }
-          }
-          // console.log(`🎥 Got video frame: ${evc.type}, timestamp: ${timestamp}, ${videoData.byteLength} bytes`);
-          try {
-            videoDecoderWorker.postMessage({ action: "insertFrame", frame: evc });
-          } catch (err) {
-            throw new Error(`❌ Error in posting video frame to worker: ${err}`);
-          }
+          processVideoChunk(key, timestamp, videoData);
           break;
         case "audio":
           const duration = view.getFloat64(14, true); // exist only for audio chunks
           const audioData = view.buffer.slice(22, chunkSize + 4);
-          const eac = new EncodedAudioChunk({
-            type: key, // always "key" for audio
-            timestamp: timestamp,
-            duration: duration,
-            data: audioData,
-          });
-          latencyLogging && console.log(`🧪 🔊 obj latency ${timestamp} #3: ${Date.now()}`);
-          if (audioTimestampRef === 0 || timestamp < audioTimestampRef) {
-            audioTimestampRef = timestamp;
-            // console.log(`🔔 Reference timestamp for audio chunks: ${audioTimestampRef} @ ${Date.now()}`);
-            try {
-              videoDecoderWorker.postMessage({ action: "audioTimestampRef", timestamp });
-            } catch (err) {
-              throw new Error(`❌ Error in posting audioTimestampRef to worker: ${err}`);
-            }
-          }
-          // console.log(
-          //   `🔊 Got audio chunk: ${eac.type}, timestamp(ms): ${Math.floor(timestamp! / 1000)},duration: ${duration}, ${audioData.byteLength} bytes`,
-          // );
-          try {
-            audioDecoderWorker.postMessage({ action: "insertAudio", audio: eac });
-          } catch (err) {
-            throw new Error(`❌ Error in posting audio chunk to worker: ${err}`);
-          }
+          processAudioChunk(key, timestamp, audioData, duration);
           break;
         default:
           console.log(`❌ Unknown chunk type`);
@@ -490,6 +412,71 @@ function App() {
     }
   }
 
+  // LOC objects carry the codec bitstream with header extensions, the capture timestamp is used as chunk timestamp
+  async function deserializeLocObject(buffer: Uint8Array, type: "video" | "audio") {
+    try {
+      const loc = parseLocObject(buffer);
+      if (type === "video") {
+        processVideoChunk(loc.independent ? "key" : "delta", loc.captureTimestamp, loc.data);
+      } else {
+        processAudioChunk("key", loc.captureTimestamp, loc.data);
+      }
+    } catch (err) {
+      throw new Error(`❌ Error in deserializing LOC object: ${err}`);
+    }
+  }
+
+  function processVideoChunk(key: "key" | "delta", timestamp: number, videoData: BufferSource) {
+    const evc = new EncodedVideoChunk({
+      type: key,
+      timestamp: timestamp,
+      data: videoData,
+    });
+    latencyLogging && console.log(`🧪 🎬 obj latency ${timestamp} #3: ${Date.now()}`);
+    if (videoTimestampRef === 0 || timestamp < videoTimestampRef) {
+      videoTimestampRef = timestamp;
+      // console.log(`🔔 Reference timestamp for video frames: ${videoTimestampRef} @ ${Date.now()}`);
+      try {
+        videoDecoderWorker.postMessage({ action: "videoTimestampRef", timestamp });
+      } catch (err) {
+        throw new Error(`❌ Error in posting videoTimestampRef to worker: ${err}`);
+      }
+    }
+    // console.log(`🎥 Got video frame: ${evc.type}, timestamp: ${timestamp}, ${videoData.byteLength} bytes`);
+    try {
+      videoDecoderWorker.postMessage({ action: "insertFrame", frame: evc });
+    } catch (err) {
+      throw new Error(`❌ Error in posting video frame to worker: ${err}`);
+    }
+  }
+
+  function processAudioChunk(key: "key" | "delta", timestamp: number, audioData: BufferSource, duration?: number) {
+    const eac = new EncodedAudioChunk({
+      type: key, // always "key" for audio
+      timestamp: timestamp,
+      duration: duration,
+      data: audioData,
+    });
+    latencyLogging && console.log(`🧪 🔊 obj latency ${timestamp} #3: ${Date.now()}`);
+    if (audioTimestampRef === 0 || timestamp < audioTimestampRef) {
+      audioTimestampRef = timestamp;
+      // console.log(`🔔 Reference timestamp for audio chunks: ${audioTimestampRef} @ ${Date.now()}`);
+      try {
+        videoDecoderWorker.postMessage({ action: "audioTimestampRef", timestamp });
+      } catch (err) {
+        throw new Error(`❌ Error in posting audioTimestampRef to worker: ${err}`);
+      }
+    }
+    // console.log(
+    //   `🔊 Got audio chunk: ${eac.type}, timestamp(ms): ${Math.floor(timestamp! / 1000)},duration: ${duration}, ${audioData.byteLength} bytes`,
+    // );
+    try {
+      audioDecoderWorker.postMessage({ action: "insertAudio", audio: eac });
+    } catch (err) {
+      throw new Error(`❌ Error in posting audio chunk to worker: ${err}`);
+    }
+  }
+
   const handleChannelChange = (channel: string) => {
     selectedChannel = channel;
     session!.subscribe(channel, "catalogTrack");
@@ -508,36 +495,29 @@ function App() {
     }
   };
 
+  // switch to the adjacent rendition of the watched track's ladder, "up" or "down"
   function rateAdapt(direction: string) {
     console.log(`🔔 Rate adaptation triggered: ${direction}`);
     console.log(`🔔 Selected track: ${selectedTrackInternal}`);
     let previousTrackId = mediaType.get(selectedTrackInternal);
     console.log(`🔔 MediaType: (${selectedTrackInternal},${previousTrackId})`);
     if (previousTrackId) {
-      let adaptDownTrack = selectedTrackInternal === "hd" ? "hd-ra" : "md-ra";
-      let adaptUpTrack = selectedTrackInternal === "hd-ra" ? "hd" : "md";
-
-      if (direction === "down" && selectedTrackInternal !== "hd-ra" && selectedTrackInternal !== "md-ra") {
-        sessionInternal!.unsubscribe(previousTrackId);
-        console.log(`🔔 Unsubscribed from current track: ${selectedTrackInternal}`);
-        setSelectedTrack(adaptDownTrack); // state update for UI rendering
-        selectedTrackInternal = adaptDownTrack;
-        console.log(`🔔 Adapted down to track: ${adaptDownTrack}`);
+      const renditions = ladder(catalogTracks, selectedTrackInternal); // best first
+      const index = renditions.indexOf(selectedTrackInternal);
+      const target = direction === "down" ? index + 1 : index - 1;
+      if (index < 0 || target < 0 || target >= renditions.length) {
+        console.log(
+          `🔔 Already on the ${direction === "down" ? "lowest" : "highest"} rendition ${selectedTrackInternal}, cannot adapt ${direction}`,
+        );
         return;
-      } else {
-        console.log(`🔔 Already at ra track ${selectedTrackInternal}, cannot adapt down`);
       }
 
-      if (direction === "up" && selectedTrackInternal !== "hd" && selectedTrackInternal !== "md") {
-        sessionInternal!.unsubscribe(previousTrackId);
-        console.log(`🔔 Unsubscribed from current track: ${selectedTrackInternal}`);
-        setSelectedTrack(adaptUpTrack); // state update for UI rendering
-        selectedTrackInternal = adaptUpTrack;
-        console.log(`🔔 Adapted up to track: ${adaptUpTrack}`);
-        return;
-      } else {
-        console.log(`🔔 Already at normal track ${selectedTrackInternal}, cannot adapt up`);
-      }
+      const adaptedTrack = renditions[target];
+      sessionInternal!.unsubscribe(previousTrackId);
+      console.log(`🔔 Unsubscribed from current track: ${selectedTrackInternal}`);
+      setSelectedTrack(adaptedTrack); // state update for UI rendering
+      selectedTrackInternal = adaptedTrack;
+      console.log(`🔔 Adapted ${direction} to track: ${adaptedTrack}`);
     } else {
       console.log(`❌ Track ${selectedTrackInternal} is not registered in mediaType map, invalid subscription id`);
     }
@@ -610,12 +590,22 @@ function App() {
               <div className="m-2 flex flex-col gap-2 flex-grow">
                 {channelListObj.map((channel) => (
                   <button
-                    key={channel}
-                    id={channel}
-                    onClick={() => handleChannelChange(channel)}
-                    className={`cursor-pointer p-2 ${selectedChannel === channel ? "bg-red-500 text-white" : "bg-green-300 text-black"}`}
+                    key={channel.name}
+                    id={channel.name}
+                    disabled={!channel.status}
+                    onClick={() => handleChannelChange(channel.name)}
+                    title={channel.description}
+                    className={`cursor-pointer p-2 ${selectedChannel === channel.name ? "bg-red-500 text-white" : "bg-green-300 text-black"} ${channel.status ? "" : "opacity-50"}`}
                   >
-                    {channel}
+                    <div className="font-bold">{channel.title || channel.name}</div>
+                    <div className="text-xs">
+                      {channel.status ? `🔴 ${channel.viewers} watching` : "offline"}
+                      {channel.renditions.length > 0 &&
+                        ` · ${channel.renditions.filter((rendition) => rendition.width).length} video tracks`}
+                    </div>
+                    {channel.tags && channel.tags.length > 0 && (
+                      <div className="text-xs italic">{channel.tags.map((tag) => `#${tag}`).join(" ")}</div>
+                    )}
                   </button>
                 ))}
               </div>
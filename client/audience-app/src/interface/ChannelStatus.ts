@@ -0,0 +1,25 @@
+// channel directory JSON obj parser, one entry per announced channel
+export interface ChannelStatus {
+  name: string;
+  status: boolean; // true while the streamer is connected
+  title?: string;
+  description?: string;
+  tags?: string[];
+  startTime: string; // RFC 3339
+  viewers: number;
+  trackViewers: Record<string, number>;
+  renditions: Rendition[];
+}
+interface Rendition {
+  name: string;
+  label?: string;
+  altGroup?: number;
+  codec: string;
+  mimeType: string;
+  width?: number;
+  height?: number;
+  framerate?: number;
+  bitrate: number;
+  samplerate?: number;
+  channelConfig?: string;
+}
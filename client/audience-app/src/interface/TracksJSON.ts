@@ -1,12 +1,14 @@
 // track JSON obj parser
 export interface TracksJSON {
+  commonTrackFields?: { packaging?: string };
   tracks: Track[];
 }
-interface Track {
+export interface Track {
   name: string;
   label?: string;
   selectionParams: SelectionParams;
   altGroup?: Number;
+  packaging?: string; // "chunk" (streamer-app framing) or "loc", inherited from commonTrackFields if not set
 }
 interface SelectionParams {
   codec: string;
@@ -1,7 +1,13 @@
+import { ChannelStatus } from "./ChannelStatus";
+import { Track } from "./TracksJSON";
+
 export interface MetaWorkerMessage {
   action: string;
-  channelList?: string[];
+  channelList?: ChannelStatus[];
   trackNames?: string[];
+  trackPackagings?: Record<string, string>; // packaging by track name, including audio
+  trackKinds?: Record<string, string>; // "video" or "audio" by track name, from the selectionParams mimeType
+  tracks?: Track[]; // the catalog's tracks, for the rendition ladders
 }
 
 export interface VideoDecoderWorkerMessage {
@@ -0,0 +1,43 @@
+import { Track } from "../interface/TracksJSON";
+
+// media kind of a catalog track, "video" or "audio": the server checks the mimeType is "<kind>/*"
+export function trackKind(track: Track): string {
+  return track.selectionParams.mimeType.split("/")[0];
+}
+
+// rendition ladder of a track, mirrors Catalog.Ladder in component/channel/catalog/ladder.go: the tracks of the same
+// kind sharing its altGroup, best first, i.e. ordered by bitrate, then resolution, then name. Tracks with equal bitrate
+// & resolution are one rung, the track itself if it is one of them, else the first by name. A track without altGroup is
+// its own single rendition, empty if the catalog has no such track.
+export function ladder(tracks: Track[], trackName: string): string[] {
+  const track = tracks.find((t) => t.name === trackName);
+  if (!track) {
+    return [];
+  }
+  if (!track.altGroup) {
+    return [track.name];
+  }
+
+  const pixels = (t: Track) => Number(t.selectionParams.width ?? 0) * Number(t.selectionParams.height ?? 0);
+  const sameRung = (a: Track, b: Track) =>
+    Number(a.selectionParams.bitrate) === Number(b.selectionParams.bitrate) && pixels(a) === pixels(b);
+  const sorted = tracks
+    .filter((t) => Number(t.altGroup) === Number(track.altGroup) && trackKind(t) === trackKind(track))
+    .sort(
+      (a, b) =>
+        Number(b.selectionParams.bitrate) - Number(a.selectionParams.bitrate) ||
+        pixels(b) - pixels(a) ||
+        (a.name < b.name ? -1 : a.name > b.name ? 1 : 0),
+    );
+
+  const rungs: Track[] = [];
+  for (const t of sorted) {
+    const last = rungs[rungs.length - 1];
+    if (!last || !sameRung(last, t)) {
+      rungs.push(t);
+    } else if (t.name === trackName) {
+      rungs[rungs.length - 1] = t;
+    }
+  }
+  return rungs.map((t) => t.name);
+}
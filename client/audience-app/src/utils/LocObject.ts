@@ -0,0 +1,60 @@
+// LOC (Low Overhead Media Container) object parser, mirrors component/payload/loc.go:
+// extensionCount(i) | [headerType(i) | headerValue(i) or headerLength(i) headerValue(..)]... | media payload
+// even header types carry a varint, odd ones a length prefixed byte string
+
+const CAPTURE_TIMESTAMP = 0x02; // µs since the Unix epoch
+const VIDEO_FRAME_MARKING = 0x04; // RFC 9626 frame marking
+const AUDIO_LEVEL = 0x06; // RFC 6464 audio level
+
+export interface LocObject {
+  captureTimestamp: number; // 0 if not present
+  independent?: boolean; // from the video frame marking, undefined if not present
+  audioLevel?: number; // -dBov
+  data: Uint8Array;
+}
+
+// read a QUIC variable-length integer, the 2 most significant bits give its length
+function readVarint(buffer: Uint8Array, offset: number): [number, number] {
+  if (offset >= buffer.length) {
+    throw new Error("truncated LOC object");
+  }
+  const length = 1 << (buffer[offset] >> 6);
+  if (offset + length > buffer.length) {
+    throw new Error("truncated LOC object");
+  }
+  let value = buffer[offset] & 0x3f;
+  for (let i = 1; i < length; i++) {
+    value = value * 256 + buffer[offset + i];
+  }
+  return [value, offset + length];
+}
+
+export function parseLocObject(buffer: Uint8Array): LocObject {
+  const object: LocObject = { captureTimestamp: 0, data: new Uint8Array() };
+  let [count, offset] = readVarint(buffer, 0);
+  for (let i = 0; i < count; i++) {
+    let id: number, value: number;
+    [id, offset] = readVarint(buffer, offset);
+    [value, offset] = readVarint(buffer, offset);
+    if (id % 2 === 1) {
+      if (offset + value > buffer.length) {
+        throw new Error(`truncated LOC header extension ${id}`);
+      }
+      offset += value; // byte string extensions (e.g. video config) aren't used
+      continue;
+    }
+    switch (id) {
+      case CAPTURE_TIMESTAMP:
+        object.captureTimestamp = value;
+        break;
+      case VIDEO_FRAME_MARKING:
+        object.independent = (value & 0x20) !== 0;
+        break;
+      case AUDIO_LEVEL:
+        object.audioLevel = value & 0x7f;
+        break;
+    }
+  }
+  object.data = buffer.slice(offset);
+  return object;
+}
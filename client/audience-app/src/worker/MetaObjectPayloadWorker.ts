@@ -1,5 +1,7 @@
+import { ChannelStatus } from "../interface/ChannelStatus";
 import { TracksJSON } from "../interface/TracksJSON";
 import { MetaWorkerMessage } from "../interface/WorkerMessage";
+import { trackKind } from "../utils/Ladder";
 
 self.onmessage = async function (e: any) {
   const { action, readableStream } = e.data;
@@ -9,16 +11,16 @@ self.onmessage = async function (e: any) {
     if (value) {
       console.log(`📜 Received meta obj: ${value.length} bytes`);
       if (action === "channels") {
+        // every obj is a new group holding the full channel status list, keep reading for updates
         const channelListDecoder = new TextDecoder();
         try {
           const text = channelListDecoder.decode(value);
-          let channelList: string[] = JSON.parse(text);
-          console.log(`🔻 Worker: 🅾️channelList🅾️: ${channelList}`);
+          let channelList: ChannelStatus[] = JSON.parse(text);
+          console.log(`🔻 Worker: 🅾️channelList🅾️: ${channelList.map((channel) => channel.name)}`);
           const msg: MetaWorkerMessage = { action: "channelList", channelList };
           postMessage(msg);
         } catch (error) {
           console.error("❌ Failed to decode channel list:", error);
-          return;
         }
       } else if (action === "tracks") {
         const tracksDecoder = new TextDecoder();
@@ -29,10 +31,23 @@ self.onmessage = async function (e: any) {
             console.log("🔻 Worker: 🅾️tracks🅾️:", tracksJSON);
             // extract track names except audio track
             const trackNames = tracksJSON.tracks
-              .filter((track) => track.name !== "audio") // filter out audio and keep video rate adaptation tracks // && !track.name.endsWith("-ra")
+              .filter((track) => trackKind(track) === "video") // filter out audio, video renditions are switched along their ladder
               .map((track) => track.name);
             console.log("🔔 Tracks list(trackNames): " + trackNames);
-            const msg: MetaWorkerMessage = { action: "trackNames", trackNames };
+            // objects are decoded by the packaging & media kind of their track
+            const trackPackagings: Record<string, string> = {};
+            const trackKinds: Record<string, string> = {};
+            for (const track of tracksJSON.tracks) {
+              trackPackagings[track.name] = track.packaging ?? tracksJSON.commonTrackFields?.packaging ?? "chunk";
+              trackKinds[track.name] = trackKind(track);
+            }
+            const msg: MetaWorkerMessage = {
+              action: "trackNames",
+              trackNames,
+              trackPackagings,
+              trackKinds,
+              tracks: tracksJSON.tracks,
+            };
             postMessage(msg);
           } catch (err) {
             console.log("❌ Failed to decode tracksJSON:", err);
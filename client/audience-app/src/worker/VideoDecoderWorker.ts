@@ -169,7 +169,7 @@ self.onmessage = function (e) {
       const frame = decodedFrameHeap.peek();
       let currentTimestampDiff = timestamp! - frame!.timestamp;
       // at least n frame is ahead for delaying (1 frame duration is 33333μs), threshold is a little bit more than 1 frame duration to be more tolerant
-      let threshold = 36000 * 1; //! test: 33333 for 1 frame tolerance(hd) (for 30fps video), then trigger rate adaptation, then use 36000 for hd-ra
+      let threshold = 36000 * 1; //! test: 33333 for 1 frame tolerance(hd) (for 30fps video), then trigger rate adaptation, then use 36000 for the lower rendition
       if (rateAdapted) {
         threshold = 36000 * 1; //! test for adjusting threshold after rate adaptation triggered
       }
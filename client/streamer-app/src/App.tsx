@@ -19,11 +19,18 @@ function App() {
   let latencyLogging = false; //! testbed: latency test_0
 
   let mediaType = new Map<string, number>(); // tracks the media type (video, audio etc.) for each subscription, possible keys: "hd", "md", "audio"
+  let workers = new Map<string, Worker>(); // encoder worker of each track, paused while the server has no subscription for it
+  let capturing = false;
 
   const [session, setSession] = useState<Session | null>();
 
   // Streaming Config (part of the catalog)
   const [channelName, setChannelName] = useState<string>("ninja");
+  const [streamKey, setStreamKey] = useState<string>(""); // required if the server authenticates streamers
+  const [channelTitle, setChannelTitle] = useState<string>("");
+  const [channelDescription, setChannelDescription] = useState<string>("");
+  const [channelTags, setChannelTags] = useState<string>(""); // comma separated
+  const [channelVisibility, setChannelVisibility] = useState<"public" | "unlisted" | "private">("public");
   const [bitrate1080P, setBitrate1080P] = useState<number>(1);
   const [bitrate720P, setBitrate720P] = useState<number>(0.5);
   const [streamingConfigError, setStreamingConfigError] = useState<string>("");
@@ -74,7 +81,10 @@ function App() {
 
   async function connect() {
     try {
-      const url = "https://10.0.2.1:443/webtransport/streamer";
+      let url = "https://10.0.2.1:443/webtransport/streamer";
+      if (streamKey) {
+        url += `?key=${encodeURIComponent(streamKey)}`;
+      }
       const s = await Session.connect(url); // const hash = "9b8a96046d47f2523bec35d334b984d99b6beff16b2e477a0aa23da3db116562"; // hash is optional in connect(url, hash)
       controlMessageListener(s);
       setSession(s);
@@ -141,11 +151,14 @@ function App() {
               writeMediaStream = await session.subscribeOk(Number(m.subscribeId), 0, 1, false);
               console.log(`🔺 ✅ SUBSCRIBE_OK(${m.subscribeId}): ns = ${m.trackNamespace}, trackName = ${m.trackName}`);
               mediaType.set(m.trackName, Number(m.subscribeId));
-              console.log("🔔 Capturing media...");
-              // only start capturing when all media tracks are subscribed => easier for synchronization tracks
-              if (mediaType.size === newCatalogJSON.tracks.length) {
-                // if (mediaType.size === 2) { //! testbed latency test_0
+              // the server subscribes to a track only while audiences watch it:
+              // start capturing on the first subscription, resume paused encoders afterwards
+              if (!capturing) {
+                capturing = true;
+                console.log("🔔 Capturing media...");
                 startCapturing();
+              } else {
+                setTrackPaused(m.trackName, false);
               }
               break;
           }
@@ -153,6 +166,13 @@ function App() {
 
         case MessageType.Unsubscribe:
           console.log(`🔻 🟢 UNSUBSCRIBE (${m.subscribeId})`);
+          // no audience watches the track anymore, pause its encoder until the server subscribes again
+          for (const [trackName, subscribeId] of mediaType) {
+            if (subscribeId === Number(m.subscribeId)) {
+              mediaType.delete(trackName);
+              setTrackPaused(trackName, true);
+            }
+          }
           // TODO: send subscribeDone message to the subscriber (no final obj)
           // await session.subscribeDone(Number(m.subscribeId), 0, "Unsubscribed, final message", false);
           // console.log("🟢 Sent SubscribeDone msg for:", m.subscribeId);
@@ -167,8 +187,18 @@ function App() {
   }
 
   async function serializeCatalogJSON() {
-    let catalog = { ...catalogJSON };
+    let catalog: CatalogJSON = { ...catalogJSON };
     catalog.commonTrackFields.namespace = channelName;
+    // channel metadata listed in the audiences' channel directory
+    catalog.metadata = {
+      title: channelTitle,
+      description: channelDescription,
+      tags: channelTags
+        .split(",")
+        .map((tag) => tag.trim())
+        .filter((tag) => tag !== ""),
+      visibility: channelVisibility,
+    };
     catalog.tracks[1].selectionParams.bitrate = bitrate1080P * 1_000_000;
     console.log("🔔 hd track bitrate:", catalog.tracks[1].selectionParams.bitrate);
     catalog.tracks[1].selectionParams.framerate = frameRate;
@@ -176,13 +206,6 @@ function App() {
     console.log("🔔 md track bitrate:", catalog.tracks[2].selectionParams.bitrate);
     catalog.tracks[2].selectionParams.framerate = frameRate;
 
-    catalog.tracks[3].selectionParams.bitrate = bitrate1080P * 1_000_000 * 0.1;
-    console.log("🔔 hd-ra track bitrate:", catalog.tracks[3].selectionParams.bitrate);
-    catalog.tracks[3].selectionParams.framerate = frameRate;
-    catalog.tracks[4].selectionParams.bitrate = bitrate720P * 1_000_000 * 0.1;
-    console.log("🔔 md-ra track bitrate:", catalog.tracks[4].selectionParams.bitrate);
-    catalog.tracks[4].selectionParams.framerate = frameRate;
-
     newCatalogJSON = catalog;
 
     const encoder = new TextEncoder();
@@ -274,11 +297,28 @@ function App() {
       };
     }
     const readableStream = new MediaStreamTrackProcessor(track).readable;
-    worker.postMessage({ config: config, readableStream: readableStream }, [readableStream]);
+    worker.postMessage({ config: config, readableStream: readableStream, paused: !mediaType.has(trackName) }, [
+      readableStream,
+    ]);
+    workers.set(trackName, worker);
+  }
+
+  function setTrackPaused(trackName: string, paused: boolean) {
+    const worker = workers.get(trackName);
+    if (!worker) return;
+    if (!paused && trackName !== "audio") {
+      videoTrackState(trackName).keyFrameSet = false; // wait for the key frame the encoder starts with
+    }
+    worker.postMessage({ paused: paused });
+    console.log(`🔔 ${trackName} encoder ${paused ? "paused" : "resumed"}`);
   }
 
   async function stopCapturing() {
     mediaType.clear();
+    workers.forEach((worker) => worker.terminate());
+    workers.clear();
+    videoTrackStates.clear();
+    capturing = false;
     if (mediaStreamRef.current) {
       mediaStreamRef.current.getTracks().forEach((track) => track.stop());
     }
@@ -332,11 +372,18 @@ function App() {
     sendEncodedChunk(serializeBuffer, trackName, chunk.type, chunk.duration!, chunk.timestamp);
   }
 
-  let keyFrameSet = false;
   let audioGroupId = 0;
   let audioObjId = 0;
-  let videoGroupId = -1;
-  let videoObjectId = 0;
+  // group & object numbering of each video track, tracks are paused & resumed independently
+  let videoTrackStates = new Map<string, { keyFrameSet: boolean; videoGroupId: number; videoObjectId: number }>();
+  function videoTrackState(trackName: string) {
+    let state = videoTrackStates.get(trackName);
+    if (!state) {
+      state = { keyFrameSet: false, videoGroupId: -1, videoObjectId: 0 };
+      videoTrackStates.set(trackName, state);
+    }
+    return state;
+  }
   async function sendEncodedChunk(
     buffer: ArrayBuffer,
     trackName: string,
@@ -347,6 +394,7 @@ function App() {
     if (trackName === "audio") {
       // audio chunk
       let id = mediaType.get(trackName);
+      if (id === undefined) return; // unsubscribed, chunk still in flight from a paused encoder
       // 1 sec of audio chunks in a group
       if (audioObjId < 1000000 / duration) {
         await writeMediaStream(id!, id!, audioGroupId, audioObjId, 0, 0, new Uint8Array(buffer));
@@ -368,28 +416,30 @@ function App() {
     } else {
       // video chunk
       let subId = mediaType.get(trackName);
+      if (subId === undefined) return; // unsubscribed, chunk still in flight from a paused encoder
+      const state = videoTrackState(trackName);
       // key frame first, then delta frames
-      if (key === "key" && !keyFrameSet) {
-        keyFrameSet = true;
-        await writeMediaStream(subId!, subId!, videoGroupId, videoObjectId, 0, 0, new Uint8Array(buffer));
+      if (key === "key" && !state.keyFrameSet) {
+        state.keyFrameSet = true;
+        await writeMediaStream(subId!, subId!, state.videoGroupId, state.videoObjectId, 0, 0, new Uint8Array(buffer));
         latencyLogging && console.log(`🧪 🎬 obj latency ${timestamp} #2: ${Date.now()}`);
-        // console.log(`🔑 Key Frame: groupId ${videoGroupId}, objId ${videoObjectId}, frame size: ${buffer.byteLength} bytes`);
-        videoObjectId++;
+        // console.log(`🔑 Key Frame: groupId ${state.videoGroupId}, objId ${state.videoObjectId}, frame size: ${buffer.byteLength} bytes`);
+        state.videoObjectId++;
       }
-      if (keyFrameSet) {
+      if (state.keyFrameSet) {
         if (key === "delta") {
-          await writeMediaStream(subId!, subId!, videoGroupId, videoObjectId, 0, 0, new Uint8Array(buffer));
+          await writeMediaStream(subId!, subId!, state.videoGroupId, state.videoObjectId, 0, 0, new Uint8Array(buffer));
           latencyLogging && console.log(`🧪 🎬 obj latency ${timestamp} #2: ${Date.now()}`);
-          // console.log(`🔲 Delta Frame: groupId ${videoGroupId}, objId ${videoObjectId}, frame size: ${buffer.byteLength} bytes`);
-          videoObjectId++;
+          // console.log(`🔲 Delta Frame: groupId ${state.videoGroupId}, objId ${state.videoObjectId}, frame size: ${buffer.byteLength} bytes`);
+          state.videoObjectId++;
         } else {
           // key frame
-          videoGroupId++;
-          videoObjectId = 0;
-          await writeMediaStream(subId!, subId!, videoGroupId, videoObjectId, 0, 0, new Uint8Array(buffer));
+          state.videoGroupId++;
+          state.videoObjectId = 0;
+          await writeMediaStream(subId!, subId!, state.videoGroupId, state.videoObjectId, 0, 0, new Uint8Array(buffer));
           latencyLogging && console.log(`🧪 🎬 obj latency ${timestamp} #2: ${Date.now()}`);
-          // console.log(`🔑 Key Frame: groupId ${videoGroupId}, objId ${videoObjectId}, frame size: ${buffer.byteLength} bytes`);
-          videoObjectId++;
+          // console.log(`🔑 Key Frame: groupId ${state.videoGroupId}, objId ${state.videoObjectId}, frame size: ${buffer.byteLength} bytes`);
+          state.videoObjectId++;
         }
       }
     }
@@ -509,6 +559,70 @@ function App() {
                       />
                     </div>
                   </div>
+                  <div className="flex flex-row gap-2">
+                    <div>Stream key:</div>
+                    <div>
+                      <input
+                        className="w-full border-b-2 text-center bg-green-100"
+                        type="password"
+                        id="streamKey"
+                        value={streamKey}
+                        onChange={(e) => setStreamKey(e.target.value)}
+                      />
+                    </div>
+                  </div>
+                  <div className="flex flex-row gap-2">
+                    <div>Title:</div>
+                    <div>
+                      <input
+                        className="w-full border-b-2 text-center bg-green-100"
+                        type="text"
+                        id="channelTitle"
+                        value={channelTitle}
+                        onChange={(e) => setChannelTitle(e.target.value)}
+                      />
+                    </div>
+                  </div>
+                  <div className="flex flex-row gap-2">
+                    <div>Description:</div>
+                    <div>
+                      <input
+                        className="w-full border-b-2 text-center bg-green-100"
+                        type="text"
+                        id="channelDescription"
+                        value={channelDescription}
+                        onChange={(e) => setChannelDescription(e.target.value)}
+                      />
+                    </div>
+                  </div>
+                  <div className="flex flex-row gap-2">
+                    <div>Tags:</div>
+                    <div>
+                      <input
+                        className="w-full border-b-2 text-center placeholder:italic bg-green-100"
+                        type="text"
+                        id="channelTags"
+                        value={channelTags}
+                        placeholder="comma separated"
+                        onChange={(e) => setChannelTags(e.target.value)}
+                      />
+                    </div>
+                  </div>
+                  <div className="flex flex-row gap-2">
+                    <div>Visibility:</div>
+                    <div>
+                      <select
+                        className="w-full border-b-2 text-center bg-green-100"
+                        id="channelVisibility"
+                        value={channelVisibility}
+                        onChange={(e) => setChannelVisibility(e.target.value as "public" | "unlisted" | "private")}
+                      >
+                        <option value="public">public</option>
+                        <option value="unlisted">unlisted</option>
+                        <option value="private">private</option>
+                      </select>
+                    </div>
+                  </div>
                 </fieldset>
               </div>
               <div className="bg-green-100">
@@ -9,6 +9,12 @@ export interface CatalogJSON {
     renderGroup: number;
   };
   tracks: Track[];
+  metadata?: {
+    title?: string;
+    description?: string;
+    tags?: string[];
+    visibility?: "public" | "unlisted" | "private";
+  };
 }
 interface Track {
   name: string;
@@ -5,7 +5,17 @@ function send(chunk: EncodedAudioChunk) {
   postMessage(chunk);
 }
 
+// paused while the server has no subscription for the track, audio data is dropped without encoding
+let paused = false;
+
 self.onmessage = function (e) {
+  if (e.data.paused !== undefined) {
+    paused = e.data.paused;
+    console.log(`Audio Encoder Worker ${paused ? "paused" : "resumed"}`);
+  }
+  if (!e.data.config) {
+    return;
+  }
   const { config, readableStream } = e.data;
   const audioEncoder: AudioEncoder = new AudioEncoder({
     output: send,
@@ -26,7 +36,7 @@ async function encodeAudio(reader: ReadableStreamDefaultReader<AudioData>, audio
   while (true) {
     const { done, value } = await reader.read();
     if (done) break;
-    if (audioEncoder) {
+    if (audioEncoder && !paused) {
       latencyLogging && console.log(`🧪 🔊 obj latency ${value.timestamp} #0: ${Date.now()}}`);
       audioEncoder.encode(value);
       // console.log(`🔊 Encoded audio: ${value.timestamp}`);
@@ -7,7 +7,20 @@ function send(chunk: EncodedVideoChunk) {
   postMessage(chunk);
 }
 
+// paused while the server has no subscription for the track, frames are dropped without encoding
+let paused = false;
+
 self.onmessage = function (e) {
+  if (e.data.paused !== undefined) {
+    if (paused && !e.data.paused) {
+      frameIndex = 0; // resume with a key frame so new audiences can decode right away
+    }
+    paused = e.data.paused;
+    console.log(`Video Encoder Worker ${paused ? "paused" : "resumed"}`);
+  }
+  if (!e.data.config) {
+    return;
+  }
   const { config, readableStream } = e.data;
   const videoEncoder: VideoEncoder = new VideoEncoder({
     output: send,
@@ -35,7 +48,7 @@ async function encodeVideo(
   while (true) {
     const { done, value } = await reader.read();
     if (done) break;
-    if (videoEncoder) {
+    if (videoEncoder && !paused) {
       if (frameIndex === 0) {
         isKeyFrame = true;
       } else {
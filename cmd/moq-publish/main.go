@@ -0,0 +1,272 @@
+// moq-publish streams VP8 IVF and Opus Ogg files to a moq-live-stream server as a channel, in real time and with the
+// object framing & numbering of the streamer-app, e.g.
+//
+//	go run ./cmd/moq-publish -server https://localhost:4443 -insecure -channel demo -video hd=hd.ivf -video md=md.ivf -audio audio.ogg
+//
+// A server that authenticates streamers needs a stream key or token, -key passes it in the URL query.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/forwarding"
+	"moqlivestream/component/payload"
+	"moqlivestream/utilities"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+)
+
+var log = utilities.NewCustomLogger()
+
+// repeatable string flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type options struct {
+	server      string
+	insecure    bool
+	key         string
+	channel     string
+	videos      listFlag
+	audios      listFlag
+	catalogPath string
+	title       string
+	description string
+	tags        string
+	visibility  string
+	packaging   string
+	audioMode   string
+	videoMode   string
+	loop        bool
+}
+
+func main() {
+	opts := options{}
+	fs := flag.NewFlagSet("moq-publish", flag.ContinueOnError)
+	fs.StringVar(&opts.server, "server", "https://10.0.2.1:443", "server URL, /webtransport/streamer is used if it has no path")
+	fs.BoolVar(&opts.insecure, "insecure", false, "don't verify the server's certificate")
+	fs.StringVar(&opts.key, "key", "", "stream key or token of the channel, sent as the key URL query parameter (env MOQ_STREAM_KEY)")
+	fs.StringVar(&opts.channel, "channel", "", "channel name, ANNOUNCEd as namespace (required)")
+	fs.Var(&opts.videos, "video", "VP8 IVF file as [name=]path, repeatable, the name defaults to the file name")
+	fs.Var(&opts.audios, "audio", "Opus Ogg file as [name=]path, repeatable, the name defaults to \"audio\"")
+	fs.StringVar(&opts.catalogPath, "catalog", "", "catalog JSON file to announce instead of one built from the files")
+	fs.StringVar(&opts.title, "title", "", "channel title listed in the channel directory")
+	fs.StringVar(&opts.description, "description", "", "channel description listed in the channel directory")
+	fs.StringVar(&opts.tags, "tags", "", "comma separated channel tags listed in the channel directory")
+	fs.StringVar(&opts.visibility, "visibility", "", "channel visibility: public (default), unlisted or private")
+	fs.StringVar(&opts.packaging, "packaging", payload.PackagingChunk, "object packaging of a catalog built from the files: \"chunk\" (streamer-app framing) or \"loc\"")
+	fs.StringVar(&opts.audioMode, "audio-forwarding", "", fmt.Sprintf("forwarding mode of the audio tracks declared in the catalog, one of %v, default one stream per object", forwarding.Modes()))
+	fs.StringVar(&opts.videoMode, "video-forwarding", "", fmt.Sprintf("forwarding mode of the video tracks declared in the catalog, one of %v, default one stream per object", forwarding.Modes()))
+	fs.BoolVar(&opts.loop, "loop", false, "restart the files after their last frame")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+
+	if err := run(opts); err != nil {
+		// the logger writes to log/server.log only, also report errors on the terminal
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+func run(opts options) error {
+	if opts.channel == "" {
+		return errors.New("-channel is required")
+	}
+	if opts.key == "" {
+		opts.key = os.Getenv("MOQ_STREAM_KEY")
+	}
+	if len(opts.videos) == 0 && len(opts.audios) == 0 {
+		return errors.New("at least one -video or -audio file is required")
+	}
+	if !payload.Supported(opts.packaging) {
+		return fmt.Errorf("-packaging %q: must be %s or %s", opts.packaging, payload.PackagingChunk, payload.PackagingLOC)
+	}
+
+	tracks := []*mediaTrack{}
+	for _, value := range opts.audios {
+		name, path := "audio", value
+		if n, p, ok := strings.Cut(value, "="); ok {
+			name, path = n, p
+		}
+		track, err := loadOgg(name, path)
+		if err != nil {
+			return err
+		}
+		tracks = append(tracks, track)
+	}
+	for _, value := range opts.videos {
+		name, path := parseTrackFlag(value)
+		track, err := loadIVF(name, path)
+		if err != nil {
+			return err
+		}
+		tracks = append(tracks, track)
+	}
+
+	c, err := channelCatalog(opts, tracks)
+	if err != nil {
+		return err
+	}
+	p, err := newPublisher(c, tracks)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dialer := &webtransport.Dialer{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.insecure},
+		QUICConfig:      &quic.Config{EnableDatagrams: true},
+	}
+	endpoint := streamerEndpoint(opts.server)
+	_, session, err := dialer.Dial(ctx, withStreamKey(endpoint, opts.key), http.Header{})
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", endpoint, err)
+	}
+	defer session.CloseWithError(0, "publisher stopped")
+
+	moqSession := &moqtransport.Session{
+		Conn:                forwarding.NewConn(webtransportmoq.New(session)),
+		EnableDatagrams:     false,
+		LocalRole:           moqtransport.RolePublisher,
+		RemoteRole:          moqtransport.RoleSubscriber,
+		AnnouncementHandler: nil,
+		SubscriptionHandler: p,
+	}
+	if err := moqSession.RunClient(); err != nil {
+		return fmt.Errorf("running moqt client: %w", err)
+	}
+	log.Printf("🔗 Connected to %s", endpoint)
+
+	// the server subscribes to the catalogTrack while handling the ANNOUNCE and only accepts it with a valid catalog
+	if err := moqSession.Announce(ctx, opts.channel); err != nil {
+		return fmt.Errorf("announcing channel %s: %w", opts.channel, err)
+	}
+	fmt.Fprintf(os.Stderr, "📢 Channel %s live with %d tracks\n", opts.channel, len(tracks))
+	log.Printf("📢 Channel %s announced", opts.channel)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-session.Context().Done()
+		cancel()
+	}()
+
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for _, track := range tracks {
+		wg.Add(1)
+		go func(track *mediaTrack) {
+			defer wg.Done()
+			p.publish(ctx, track, start, opts.loop)
+		}(track)
+	}
+	wg.Wait()
+
+	if session.Context().Err() != nil {
+		return fmt.Errorf("session ended: %w", context.Cause(session.Context()))
+	}
+	return nil
+}
+
+// the catalog given by -catalog or built from the files, with the channel name as namespace and the metadata flags applied
+func channelCatalog(opts options, tracks []*mediaTrack) (*catalog.Catalog, error) {
+	var metadata *catalog.Metadata
+	if opts.title != "" || opts.description != "" || opts.tags != "" || opts.visibility != "" {
+		metadata = &catalog.Metadata{Title: opts.title, Description: opts.description, Visibility: opts.visibility}
+		for _, tag := range strings.Split(opts.tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				metadata.Tags = append(metadata.Tags, tag)
+			}
+		}
+	}
+
+	var c *catalog.Catalog
+	if opts.catalogPath != "" {
+		catalogBytes, err := os.ReadFile(opts.catalogPath)
+		if err != nil {
+			return nil, err
+		}
+		if c, err = catalog.ParseCatalog(catalogBytes); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", opts.catalogPath, err)
+		}
+		c.CommonTrackFields.Namespace = opts.channel
+		if metadata != nil {
+			c.Metadata = metadata
+		}
+		for _, track := range tracks {
+			if c.GetTrackByName(track.name) == nil {
+				return nil, fmt.Errorf("track %s of %s is not in catalog %s", track.name, track.path, opts.catalogPath)
+			}
+		}
+	} else {
+		c = buildCatalog(opts.channel, tracks, metadata, opts.packaging)
+	}
+
+	// the server rejects the ANNOUNCE of an invalid catalog, report it before connecting
+	c.Normalize()
+	for i := range c.Tracks {
+		c.Tracks[i].Forwarding = forwarding.Config{Audio: opts.audioMode, Video: opts.videoMode}.Resolve(c.Tracks[i].Kind(), c.Tracks[i].Forwarding)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+	// objects are encoded in the packaging & sent in the forwarding mode the catalog names for their track
+	for _, track := range tracks {
+		track.packaging = c.GetTrackByName(track.name).Packaging
+		track.forwarding = c.GetTrackByName(track.name).Forwarding
+		if !payload.Supported(track.packaging) {
+			return nil, fmt.Errorf("track %s: packaging %q not supported, only %s or %s", track.name, track.packaging, payload.PackagingChunk, payload.PackagingLOC)
+		}
+	}
+	return c, nil
+}
+
+// the server's streamer endpoint, a server URL without a path gets the default one
+func streamerEndpoint(server string) string {
+	u, err := url.Parse(server)
+	if err != nil || strings.Trim(u.Path, "/") != "" {
+		return server
+	}
+	u.Path = "/webtransport/streamer"
+	return u.String()
+}
+
+// add the stream key to the endpoint's query, kept out of the logged endpoint
+func withStreamKey(endpoint string, key string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || key == "" {
+		return endpoint
+	}
+	query := u.Query()
+	query.Set("key", key)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
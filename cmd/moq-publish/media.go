@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/mediafile"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// one encoded frame of an input file, published as one object
+type frame struct {
+	timestamp time.Duration // from the start of the file
+	duration  time.Duration // audio only
+	key       bool
+	data      []byte
+}
+
+// a media track loaded from an input file
+type mediaTrack struct {
+	name       string
+	kind       string // "video" or "audio"
+	path       string
+	frames     []frame
+	duration   time.Duration // of one pass through the file
+	params     catalog.SelectionParams
+	packaging  string // of the track in the announced catalog
+	forwarding string // mode the track's objects are sent in, from the announced catalog, "" for one stream per object
+}
+
+// load every frame of a VP8 IVF file
+func loadIVF(name string, path string) (*mediaTrack, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := mediafile.NewIVFReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	header := reader.Header()
+	if header.FourCC != "VP80" {
+		return nil, fmt.Errorf("%s: codec %q not supported, only VP8 (VP80)", path, header.FourCC)
+	}
+
+	track := &mediaTrack{name: name, kind: "video", path: path}
+	size := 0
+	for {
+		f, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		track.frames = append(track.frames, frame{
+			timestamp: header.Timestamp(f.PTS),
+			key:       mediafile.IsVP8KeyFrame(f.Data),
+			data:      f.Data,
+		})
+		size += len(f.Data)
+	}
+	if len(track.frames) == 0 {
+		return nil, fmt.Errorf("%s: no frames", path)
+	}
+	if !track.frames[0].key {
+		return nil, fmt.Errorf("%s: first frame is not a key frame", path)
+	}
+
+	// the last frame lasts one timebase unit
+	frameDuration := header.Timestamp(1)
+	track.duration = track.frames[len(track.frames)-1].timestamp + frameDuration
+	track.params = catalog.SelectionParams{
+		Codec:     "vp8",
+		MimeType:  "video/webm",
+		Width:     int(header.Width),
+		Height:    int(header.Height),
+		Framerate: int(math.Round(float64(len(track.frames)) / track.duration.Seconds())),
+		Bitrate:   bitrate(size, track.duration),
+	}
+	return track, nil
+}
+
+// load every packet of an Ogg Opus file
+func loadOgg(name string, path string) (*mediaTrack, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := mediafile.NewOggReader(file)
+	packet, err := reader.ReadPacket()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	head, err := mediafile.ParseOpusHead(packet.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w, only Opus is supported", path, err)
+	}
+
+	track := &mediaTrack{name: name, kind: "audio", path: path}
+	size := 0
+	for {
+		packet, err := reader.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if mediafile.IsOpusTags(packet.Data) {
+			continue
+		}
+		duration, err := mediafile.OpusPacketDuration(packet.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		track.frames = append(track.frames, frame{
+			timestamp: track.duration,
+			duration:  duration,
+			key:       true, // every Opus packet decodes on its own, like the WebCodecs audio chunks
+			data:      packet.Data,
+		})
+		track.duration += duration
+		size += len(packet.Data)
+	}
+	if len(track.frames) == 0 {
+		return nil, fmt.Errorf("%s: no audio packets", path)
+	}
+
+	track.params = catalog.SelectionParams{
+		Codec:         "opus",
+		MimeType:      "audio/webm",
+		Bitrate:       bitrate(size, track.duration),
+		Samplerate:    48000, // Opus always decodes at 48 kHz
+		ChannelConfig: strconv.Itoa(int(head.Channels)),
+	}
+	return track, nil
+}
+
+// average bitrate in bit/s, at least 1
+func bitrate(size int, duration time.Duration) int {
+	if duration <= 0 {
+		return 1
+	}
+	return max(1, int(float64(size*8)/duration.Seconds()))
+}
+
+// build the catalog announced for the tracks, laid out like the streamer-app's catalog.json
+func buildCatalog(namespace string, tracks []*mediaTrack, metadata *catalog.Metadata, packaging string) *catalog.Catalog {
+	c := &catalog.Catalog{
+		Version:                1,
+		StreamingFormat:        1,
+		StreamingFormatVersion: "0.1",
+		CommonTrackFields: catalog.CommonTrackFields{
+			Namespace:   namespace,
+			Packaging:   packaging,
+			RenderGroup: 1,
+		},
+		Tracks:   []catalog.Track{},
+		Metadata: metadata,
+	}
+	for _, track := range tracks {
+		entry := catalog.Track{Name: track.name, SelectionParams: track.params}
+		if track.kind == "video" {
+			entry.Label = fmt.Sprintf("Video %dP", track.params.Height)
+			entry.AltGroup = 1 // video tracks are renditions of the same source
+		}
+		c.Tracks = append(c.Tracks, entry)
+	}
+	return c
+}
+
+// parse a -video or -audio value: "name=path", or a path whose file name without extension becomes the track name
+func parseTrackFlag(value string) (string, string) {
+	if name, path, ok := strings.Cut(value, "="); ok {
+		return name, path
+	}
+	base := value[strings.LastIndexAny(value, `/\`)+1:]
+	if dot := strings.LastIndex(base, "."); dot > 0 {
+		base = base[:dot]
+	}
+	return base, value
+}
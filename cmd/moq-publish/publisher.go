@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/forwarding"
+	"moqlivestream/component/payload"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// publisher serves the catalog & media tracks of one channel to the server, like the streamer-app
+type publisher struct {
+	namespace    string
+	catalogBytes []byte
+	tracks       map[string]*mediaTrack
+	locals       map[string]*moqtransport.LocalTrack // tracks the server subscribed at least once, by name
+	mutex        sync.Mutex
+}
+
+func newPublisher(c *catalog.Catalog, tracks []*mediaTrack) (*publisher, error) {
+	catalogBytes, err := c.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	p := &publisher{
+		namespace:    c.CommonTrackFields.Namespace,
+		catalogBytes: catalogBytes,
+		tracks:       map[string]*mediaTrack{},
+		locals:       map[string]*moqtransport.LocalTrack{},
+	}
+	for _, track := range tracks {
+		p.tracks[track.name] = track
+	}
+	return p, nil
+}
+
+// called by moqtransport for the first SUBSCRIBE to each track, later ones are accepted by moqtransport on the existing local track
+func (p *publisher) HandleSubscription(session *moqtransport.Session, s *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+	log.Printf("🔔 Subscription received: namespace(%s), trackName(%s), id(%v)", s.Namespace, s.TrackName, s.ID)
+	if s.Namespace != p.namespace {
+		srw.Reject(moqtransport.ErrorCodeTrackNotFound, "unknown namespace")
+		return
+	}
+	if _, ok := p.tracks[s.TrackName]; !ok && s.TrackName != "catalogTrack" {
+		srw.Reject(moqtransport.ErrorCodeTrackNotFound, "unknown track")
+		return
+	}
+
+	local := moqtransport.NewLocalTrack(s.Namespace, s.TrackName)
+	if err := session.AddLocalTrack(local); err != nil {
+		log.Printf("❌ error adding local track %s: %s", s.TrackName, err)
+		srw.Reject(moqtransport.ErrorCodeInternal, "error adding local track")
+		return
+	}
+	srw.Accept(local)
+
+	if s.TrackName == "catalogTrack" {
+		go func() {
+			err := local.WriteObject(context.Background(), moqtransport.Object{GroupID: 0, ObjectID: 0, PublisherPriority: 0, ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream, Payload: p.catalogBytes})
+			if err != nil {
+				log.Printf("❌ error writing catalog: %s", err)
+				return
+			}
+			log.Printf("📤 Catalog sent: %s", p.catalogBytes)
+		}()
+		return
+	}
+	p.mutex.Lock()
+	p.locals[s.TrackName] = local
+	p.mutex.Unlock()
+}
+
+// the local track of a media track while the server subscribes to it, nil while nobody does
+func (p *publisher) activeTrack(name string) *moqtransport.LocalTrack {
+	p.mutex.Lock()
+	local := p.locals[name]
+	p.mutex.Unlock()
+	if local == nil || local.SubscriberCount() == 0 {
+		return nil
+	}
+	return local
+}
+
+// group & object numbering of a track, as in the streamer-app's sendEncodedChunk
+type numbering struct {
+	keyFrameSet bool // video: a key frame started the current group since the track became active
+	started     bool // a group was written before, the next one increments the group ID
+	groupID     uint64
+	objectID    uint64
+}
+
+// next group & object ID of a video frame: a new group at each key frame, delta frames are dropped until the first key frame
+func (n *numbering) nextVideo(key bool) (uint64, uint64, bool) {
+	if key {
+		if n.started {
+			n.groupID++
+		}
+		n.started = true
+		n.keyFrameSet = true
+		n.objectID = 0
+	} else if !n.keyFrameSet {
+		return 0, 0, false
+	}
+	objectID := n.objectID
+	n.objectID++
+	return n.groupID, objectID, true
+}
+
+// next group & object ID of an audio frame: one second of audio per group
+func (n *numbering) nextAudio(duration time.Duration) (uint64, uint64) {
+	if duration > 0 && float64(n.objectID) >= float64(time.Second)/float64(duration) {
+		n.groupID++
+		n.objectID = 0
+	}
+	objectID := n.objectID
+	n.objectID++
+	return n.groupID, objectID
+}
+
+// publish a track's frames in real time from start until ctx is done, frames are only written while the server subscribes.
+// With loop the file restarts after its last frame, timestamps keep increasing.
+func (p *publisher) publish(ctx context.Context, track *mediaTrack, start time.Time, loop bool) {
+	n := &numbering{}
+	var offset time.Duration // of the current pass through the file
+	for {
+		for _, f := range track.frames {
+			timestamp := offset + f.timestamp
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(start.Add(timestamp))):
+			}
+
+			local := p.activeTrack(track.name)
+			if local == nil {
+				n.keyFrameSet = false // like a paused encoder, resume with a key frame
+				continue
+			}
+			var groupID, objectID uint64
+			if track.kind == "audio" {
+				groupID, objectID = n.nextAudio(f.duration)
+			} else {
+				var ok bool
+				if groupID, objectID, ok = n.nextVideo(f.key); !ok {
+					continue
+				}
+			}
+
+			framed, err := encodeFrame(track, f, start, timestamp)
+			if err != nil {
+				log.Printf("❌ error framing object %d/%d of track %s: %s", groupID, objectID, track.name, err)
+				continue
+			}
+			obj := moqtransport.Object{GroupID: groupID, ObjectID: objectID, PublisherPriority: 0, ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream, Payload: framed}
+			obj = forwarding.Apply(obj, track.forwarding)
+			if err := local.WriteObject(ctx, obj); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("❌ error writing object %d/%d of track %s: %s", groupID, objectID, track.name, err)
+				}
+				continue
+			}
+		}
+		if !loop {
+			log.Printf("🏁 Track %s finished", track.name)
+			return
+		}
+		offset += track.duration
+	}
+}
+
+// encode a frame as object payload in the packaging of its track, with its timestamp in the published stream.
+// The chunk framing carries the timestamp from the start like the streamer-app, LOC the capture time since the Unix epoch.
+func encodeFrame(track *mediaTrack, f frame, start time.Time, timestamp time.Duration) ([]byte, error) {
+	c := &payload.Chunk{Type: payload.ChunkTypeVideo, Key: f.key, Timestamp: timestamp, Data: f.data}
+	if track.kind == "audio" {
+		c.Type = payload.ChunkTypeAudio
+		c.Duration = f.duration
+	}
+	if track.packaging == payload.PackagingLOC {
+		c.Timestamp = time.Duration(start.Add(timestamp).UnixMicro()) * time.Microsecond
+	}
+	return payload.EncodeObject(track.packaging, c)
+}
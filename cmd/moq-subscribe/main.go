@@ -0,0 +1,396 @@
+// moq-subscribe watches a channel of a moq-live-stream server like the audience-app and records the received objects to
+// IVF/Ogg files or to an object log, for automated checks without a browser, e.g.
+//
+//	go run ./cmd/moq-subscribe -server https://localhost:4443 -insecure -list
+//	go run ./cmd/moq-subscribe -server https://localhost:4443 -insecure -channel demo -tracks hd,audio -out rec -duration 30s
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/channelmanager"
+	"moqlivestream/utilities"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+)
+
+var log = utilities.NewCustomLogger()
+
+// time to wait for the channel directory, the catalog and each SUBSCRIBE_OK
+const subscribeTimeout = 5 * time.Second
+
+type options struct {
+	server   string
+	insecure bool
+	token    string
+	list     bool
+	channel  string
+	tracks   string
+	out      string
+	format   string
+	duration time.Duration
+}
+
+func main() {
+	opts := options{}
+	fs := flag.NewFlagSet("moq-subscribe", flag.ContinueOnError)
+	fs.StringVar(&opts.server, "server", "https://10.0.2.1:443", "server URL, /webtransport/audience is used if it has no path")
+	fs.BoolVar(&opts.insecure, "insecure", false, "don't verify the server's certificate")
+	fs.StringVar(&opts.token, "token", "", "viewer token of private channels, sent as the token URL query parameter (env MOQ_VIEWER_TOKEN)")
+	fs.BoolVar(&opts.list, "list", false, "print the channel directory and exit")
+	fs.StringVar(&opts.channel, "channel", "", "channel to record (required without -list)")
+	fs.StringVar(&opts.tracks, "tracks", "", "comma separated tracks to record, defaults to the first video track and every audio track of the catalog")
+	fs.StringVar(&opts.out, "out", ".", "directory the recordings are written to")
+	fs.StringVar(&opts.format, "format", "media", "\"media\" writes VP8/VP9 tracks to IVF & Opus tracks to Ogg files, \"log\" writes one JSON line per object, \"all\" both")
+	fs.DurationVar(&opts.duration, "duration", 0, "stop recording after this long, 0 records until the channel ends or on interrupt")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+
+	if err := run(opts); err != nil {
+		// the logger writes to log/server.log only, also report errors on the terminal
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+func run(opts options) error {
+	if !opts.list && opts.channel == "" {
+		return errors.New("-channel or -list is required")
+	}
+	writeMedia, writeLog := false, false
+	switch opts.format {
+	case "media":
+		writeMedia = true
+	case "log":
+		writeLog = true
+	case "all":
+		writeMedia, writeLog = true, true
+	default:
+		return fmt.Errorf("-format %q: must be media, log or all", opts.format)
+	}
+	if opts.duration < 0 {
+		return fmt.Errorf("-duration %s: must not be negative", opts.duration)
+	}
+	if opts.token == "" {
+		opts.token = os.Getenv("MOQ_VIEWER_TOKEN")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dialer := &webtransport.Dialer{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.insecure},
+		QUICConfig:      &quic.Config{EnableDatagrams: true},
+	}
+	endpoint := audienceEndpoint(opts.server)
+	_, session, err := dialer.Dial(ctx, withViewerToken(endpoint, opts.token), http.Header{})
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", endpoint, err)
+	}
+	defer session.CloseWithError(0, "subscriber stopped")
+
+	moqSession := &moqtransport.Session{
+		Conn:                webtransportmoq.New(session),
+		EnableDatagrams:     true, // receive the objects the server forwards as datagrams
+		LocalRole:           moqtransport.RoleSubscriber,
+		RemoteRole:          moqtransport.RolePublisher,
+		AnnouncementHandler: moqtransport.AnnouncementHandlerFunc(handleAnnouncement),
+		SubscriptionHandler: nil,
+	}
+	if err := moqSession.RunClient(); err != nil {
+		return fmt.Errorf("running moqt client: %w", err)
+	}
+	log.Printf("🔗 Connected to %s", endpoint)
+
+	// remote tracks aren't closed with the session, reads end with this context instead
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		select {
+		case <-session.Context().Done():
+			cancel(fmt.Errorf("session ended: %w", context.Cause(session.Context())))
+		case <-ctx.Done():
+		}
+	}()
+
+	// subscribe IDs as in the audience-app: 0 the channel directory, 1 the catalogTrack, then the media tracks
+	s := &subscriber{session: moqSession}
+	directory, err := s.subscribe(ctx, "channels", "channelListTrack")
+	if err != nil {
+		return fmt.Errorf("subscribing to the channel directory: %w", err)
+	}
+	snapshot, groupID, err := readDirectory(ctx, directory)
+	if err != nil {
+		return err
+	}
+	if opts.list {
+		printDirectory(snapshot)
+		return nil
+	}
+	// unlisted & private channels aren't in the directory, the server decides on the SUBSCRIBE to their catalogTrack
+	status := findChannel(snapshot, opts.channel)
+	if status != nil && !status.Status {
+		return fmt.Errorf("channel %s is not live", opts.channel)
+	}
+
+	catalogTrack, err := s.subscribe(ctx, opts.channel, "catalogTrack")
+	if err != nil {
+		return fmt.Errorf("subscribing to the catalogTrack of %s: %w", opts.channel, err)
+	}
+	c, err := readCatalog(ctx, catalogTrack)
+	if err != nil {
+		return err
+	}
+	tracks, err := selectTracks(c, opts.tracks)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(opts.out, 0o755); err != nil {
+		return err
+	}
+	r, err := newRecorder(opts.out, opts.channel, tracks, writeMedia, writeLog)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	if opts.duration > 0 {
+		var stopTimer context.CancelFunc
+		ctx, stopTimer = context.WithTimeoutCause(ctx, opts.duration, errRecordingDone)
+		defer stopTimer()
+	}
+	if status != nil {
+		go followDirectory(ctx, cancel, directory, groupID, opts.channel)
+	}
+	go followCatalog(ctx, catalogTrack, c)
+
+	wg := sync.WaitGroup{}
+	for _, track := range tracks {
+		remote, err := s.subscribe(ctx, opts.channel, track.Name)
+		if err != nil {
+			// stop recording the tracks subscribed so far before the deferred r.close closes their files
+			err = fmt.Errorf("subscribing to track %s: %w", track.Name, err)
+			cancel(err)
+			wg.Wait()
+			return err
+		}
+		log.Printf("🔔 Subscribed to track %s of channel %s", track.Name, opts.channel)
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			r.record(ctx, name, remote)
+		}(track.Name)
+	}
+	fmt.Fprintf(os.Stderr, "⏺️ Recording %d tracks of channel %s to %s\n", len(tracks), opts.channel, opts.out)
+	wg.Wait()
+
+	cause := context.Cause(ctx)
+	fmt.Fprintf(os.Stderr, "⏹️ Recording stopped: %v\n", cause)
+	log.Printf("⏹️ Recording of channel %s stopped: %v", opts.channel, cause)
+	if errors.Is(cause, errRecordingDone) || errors.Is(cause, errChannelEnded) || errors.Is(cause, context.Canceled) {
+		return nil
+	}
+	return cause
+}
+
+var (
+	errRecordingDone = errors.New("recording duration reached")
+	errChannelEnded  = errors.New("channel ended")
+)
+
+// accept the server's ANNOUNCE of the "channels" namespace, like the audience-app
+func handleAnnouncement(session *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
+	if a.Namespace() != "channels" {
+		arw.Reject(http.StatusBadRequest, "only the channels namespace is followed")
+		return
+	}
+	arw.Accept()
+}
+
+// subscriber numbers the SUBSCRIBEs of the session
+type subscriber struct {
+	session *moqtransport.Session
+	nextID  uint64
+}
+
+func (s *subscriber) subscribe(ctx context.Context, namespace string, trackName string) (*moqtransport.RemoteTrack, error) {
+	ctx, cancel := context.WithTimeout(ctx, subscribeTimeout)
+	defer cancel()
+	id := s.nextID
+	s.nextID++
+	return s.session.Subscribe(ctx, id, id, namespace, trackName, "")
+}
+
+// read the next snapshot of the channel directory and its group
+func readDirectory(ctx context.Context, directory *moqtransport.RemoteTrack) ([]channelmanager.ChannelStatus, uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, subscribeTimeout)
+	defer cancel()
+	obj, err := directory.ReadObject(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading the channel directory: %w", err)
+	}
+	var snapshot []channelmanager.ChannelStatus
+	if err := json.Unmarshal(obj.Payload, &snapshot); err != nil {
+		return nil, 0, fmt.Errorf("parsing the channel directory: %w", err)
+	}
+	return snapshot, obj.GroupID, nil
+}
+
+func findChannel(snapshot []channelmanager.ChannelStatus, name string) *channelmanager.ChannelStatus {
+	for i := range snapshot {
+		if snapshot[i].Name == name {
+			return &snapshot[i]
+		}
+	}
+	return nil
+}
+
+func printDirectory(snapshot []channelmanager.ChannelStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tSTATUS\tVIEWERS\tTRACKS\tTITLE")
+	for _, status := range snapshot {
+		live := "offline"
+		if status.Status {
+			live = "live"
+		}
+		tracks := []string{}
+		for _, rendition := range status.Renditions {
+			tracks = append(tracks, rendition.Name)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", status.Name, live, status.Viewers, strings.Join(tracks, ","), status.Title)
+	}
+	w.Flush()
+}
+
+// stop the recording once the channel goes offline or is no longer listed, snapshots older than the group read last are
+// skipped: each is sent on its own stream and may arrive after a newer one
+func followDirectory(ctx context.Context, cancel context.CancelCauseFunc, directory *moqtransport.RemoteTrack, latest uint64, name string) {
+	for {
+		obj, err := directory.ReadObject(ctx)
+		if err != nil {
+			return
+		}
+		if obj.GroupID <= latest {
+			continue
+		}
+		latest = obj.GroupID
+		var snapshot []channelmanager.ChannelStatus
+		if err := json.Unmarshal(obj.Payload, &snapshot); err != nil {
+			log.Printf("❌ error parsing channel directory (group %d): %s", obj.GroupID, err)
+			continue
+		}
+		if status := findChannel(snapshot, name); status == nil || !status.Status {
+			cancel(errChannelEnded)
+			return
+		}
+	}
+}
+
+// read the first catalog of the channel
+func readCatalog(ctx context.Context, catalogTrack *moqtransport.RemoteTrack) (*catalog.Catalog, error) {
+	ctx, cancel := context.WithTimeout(ctx, subscribeTimeout)
+	defer cancel()
+	obj, err := catalogTrack.ReadObject(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading the catalog: %w", err)
+	}
+	c, err := catalog.ParseCatalog(obj.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the catalog: %w", err)
+	}
+	c.Normalize()
+	log.Printf("📜 Catalog received: %s", obj.Payload)
+	return c, nil
+}
+
+// log the catalog updates the server pushes, the recorded tracks stay the same
+func followCatalog(ctx context.Context, catalogTrack *moqtransport.RemoteTrack, current *catalog.Catalog) {
+	for {
+		obj, err := catalogTrack.ReadObject(ctx)
+		if err != nil {
+			return
+		}
+		updated, err := catalog.ApplyUpdate(current, obj.Payload)
+		if err != nil {
+			log.Printf("❌ error applying catalog update (group %d): %s", obj.GroupID, err)
+			continue
+		}
+		current = updated
+		log.Printf("📜 Catalog updated: %s", obj.Payload)
+	}
+}
+
+// the catalog tracks named by -tracks, or the first video track and every audio track
+func selectTracks(c *catalog.Catalog, names string) ([]catalog.Track, error) {
+	tracks := []catalog.Track{}
+	if names != "" {
+		for _, name := range strings.Split(names, ",") {
+			track := c.GetTrackByName(strings.TrimSpace(name))
+			if track == nil {
+				return nil, fmt.Errorf("track %s is not in the catalog", name)
+			}
+			tracks = append(tracks, *track)
+		}
+		return tracks, nil
+	}
+
+	video := false
+	for _, track := range c.Tracks {
+		switch track.Kind() {
+		case "video":
+			if !video {
+				tracks = append(tracks, track)
+				video = true
+			}
+		case "audio":
+			tracks = append(tracks, track)
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("the catalog has no video or audio tracks")
+	}
+	return tracks, nil
+}
+
+// the server's audience endpoint, a server URL without a path gets the default one
+func audienceEndpoint(server string) string {
+	u, err := url.Parse(server)
+	if err != nil || strings.Trim(u.Path, "/") != "" {
+		return server
+	}
+	u.Path = "/webtransport/audience"
+	return u.String()
+}
+
+// add the viewer token to the endpoint's query, kept out of the logged endpoint
+func withViewerToken(endpoint string, token string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || token == "" {
+		return endpoint
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
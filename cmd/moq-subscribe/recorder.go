@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/forwarding"
+	"moqlivestream/component/mediafile"
+	"moqlivestream/component/payload"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// one line of the object log
+type objectLogEntry struct {
+	Track      string    `json:"track"`
+	GroupID    uint64    `json:"groupId"`
+	ObjectID   uint64    `json:"objectId"`
+	Size       int       `json:"size"`       // of the payload
+	Forwarding string    `json:"forwarding"` // mode the object arrived in: track, group, object or datagram
+	Type       string    `json:"type,omitempty"`
+	Key        bool      `json:"key,omitempty"`
+	Timestamp  int64     `json:"timestamp"`            // µs, as set by the streamer, LOC: capture time since the Unix epoch
+	Duration   int64     `json:"duration,omitempty"`   // µs, audio only
+	AudioLevel *uint8    `json:"audioLevel,omitempty"` // LOC audio level in -dBov
+	Arrival    time.Time `json:"arrival"`
+	Error      string    `json:"error,omitempty"` // why the payload couldn't be decoded
+}
+
+// recorder writes the objects of the subscribed tracks to a media file per track and/or a shared object log
+type recorder struct {
+	files    []*os.File
+	tracks   map[string]catalog.Track // recorded tracks by name, their packaging & kind decode the payloads
+	media    map[string]mediaSink
+	log      *json.Encoder
+	logMutex sync.Mutex
+}
+
+// mediaSink writes the chunks of one track to a media file
+type mediaSink interface {
+	write(c *payload.Chunk) error
+	close() error
+}
+
+func newRecorder(dir string, channelName string, tracks []catalog.Track, writeMedia bool, writeLog bool) (*recorder, error) {
+	r := &recorder{tracks: map[string]catalog.Track{}, media: map[string]mediaSink{}}
+	for _, track := range tracks {
+		r.tracks[track.Name] = track
+	}
+	if writeLog {
+		file, err := r.create(filepath.Join(dir, channelName+".objects.jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		r.log = json.NewEncoder(file)
+	}
+	if !writeMedia {
+		return r, nil
+	}
+
+	for _, track := range tracks {
+		if !payload.Supported(track.Packaging) {
+			r.close()
+			return nil, fmt.Errorf("track %s: packaging %q can't be decoded, record it with -format log", track.Name, track.Packaging)
+		}
+		codec, _, _ := strings.Cut(track.SelectionParams.Codec, ".")
+		var sink mediaSink
+		var err error
+		switch codec {
+		case "vp8", "vp9", "vp09":
+			sink, err = r.newIVFSink(filepath.Join(dir, channelName+"-"+track.Name+".ivf"), codec, track.SelectionParams)
+		case "opus":
+			sink, err = r.newOggSink(filepath.Join(dir, channelName+"-"+track.Name+".ogg"), track.SelectionParams)
+		default:
+			err = fmt.Errorf("track %s: no media file format for codec %q, record it with -format log", track.Name, track.SelectionParams.Codec)
+		}
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		r.media[track.Name] = sink
+	}
+	return r, nil
+}
+
+func (r *recorder) create(path string) (*os.File, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r.files = append(r.files, file)
+	return file, nil
+}
+
+// read a track's objects until ctx is done
+func (r *recorder) record(ctx context.Context, name string, remote *moqtransport.RemoteTrack) {
+	for {
+		obj, err := remote.ReadObject(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("❌ error reading track %s: %s", name, err)
+			}
+			return
+		}
+		arrival := time.Now()
+		track := r.tracks[name]
+		if !payload.Supported(track.Packaging) {
+			r.writeLog(name, obj, nil, nil, arrival) // sizes & IDs only
+			continue
+		}
+		c, err := payload.DecodeObject(track.Packaging, track.Kind(), obj.Payload)
+		if err != nil {
+			log.Printf("❌ error decoding object %d/%d of track %s: %s", obj.GroupID, obj.ObjectID, name, err)
+		}
+		r.writeLog(name, obj, c, err, arrival)
+		if c == nil {
+			continue
+		}
+		if sink, ok := r.media[name]; ok {
+			if err := sink.write(c); err != nil {
+				log.Printf("❌ error writing object %d/%d of track %s: %s", obj.GroupID, obj.ObjectID, name, err)
+			}
+		}
+	}
+}
+
+func (r *recorder) writeLog(name string, obj moqtransport.Object, c *payload.Chunk, decodeErr error, arrival time.Time) {
+	if r.log == nil {
+		return
+	}
+	entry := objectLogEntry{Track: name, GroupID: obj.GroupID, ObjectID: obj.ObjectID, Size: len(obj.Payload), Forwarding: forwarding.Mode(obj.ForwardingPreference), Arrival: arrival}
+	if c != nil {
+		entry.Type = c.Kind()
+		entry.Key = c.IsKey()
+		entry.Timestamp = c.Timestamp.Microseconds()
+		entry.Duration = c.Duration.Microseconds()
+		if c.AudioLevel != nil {
+			entry.AudioLevel = &c.AudioLevel.Level
+		}
+	}
+	if decodeErr != nil {
+		entry.Error = decodeErr.Error()
+	}
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	if err := r.log.Encode(entry); err != nil {
+		log.Printf("❌ error writing object log: %s", err)
+	}
+}
+
+// finish the media files and close every file
+func (r *recorder) close() {
+	for name, sink := range r.media {
+		if err := sink.close(); err != nil {
+			log.Printf("❌ error finishing recording of track %s: %s", name, err)
+		}
+	}
+	for _, file := range r.files {
+		if err := file.Close(); err != nil {
+			log.Printf("❌ error closing %s: %s", file.Name(), err)
+		}
+	}
+}
+
+// ivfSink writes VP8/VP9 frames to an IVF file with a microsecond timebase, starting at the first key frame
+type ivfSink struct {
+	writer  *mediafile.IVFWriter
+	started bool
+	first   time.Duration // timestamp of the first written frame
+}
+
+func (r *recorder) newIVFSink(path string, codec string, params catalog.SelectionParams) (*ivfSink, error) {
+	file, err := r.create(path)
+	if err != nil {
+		return nil, err
+	}
+	fourCC := "VP80"
+	if codec != "vp8" {
+		fourCC = "VP90"
+	}
+	writer, err := mediafile.NewIVFWriter(file, mediafile.IVFHeader{
+		FourCC:      fourCC,
+		Width:       uint16(params.Width),
+		Height:      uint16(params.Height),
+		TimebaseDen: uint32(time.Second / time.Microsecond),
+		TimebaseNum: 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &ivfSink{writer: writer}, nil
+}
+
+func (s *ivfSink) write(c *payload.Chunk) error {
+	if !c.IsVideo() {
+		return fmt.Errorf("%s chunk on a video track", c.Kind())
+	}
+	if !s.started {
+		if c.IsDelta() {
+			return nil // a decodable file starts with a key frame
+		}
+		s.started = true
+		s.first = c.Timestamp
+	}
+	pts := c.Timestamp - s.first
+	if pts < 0 {
+		pts = 0
+	}
+	return s.writer.WriteFrame(uint64(pts.Microseconds()), c.Data)
+}
+
+func (s *ivfSink) close() error {
+	return s.writer.Close()
+}
+
+// oggSink writes Opus packets to an Ogg Opus file, granule positions follow the chunk durations
+type oggSink struct {
+	writer   *mediafile.OggWriter
+	recorded time.Duration
+}
+
+func (r *recorder) newOggSink(path string, params catalog.SelectionParams) (*oggSink, error) {
+	file, err := r.create(path)
+	if err != nil {
+		return nil, err
+	}
+	channels := 1
+	if params.ChannelConfig != "" {
+		if channels, err = strconv.Atoi(params.ChannelConfig); err != nil || channels < 1 || channels > 2 {
+			return nil, fmt.Errorf("channelConfig %q: only mono or stereo Opus can be recorded", params.ChannelConfig)
+		}
+	}
+	sampleRate := params.Samplerate
+	if sampleRate <= 0 {
+		sampleRate = 48000
+	}
+
+	writer := mediafile.NewOggWriter(file, rand.Uint32())
+	if err := writer.WritePacket(mediafile.OpusHeadPacket(uint8(channels), uint32(sampleRate)), 0); err != nil {
+		return nil, err
+	}
+	if err := writer.WritePacket(mediafile.OpusTagsPacket("moq-subscribe"), 0); err != nil {
+		return nil, err
+	}
+	return &oggSink{writer: writer}, nil
+}
+
+func (s *oggSink) write(c *payload.Chunk) error {
+	if !c.IsAudio() {
+		return fmt.Errorf("%s chunk on an audio track", c.Kind())
+	}
+	duration := c.Duration
+	if duration <= 0 {
+		var err error
+		if duration, err = mediafile.OpusPacketDuration(c.Data); err != nil {
+			return err
+		}
+	}
+	s.recorded += duration
+	return s.writer.WritePacket(c.Data, mediafile.OpusGranule(s.recorded))
+}
+
+func (s *oggSink) close() error {
+	return s.writer.Close()
+}
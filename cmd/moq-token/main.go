@@ -0,0 +1,79 @@
+// moq-token signs tokens for a moq-live-stream server started with a token secret, e.g. a stream token allowing to
+// publish the channel demo for a day, or a viewer token allowing to watch it if it is private:
+//
+//	MOQ_TOKEN_SECRET=... go run ./cmd/moq-token -channel demo -ttl 24h
+//	MOQ_TOKEN_SECRET=... go run ./cmd/moq-token -scope view -channel demo -ttl 2h
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"moqlivestream/server/auth"
+)
+
+// repeatable string flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	var channels listFlag
+	var secret, scope string
+	var ttl time.Duration
+	fs := flag.NewFlagSet("moq-token", flag.ContinueOnError)
+	fs.StringVar(&secret, "secret", "", "HMAC secret of the server, prefer the env var (env MOQ_TOKEN_SECRET)")
+	fs.StringVar(&scope, "scope", auth.ScopeStream, "what the token authorizes: \""+auth.ScopeStream+"\" publishes its channels, \""+auth.ScopeView+"\" watches them if private")
+	fs.Var(&channels, "channel", "channel name or pattern like \"lecture-*\" or \"school/**\" the token is valid for, repeatable (required)")
+	fs.DurationVar(&ttl, "ttl", 24*time.Hour, "time until the token expires")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+
+	token, err := sign(secret, scope, channels, ttl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(token)
+}
+
+func sign(secret string, scope string, channels []string, ttl time.Duration) (string, error) {
+	if secret == "" {
+		secret = os.Getenv("MOQ_TOKEN_SECRET")
+	}
+	if len(secret) < auth.MinSecretLength {
+		return "", fmt.Errorf("-secret must have at least %d bytes", auth.MinSecretLength)
+	}
+	if scope != auth.ScopeStream && scope != auth.ScopeView {
+		return "", fmt.Errorf("-scope %q: must be %s or %s", scope, auth.ScopeStream, auth.ScopeView)
+	}
+	if len(channels) == 0 {
+		return "", errors.New("at least one -channel is required")
+	}
+	if err := auth.CheckChannelPatterns(channels); err != nil {
+		return "", fmt.Errorf("-channel: %v", err)
+	}
+	if ttl <= 0 {
+		return "", fmt.Errorf("-ttl %v: must be positive", ttl)
+	}
+	return auth.Sign([]byte(secret), auth.Claims{
+		Scope:    scope,
+		Channels: channels,
+		Expiry:   time.Now().Add(ttl).Unix(),
+	})
+}
@@ -2,31 +2,50 @@ package audience
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/google/uuid"
 	"github.com/mengelbart/moqtransport"
 )
 
-// obsolete for now, since there isn't any complex meta linked to a Audience
+// namespace & name of a track
+type TrackKey struct {
+	Namespace string
+	TrackName string
+}
+
+// one accepted SUBSCRIBE of the audience
+type Subscription struct {
+	ID         uint64 // subscribe ID chosen by the audience
+	Namespace  string
+	TrackName  string
+	LocalTrack *moqtransport.LocalTrack // local track in the audience's session the subscription is served from
+}
+
+func (s *Subscription) Key() TrackKey {
+	return TrackKey{Namespace: s.Namespace, TrackName: s.TrackName}
+}
+
 type Audience struct {
-	ID         uuid.UUID // 128 bit hex string
-	Name       string
-	Session    *moqtransport.Session
-	LocalTrack *moqtransport.LocalTrack
-	Channel    string // channel name the audience is subscribed to
-	Mutex      sync.Mutex
+	ID            uuid.UUID // 128 bit hex string
+	Name          string
+	Session       *moqtransport.Session
+	Subscriptions map[uint64]*Subscription              // active subscriptions keyed by subscribe ID
+	LocalTracks   map[TrackKey]*moqtransport.LocalTrack // local tracks added to the session, kept after unsubscribing since moqtransport can't remove them
+	Mutex         sync.Mutex
 }
 
 // create a new Subscriber
 func NewAudience() *Audience {
 	id := uuid.New()
 	return &Audience{
-		ID:         id,
-		Name:       id.String(),
-		Session:    nil,
-		LocalTrack: nil,
-		Channel:    "",
+		ID:            id,
+		Name:          id.String(),
+		Session:       nil,
+		Subscriptions: map[uint64]*Subscription{},
+		LocalTracks:   map[TrackKey]*moqtransport.LocalTrack{},
 	}
 }
 
@@ -60,8 +79,8 @@ func (au *Audience) RemoveSession() error {
 	return nil
 }
 
-// set the LocalTrack for the Audience
-func (au *Audience) SetLocalTrack(localTrack *moqtransport.LocalTrack) error {
+// remember a LocalTrack added to the audience's session
+func (au *Audience) AddLocalTrack(localTrack *moqtransport.LocalTrack) error {
 	if au == nil {
 		return errors.New("audience is nil")
 	}
@@ -69,12 +88,28 @@ func (au *Audience) SetLocalTrack(localTrack *moqtransport.LocalTrack) error {
 	au.Mutex.Lock()
 	defer au.Mutex.Unlock()
 
-	au.LocalTrack = localTrack
+	key := TrackKey{Namespace: localTrack.Namespace, TrackName: localTrack.Name}
+	if _, ok := au.LocalTracks[key]; ok {
+		return fmt.Errorf("local track %s/%s already added", key.Namespace, key.TrackName)
+	}
+	au.LocalTracks[key] = localTrack
 	return nil
 }
 
-// set the Channel for the Audience
-func (au *Audience) SetChannel(channel string) error {
+// get the LocalTrack added to the audience's session for a track
+func (au *Audience) GetLocalTrack(namespace string, trackName string) (*moqtransport.LocalTrack, error) {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	localTrack, ok := au.LocalTracks[TrackKey{Namespace: namespace, TrackName: trackName}]
+	if !ok {
+		return nil, fmt.Errorf("no local track %s/%s", namespace, trackName)
+	}
+	return localTrack, nil
+}
+
+// add an accepted subscription, subscribe IDs and tracks must be unique among the active subscriptions
+func (au *Audience) AddSubscription(sub *Subscription) error {
 	if au == nil {
 		return errors.New("audience is nil")
 	}
@@ -82,6 +117,111 @@ func (au *Audience) SetChannel(channel string) error {
 	au.Mutex.Lock()
 	defer au.Mutex.Unlock()
 
-	au.Channel = channel
+	if _, ok := au.Subscriptions[sub.ID]; ok {
+		return fmt.Errorf("subscribe ID %d already in use", sub.ID)
+	}
+	for _, s := range au.Subscriptions {
+		if s.Key() == sub.Key() {
+			return fmt.Errorf("already subscribed to %s/%s with subscribe ID %d", sub.Namespace, sub.TrackName, s.ID)
+		}
+	}
+	au.Subscriptions[sub.ID] = sub
 	return nil
 }
+
+// remove and return the subscription with the subscribe ID
+func (au *Audience) RemoveSubscription(id uint64) (*Subscription, error) {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	sub, ok := au.Subscriptions[id]
+	if !ok {
+		return nil, fmt.Errorf("no subscription with subscribe ID %d", id)
+	}
+	delete(au.Subscriptions, id)
+	return sub, nil
+}
+
+// remove and return the subscription served from a local track
+func (au *Audience) RemoveSubscriptionByLocalTrack(localTrack *moqtransport.LocalTrack) (*Subscription, error) {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	for id, sub := range au.Subscriptions {
+		if sub.LocalTrack == localTrack {
+			delete(au.Subscriptions, id)
+			return sub, nil
+		}
+	}
+	return nil, fmt.Errorf("no subscription served from local track %s/%s", localTrack.Namespace, localTrack.Name)
+}
+
+// get the subscription with the subscribe ID
+func (au *Audience) GetSubscription(id uint64) (*Subscription, error) {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	sub, ok := au.Subscriptions[id]
+	if !ok {
+		return nil, fmt.Errorf("no subscription with subscribe ID %d", id)
+	}
+	return sub, nil
+}
+
+// get a copy of all active subscriptions, ordered by subscribe ID
+func (au *Audience) ListSubscriptions() []Subscription {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	subs := make([]Subscription, 0, len(au.Subscriptions))
+	for _, sub := range au.Subscriptions {
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+// get the active subscription to a track
+func (au *Audience) GetSubscriptionByTrack(namespace string, trackName string) (*Subscription, error) {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	for _, sub := range au.Subscriptions {
+		if sub.Namespace == namespace && sub.TrackName == trackName {
+			return sub, nil
+		}
+	}
+	return nil, fmt.Errorf("not subscribed to %s/%s", namespace, trackName)
+}
+
+// remove and return all subscriptions in a namespace
+func (au *Audience) RemoveSubscriptionsInNamespace(namespace string) []*Subscription {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	removed := []*Subscription{}
+	for id, sub := range au.Subscriptions {
+		if sub.Namespace == namespace {
+			removed = append(removed, sub)
+			delete(au.Subscriptions, id)
+		}
+	}
+	return removed
+}
+
+// names of the channels(namespaces) the audience has subscriptions in
+func (au *Audience) Channels() []string {
+	au.Mutex.Lock()
+	defer au.Mutex.Unlock()
+
+	seen := map[string]bool{}
+	channels := []string{}
+	for _, sub := range au.Subscriptions {
+		if sub.Namespace == "channels" || seen[sub.Namespace] {
+			continue
+		}
+		seen[sub.Namespace] = true
+		channels = append(channels, sub.Namespace)
+	}
+	return channels
+}
@@ -12,6 +12,7 @@ import (
 
 var log = utilities.NewCustomLogger()
 
+// AudienceManager holds the audiences of one server, an origin's or an edge's
 type AudienceManager struct {
 	Audiences []*audience.Audience
 	Mutex     sync.Mutex
@@ -22,20 +23,23 @@ var (
 	amOnce sync.Once
 )
 
+func NewAudienceManager() *AudienceManager {
+	return &AudienceManager{
+		Audiences: []*audience.Audience{},
+	}
+}
+
+// get the process wide AudienceManager, created on first use
 func InitAudienceManager() *AudienceManager {
 	amOnce.Do(func() {
-		am = &AudienceManager{
-			Audiences: []*audience.Audience{},
-		}
+		am = NewAudienceManager()
 		log.Println("🪵 AudienceManager initialized")
 	})
 	return am
 }
 
 // create a new Audience and add it to the AudienceManager's Audiences list
-func NewAudience() (*audience.Audience, error) {
-	am := InitAudienceManager()
-
+func (am *AudienceManager) NewAudience() (*audience.Audience, error) {
 	am.Mutex.Lock()
 	defer am.Mutex.Unlock()
 
@@ -45,9 +49,7 @@ func NewAudience() (*audience.Audience, error) {
 }
 
 // remove an Audience from the AudienceManager's Audiences list
-func RemoveAudience(id uuid.UUID) error {
-	am := InitAudienceManager()
-
+func (am *AudienceManager) RemoveAudience(id uuid.UUID) error {
 	am.Mutex.Lock()
 	defer am.Mutex.Unlock()
 
@@ -61,8 +63,9 @@ func RemoveAudience(id uuid.UUID) error {
 }
 
 // get a list of names of all Audiences in the AudienceManager
-func GetAudienceNames() []string {
-	am := InitAudienceManager()
+func (am *AudienceManager) GetAudienceNames() []string {
+	am.Mutex.Lock()
+	defer am.Mutex.Unlock()
 
 	audienceNames := make([]string, len(am.Audiences))
 	for i, a := range am.Audiences {
@@ -72,8 +75,9 @@ func GetAudienceNames() []string {
 }
 
 // get an Audience by ID from the AudienceManager
-func GetAudienceByID(id uuid.UUID) (*audience.Audience, error) {
-	am := InitAudienceManager()
+func (am *AudienceManager) GetAudienceByID(id uuid.UUID) (*audience.Audience, error) {
+	am.Mutex.Lock()
+	defer am.Mutex.Unlock()
 
 	for _, a := range am.Audiences {
 		if a.ID == id {
@@ -84,8 +88,9 @@ func GetAudienceByID(id uuid.UUID) (*audience.Audience, error) {
 }
 
 // get an Audience by name from the AudienceManager
-func GetAudienceByName(name string) (*audience.Audience, error) {
-	am := InitAudienceManager()
+func (am *AudienceManager) GetAudienceByName(name string) (*audience.Audience, error) {
+	am.Mutex.Lock()
+	defer am.Mutex.Unlock()
 
 	for _, a := range am.Audiences {
 		if a.Name == name {
@@ -96,9 +101,7 @@ func GetAudienceByName(name string) (*audience.Audience, error) {
 }
 
 // get an Audience by its session from the AudienceManager
-func GetAudienceBySession(session *moqtransport.Session) (*audience.Audience, error) {
-	am := InitAudienceManager()
-
+func (am *AudienceManager) GetAudienceBySession(session *moqtransport.Session) (*audience.Audience, error) {
 	am.Mutex.Lock()
 	defer am.Mutex.Unlock()
 
@@ -111,8 +114,9 @@ func GetAudienceBySession(session *moqtransport.Session) (*audience.Audience, er
 }
 
 // check if an Audience(ID) is unique in the AudienceManager
-func AudienceUnique(id uuid.UUID) bool {
-	am := InitAudienceManager()
+func (am *AudienceManager) AudienceUnique(id uuid.UUID) bool {
+	am.Mutex.Lock()
+	defer am.Mutex.Unlock()
 
 	for _, a := range am.Audiences {
 		if a.ID == id {
@@ -8,19 +8,48 @@ type Catalog struct {
 	StreamingFormatVersion string            `json:"streamingFormatVersion"`
 	CommonTrackFields      CommonTrackFields `json:"commonTrackFields"`
 	Tracks                 []Track           `json:"tracks"`
+	Metadata               *Metadata         `json:"metadata,omitempty"` // streamer-provided channel description, not part of the catalog spec
+}
+
+// describes the channel in the channel directory
+type Metadata struct {
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Visibility  string   `json:"visibility,omitempty"` // public if not set
+}
+
+// who can find and watch a channel
+const (
+	VisibilityPublic   = "public"   // listed in the channel directory, watchable by every audience
+	VisibilityUnlisted = "unlisted" // not listed, watchable by every audience knowing the channel name
+	VisibilityPrivate  = "private"  // not listed but to audiences with a viewer token for it, only watchable with one
+)
+
+// the channel's visibility set by the streamer, public by default
+func (c *Catalog) Visibility() string {
+	if c.Metadata == nil || c.Metadata.Visibility == "" {
+		return VisibilityPublic
+	}
+	return c.Metadata.Visibility
 }
 
 type CommonTrackFields struct {
 	Namespace   string `json:"namespace"`
 	Packaging   string `json:"packaging"`
 	RenderGroup int    `json:"renderGroup"`
+	Forwarding  string `json:"forwarding,omitempty"` // not part of the catalog spec, see Track.Forwarding
 }
 
 type Track struct {
 	Name            string          `json:"name"`
 	Label           string          `json:"label,omitempty"` // omitempty to handle cases where "label" might not be present
 	SelectionParams SelectionParams `json:"selectionParams"`
-	AltGroup        int             `json:"altGroup,omitempty"` // omitempty to handle cases where "altGroup" might not be present
+	AltGroup        int             `json:"altGroup,omitempty"`    // omitempty to handle cases where "altGroup" might not be present
+	Namespace       string          `json:"namespace,omitempty"`   // inherited from commonTrackFields by Normalize if not set
+	Packaging       string          `json:"packaging,omitempty"`   // inherited from commonTrackFields by Normalize if not set
+	RenderGroup     int             `json:"renderGroup,omitempty"` // inherited from commonTrackFields by Normalize if not set
+	Forwarding      string          `json:"forwarding,omitempty"`  // forwarding mode to audiences (track, group, object or datagram), not part of the catalog spec
 }
 
 type SelectionParams struct {
@@ -53,6 +82,16 @@ func ParseCatalog(catalogBytes []byte) (*Catalog, error) {
 	return &catalog, nil
 }
 
+// get a track of the catalog by its name, nil if the catalog has no such track
+func (c *Catalog) GetTrackByName(name string) *Track {
+	for i := range c.Tracks {
+		if c.Tracks[i].Name == name {
+			return &c.Tracks[i]
+		}
+	}
+	return nil
+}
+
 // serialize a Track struct into bytes
 func (t *Track) Serialize() ([]byte, error) {
 	trackBytes, err := json.Marshal(t)
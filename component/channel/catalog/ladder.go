@@ -0,0 +1,60 @@
+package catalog
+
+import "sort"
+
+// get the rendition ladder of a track: the tracks of the same kind sharing its altGroup, best first, i.e. ordered by
+// bitrate, then resolution, then name. Tracks with equal bitrate & resolution are one rung, switching between them gains
+// nothing: the rung is the track itself if it is one of them, else the first by name. A track without altGroup is its own
+// single rendition, nil if the catalog has no such track.
+func (c *Catalog) Ladder(trackName string) []Track {
+	track := c.GetTrackByName(trackName)
+	if track == nil {
+		return nil
+	}
+	if track.AltGroup == 0 {
+		return []Track{*track}
+	}
+
+	ladder := []Track{}
+	for _, t := range c.Tracks {
+		if t.AltGroup == track.AltGroup && t.Kind() == track.Kind() {
+			ladder = append(ladder, t)
+		}
+	}
+	sort.SliceStable(ladder, func(i, j int) bool {
+		a, b := ladder[i].SelectionParams, ladder[j].SelectionParams
+		if a.Bitrate != b.Bitrate {
+			return a.Bitrate > b.Bitrate
+		}
+		if a.Width*a.Height != b.Width*b.Height {
+			return a.Width*a.Height > b.Width*b.Height
+		}
+		return ladder[i].Name < ladder[j].Name
+	})
+
+	rungs := []Track{}
+	for _, t := range ladder {
+		last := len(rungs) - 1
+		if last < 0 || !sameRung(rungs[last], t) {
+			rungs = append(rungs, t)
+		} else if t.Name == trackName {
+			rungs[last] = t
+		}
+	}
+	return rungs
+}
+
+func sameRung(a, b Track) bool {
+	pa, pb := a.SelectionParams, b.SelectionParams
+	return pa.Bitrate == pb.Bitrate && pa.Width*pa.Height == pb.Width*pb.Height
+}
+
+// position of a track in a ladder, -1 if not in it
+func RenditionIndex(ladder []Track, trackName string) int {
+	for i, t := range ladder {
+		if t.Name == trackName {
+			return i
+		}
+	}
+	return -1
+}
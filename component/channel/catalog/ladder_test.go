@@ -0,0 +1,72 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func video(name string, altGroup, bitrate, width, height int) Track {
+	return Track{
+		Name:            name,
+		AltGroup:        altGroup,
+		SelectionParams: SelectionParams{Codec: "vp8", MimeType: "video/webm", Width: width, Height: height, Bitrate: bitrate},
+	}
+}
+
+func TestLadder(t *testing.T) {
+	cat := &Catalog{Tracks: []Track{
+		{Name: "audio", AltGroup: 1, SelectionParams: SelectionParams{Codec: "opus", MimeType: "audio/ogg", Bitrate: 32000}},
+		video("md", 1, 1_000_000, 1280, 720),
+		video("hd", 1, 3_000_000, 1920, 1080),
+		video("sd", 1, 1_000_000, 640, 360), // same bitrate as md, lower resolution
+		video("ld", 1, 300_000, 640, 360),
+		video("ld-copy", 1, 300_000, 640, 360), // same rung as ld
+		video("alt", 2, 2_000_000, 1920, 1080),
+		video("single", 0, 500_000, 640, 360),
+	}}
+
+	tests := []struct {
+		track string
+		want  []string
+	}{
+		{"hd", []string{"hd", "md", "sd", "ld"}},
+		{"sd", []string{"hd", "md", "sd", "ld"}},
+		{"ld", []string{"hd", "md", "sd", "ld"}},
+		{"ld-copy", []string{"hd", "md", "sd", "ld-copy"}}, // the rung is the track itself
+		{"alt", []string{"alt"}},
+		{"single", []string{"single"}}, // no altGroup
+		{"audio", []string{"audio"}},   // other kinds in the altGroup left out
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.track, func(t *testing.T) {
+			var got []string
+			for _, track := range cat.Ladder(tt.track) {
+				got = append(got, track.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ladder(%q) = %v, want %v", tt.track, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenditionIndex(t *testing.T) {
+	ladder := []Track{video("hd", 1, 3_000_000, 1920, 1080), video("md", 1, 1_000_000, 1280, 720)}
+	tests := []struct {
+		track string
+		want  int
+	}{
+		{"hd", 0},
+		{"md", 1},
+		{"ld", -1},
+	}
+	for _, tt := range tests {
+		if got := RenditionIndex(ladder, tt.track); got != tt.want {
+			t.Errorf("RenditionIndex(%q) = %d, want %d", tt.track, got, tt.want)
+		}
+	}
+	if got := RenditionIndex(nil, "hd"); got != -1 {
+		t.Errorf("RenditionIndex on an empty ladder = %d, want -1", got)
+	}
+}
@@ -0,0 +1,301 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// one operation of a JSON Patch (RFC 6902)
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// check whether a catalog object is a delta update, i.e. a JSON Patch array, rather than a full catalog
+func IsPatch(catalogBytes []byte) bool {
+	trimmed := bytes.TrimSpace(catalogBytes)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// apply a catalog object to the current catalog: a full catalog replaces it, a JSON Patch is applied to it.
+// The result is parsed & normalized but not validated.
+func ApplyUpdate(current *Catalog, update []byte) (*Catalog, error) {
+	if !IsPatch(update) {
+		next, err := ParseCatalog(update)
+		if err != nil {
+			return nil, err
+		}
+		next.Normalize()
+		return next, nil
+	}
+	if current == nil {
+		return nil, errors.New("delta update without a catalog to apply it to")
+	}
+
+	var patch []PatchOperation
+	if err := json.Unmarshal(update, &patch); err != nil {
+		return nil, fmt.Errorf("parsing JSON Patch: %w", err)
+	}
+	currentBytes, err := current.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(currentBytes, &doc); err != nil {
+		return nil, err
+	}
+	for i, op := range patch {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("JSON Patch operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	patchedBytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	next, err := ParseCatalog(patchedBytes)
+	if err != nil {
+		return nil, err
+	}
+	next.Normalize()
+	return next, nil
+}
+
+func (op PatchOperation) apply(doc interface{}) (interface{}, error) {
+	var value interface{}
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		if len(op.Value) == 0 {
+			return nil, errors.New("missing value")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return addValue(doc, op.Path, value)
+	case "remove":
+		doc, _, err := removeValue(doc, op.Path)
+		return doc, err
+	case "replace":
+		doc, _, err := removeValue(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, op.Path, value)
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("can't move a value into itself")
+		}
+		doc, moved, err := removeValue(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, op.Path, moved)
+	case "copy":
+		copied, err := getValue(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, op.Path, deepCopy(copied))
+	case "test":
+		actual, err := getValue(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(actual, value) {
+			return nil, errors.New("test failed")
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// split a JSON Pointer (RFC 6901) into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON Pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// index of an existing array element, or len(array) for "-" if allowEnd
+func arrayIndex(array []interface{}, token string, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return len(array), nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	limit := len(array)
+	if allowEnd {
+		limit++
+	}
+	if index >= limit {
+		return 0, fmt.Errorf("array index %d out of bounds", index)
+	}
+	return index, nil
+}
+
+func getValue(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", pointer)
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(node, token, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("path %q not found", pointer)
+		}
+	}
+	return doc, nil
+}
+
+// add a value at the pointer and return the (possibly new) document
+func addValue(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil // replaces the whole document
+	}
+	parent, err := getValue(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(node, last, true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+		return setValue(doc, tokens[:len(tokens)-1], node)
+	default:
+		return nil, fmt.Errorf("parent of path %q is not an object or array", pointer)
+	}
+}
+
+// remove the value at the pointer, returns the (possibly new) document and the removed value
+func removeValue(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("can't remove the whole document")
+	}
+	parent, err := getValue(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		removed, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %q not found", pointer)
+		}
+		delete(node, last)
+		return doc, removed, nil
+	case []interface{}:
+		index, err := arrayIndex(node, last, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		doc, err = setValue(doc, tokens[:len(tokens)-1], node)
+		return doc, removed, err
+	default:
+		return nil, nil, fmt.Errorf("parent of path %q is not an object or array", pointer)
+	}
+}
+
+// replace the value at the tokens, needed for arrays whose slice header changed
+func setValue(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := getValue(doc, pointerOf(tokens[:len(tokens)-1]))
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, err := arrayIndex(node, last, false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return doc, nil
+}
+
+func pointerOf(tokens []string) string {
+	pointer := ""
+	for _, token := range tokens {
+		pointer += "/" + strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+	}
+	return pointer
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,215 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"moqlivestream/component/forwarding"
+)
+
+// limits of sane selection params
+const (
+	maxBitrate    = 100_000_000 // 100 Mbps
+	maxDimension  = 8192        // pixels
+	maxFramerate  = 240
+	minSamplerate = 8000
+	maxSamplerate = 192000
+)
+
+// packaging formats a track can be sent in
+var packagings = map[string]bool{
+	"chunk": true, // the streamer-app's serializeEncodedChunk framing
+	"loc":   true,
+	"cmaf":  true,
+}
+
+// codecs by media kind, keyed by the codec string or its prefix before the first "."
+var codecKinds = map[string]string{
+	"vp8":  "video",
+	"vp9":  "video",
+	"vp09": "video",
+	"av1":  "video",
+	"av01": "video",
+	"avc1": "video",
+	"avc3": "video",
+	"hev1": "video",
+	"hvc1": "video",
+	"opus": "audio",
+	"mp4a": "audio",
+	"flac": "audio",
+}
+
+// codecs each container subtype of a mimeType can carry
+var containerCodecs = map[string][]string{
+	"webm": {"vp8", "vp9", "vp09", "av1", "av01", "opus"},
+	"mp4":  {"vp9", "vp09", "av1", "av01", "avc1", "avc3", "hev1", "hvc1", "opus", "mp4a", "flac"},
+}
+
+// apply the commonTrackFields to tracks that don't set them, and trim & lowercase names, codecs and mimeTypes
+func (c *Catalog) Normalize() {
+	c.CommonTrackFields.Namespace = strings.TrimSpace(c.CommonTrackFields.Namespace)
+	c.CommonTrackFields.Packaging = strings.ToLower(strings.TrimSpace(c.CommonTrackFields.Packaging))
+	c.CommonTrackFields.Forwarding = strings.ToLower(strings.TrimSpace(c.CommonTrackFields.Forwarding))
+
+	for i := range c.Tracks {
+		track := &c.Tracks[i]
+		track.Name = strings.TrimSpace(track.Name)
+		track.Namespace = strings.TrimSpace(track.Namespace)
+		track.Packaging = strings.ToLower(strings.TrimSpace(track.Packaging))
+		track.Forwarding = strings.ToLower(strings.TrimSpace(track.Forwarding))
+		track.SelectionParams.Codec = strings.ToLower(strings.TrimSpace(track.SelectionParams.Codec))
+		track.SelectionParams.MimeType = strings.ToLower(strings.TrimSpace(track.SelectionParams.MimeType))
+
+		if track.Namespace == "" {
+			track.Namespace = c.CommonTrackFields.Namespace
+		}
+		if track.Packaging == "" {
+			track.Packaging = c.CommonTrackFields.Packaging
+		}
+		if track.RenderGroup == 0 {
+			track.RenderGroup = c.CommonTrackFields.RenderGroup
+		}
+		if track.Forwarding == "" {
+			track.Forwarding = c.CommonTrackFields.Forwarding
+		}
+	}
+}
+
+// check the catalog after Normalize, returns every problem found
+func (c *Catalog) Validate() error {
+	var errs []error
+	if c.Version < 1 {
+		errs = append(errs, fmt.Errorf("version %d: must be at least 1", c.Version))
+	}
+	if len(c.Tracks) == 0 {
+		errs = append(errs, errors.New("tracks: catalog has no tracks"))
+	}
+	if c.CommonTrackFields.RenderGroup < 0 {
+		errs = append(errs, fmt.Errorf("commonTrackFields.renderGroup %d: must not be negative", c.CommonTrackFields.RenderGroup))
+	}
+	switch c.Visibility() {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+	default:
+		errs = append(errs, fmt.Errorf("metadata.visibility %q: must be %s, %s or %s", c.Metadata.Visibility, VisibilityPublic, VisibilityUnlisted, VisibilityPrivate))
+	}
+
+	names := map[string]bool{}
+	altGroups := map[int]*Track{} // first track of each altGroup
+	for i := range c.Tracks {
+		track := &c.Tracks[i]
+		if track.Name != "" {
+			if names[track.Name] {
+				errs = append(errs, fmt.Errorf("track %q: duplicate name", track.Name))
+			}
+			names[track.Name] = true
+		}
+		for _, err := range track.validate() {
+			errs = append(errs, fmt.Errorf("track %q: %w", track.Name, err))
+		}
+
+		if track.AltGroup == 0 {
+			continue
+		}
+		first, ok := altGroups[track.AltGroup]
+		if !ok {
+			altGroups[track.AltGroup] = track
+			continue
+		}
+		if track.Kind() != "" && first.Kind() != "" && track.Kind() != first.Kind() {
+			errs = append(errs, fmt.Errorf("track %q: %s track in altGroup %d of %s track %q", track.Name, track.Kind(), track.AltGroup, first.Kind(), first.Name))
+		}
+		if track.RenderGroup != first.RenderGroup {
+			errs = append(errs, fmt.Errorf("track %q: renderGroup %d differs from renderGroup %d of track %q in altGroup %d", track.Name, track.RenderGroup, first.RenderGroup, first.Name, track.AltGroup))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Track) validate() []error {
+	var errs []error
+	if t.Name == "" {
+		errs = append(errs, errors.New("name is empty"))
+	}
+	if t.Packaging != "" && !packagings[t.Packaging] {
+		errs = append(errs, fmt.Errorf("packaging %q: not supported", t.Packaging))
+	}
+	if t.RenderGroup < 0 {
+		errs = append(errs, fmt.Errorf("renderGroup %d: must not be negative", t.RenderGroup))
+	}
+	if err := forwarding.Check(t.Forwarding); err != nil {
+		errs = append(errs, err)
+	}
+	if t.AltGroup < 0 {
+		errs = append(errs, fmt.Errorf("altGroup %d: must not be negative", t.AltGroup))
+	}
+
+	params := t.SelectionParams
+	kind := t.Kind()
+	switch {
+	case params.Codec == "":
+		errs = append(errs, errors.New("codec is empty"))
+	case kind == "":
+		errs = append(errs, fmt.Errorf("codec %q: not supported", params.Codec))
+	}
+	if params.MimeType == "" {
+		errs = append(errs, errors.New("mimeType is empty"))
+	} else if kind != "" {
+		if err := checkMimeType(params.Codec, kind, params.MimeType); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if params.Bitrate <= 0 || params.Bitrate > maxBitrate {
+		errs = append(errs, fmt.Errorf("bitrate %d: must be within 1..%d", params.Bitrate, maxBitrate))
+	}
+
+	switch kind {
+	case "video":
+		if params.Width <= 0 || params.Width > maxDimension {
+			errs = append(errs, fmt.Errorf("width %d: must be within 1..%d", params.Width, maxDimension))
+		}
+		if params.Height <= 0 || params.Height > maxDimension {
+			errs = append(errs, fmt.Errorf("height %d: must be within 1..%d", params.Height, maxDimension))
+		}
+		if params.Framerate < 0 || params.Framerate > maxFramerate { // optional
+			errs = append(errs, fmt.Errorf("framerate %d: must be within 1..%d", params.Framerate, maxFramerate))
+		}
+		if params.Samplerate != 0 {
+			errs = append(errs, fmt.Errorf("samplerate %d: not allowed on a video track", params.Samplerate))
+		}
+	case "audio":
+		if params.Samplerate < minSamplerate || params.Samplerate > maxSamplerate {
+			errs = append(errs, fmt.Errorf("samplerate %d: must be within %d..%d", params.Samplerate, minSamplerate, maxSamplerate))
+		}
+		if params.Width != 0 || params.Height != 0 || params.Framerate != 0 {
+			errs = append(errs, errors.New("width, height & framerate: not allowed on an audio track"))
+		}
+	}
+	return errs
+}
+
+// media kind of the track derived from its codec: "video", "audio" or "" for an unknown codec
+func (t *Track) Kind() string {
+	codec, _, _ := strings.Cut(t.SelectionParams.Codec, ".")
+	return codecKinds[codec]
+}
+
+// check the mimeType is "<kind>/<container>" and the container can carry the codec
+func checkMimeType(codec string, kind string, mimeType string) error {
+	mimeKind, container, ok := strings.Cut(mimeType, "/")
+	if !ok || mimeKind != kind {
+		return fmt.Errorf("mimeType %q: %s codec %q needs mimeType %s/*", mimeType, kind, codec, kind)
+	}
+	container, _, _ = strings.Cut(container, ";") // drop parameters, e.g. codecs="..."
+	codecs, ok := containerCodecs[strings.TrimSpace(container)]
+	if !ok {
+		return fmt.Errorf("mimeType %q: container not supported", mimeType)
+	}
+	prefix, _, _ := strings.Cut(codec, ".")
+	for _, c := range codecs {
+		if c == prefix {
+			return nil
+		}
+	}
+	return fmt.Errorf("mimeType %q: can't carry codec %q", mimeType, codec)
+}
@@ -0,0 +1,196 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"moqlivestream/component/audience"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/metatrack"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// an audience's local track that was fed by a track the catalog dropped
+type DroppedFeed struct {
+	Audience   *audience.Audience
+	TrackName  string
+	LocalTrack *moqtransport.LocalTrack
+}
+
+// CatalogHandlers are called by FollowCatalog for each catalog version, any of them may be nil
+type CatalogHandlers struct {
+	Check      func(next *catalog.Catalog) error // rejects a valid version, the current catalog is kept
+	Dropped    func(dropped []DroppedFeed)       // with the feeds of the tracks the version removed
+	Visibility func(ch *Channel)                 // once the version changed the channel's visibility
+}
+
+// keep reading the streamer's catalogTrack after the first catalog. Each object is a new catalog version, either a full catalog
+// or a JSON Patch against the current one. Invalid, rejected or stale versions are skipped.
+func (ch *Channel) FollowCatalog(remote *moqtransport.RemoteTrack, handlers CatalogHandlers) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch.Mutex.Lock()
+	ch.catalogRemote = remote
+	ch.catalogCancel = cancel
+	ch.Mutex.Unlock()
+
+	go func() {
+		read, latest := false, uint64(0) // group of the last version read
+		for {
+			obj, err := remote.ReadObject(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("❌ error reading catalogTrack of channel %s: %s", ch.Name, err)
+				}
+				return
+			}
+			// each version is a group on its own stream and may overtake the previous one, which would roll the catalog back
+			if read && obj.GroupID <= latest {
+				log.Printf("⚠️ stale catalog version (group %d) of channel %s skipped, group %d already read", obj.GroupID, ch.Name, latest)
+				continue
+			}
+			read, latest = true, obj.GroupID
+			current := ch.GetCatalog()
+			next, err := catalog.ApplyUpdate(current, obj.Payload)
+			if err == nil {
+				err = next.Validate()
+			}
+			if err == nil && handlers.Check != nil {
+				err = handlers.Check(next)
+			}
+			if err != nil {
+				log.Printf("❌ catalog update (group %d, object %d) of channel %s rejected, keeping the current catalog: %s", obj.GroupID, obj.ObjectID, ch.Name, err)
+				continue
+			}
+
+			dropped := ch.UpdateCatalog(next)
+			log.Printf("📦 Channel %s catalog updated (group %d, object %d, delta: %v), %d feeds dropped", ch.Name, obj.GroupID, obj.ObjectID, catalog.IsPatch(obj.Payload), len(dropped))
+			if len(dropped) > 0 && handlers.Dropped != nil {
+				handlers.Dropped(dropped)
+			}
+			if current != nil && current.Visibility() != next.Visibility() && handlers.Visibility != nil {
+				log.Printf("👁️ Channel %s visibility changed from %s to %s", ch.Name, current.Visibility(), next.Visibility())
+				handlers.Visibility(ch)
+			}
+		}
+	}()
+}
+
+// stop following the streamer's catalogTrack and stop writing to the audiences' catalogTracks
+func (ch *Channel) StopCatalog() {
+	ch.Mutex.Lock()
+	remote, cancel := ch.catalogRemote, ch.catalogCancel
+	ch.catalogRemote, ch.catalogCancel = nil, nil
+	writers := ch.catalogWriters
+	ch.catalogWriters = map[*moqtransport.LocalTrack]*metatrack.Writer{}
+	ch.Mutex.Unlock()
+
+	for _, w := range writers {
+		w.Close()
+	}
+	if cancel != nil {
+		cancel()
+	}
+	if remote != nil {
+		remote.Unsubscribe()
+		go drainUpstream(remote)
+	}
+}
+
+// replace the catalog with a new version, push it to the audiences' catalogTracks and stop forwarding the tracks it dropped.
+// Tracks it added are subscribed on demand like any other track.
+func (ch *Channel) UpdateCatalog(c *catalog.Catalog) []DroppedFeed {
+	if ch == nil || c == nil {
+		return nil
+	}
+
+	ch.Mutex.Lock()
+	dropped := []DroppedFeed{}
+	stopped := []*upstreamTrack{}
+	for _, track := range ch.TracksAudiences {
+		if c.GetTrackByName(track.TrackName) != nil {
+			continue
+		}
+		for _, au := range append([]*audience.Audience{}, track.Audiences...) {
+			if queue, ok := track.SendQueues[au.ID]; ok {
+				dropped = append(dropped, DroppedFeed{Audience: au, TrackName: track.TrackName, LocalTrack: queue.LocalTrack()})
+			}
+			if err := ch.removeAudienceFromTrack(track.TrackName, au); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+	for name, u := range ch.Upstreams {
+		if c.GetTrackByName(name) != nil {
+			continue
+		}
+		if u.idleTimer != nil {
+			u.idleTimer.Stop()
+		}
+		delete(ch.Upstreams, name)
+		delete(ch.TrackCaches, name)
+		stopped = append(stopped, u)
+	}
+	ch.setCatalog(c)
+	ch.Mutex.Unlock()
+
+	for _, u := range stopped {
+		ch.stopUpstream(u)
+		log.Printf("🔽 upstream track %s/%s dropped from the catalog, unsubscribed", ch.Name, u.trackName)
+	}
+	ch.notifyChanged()
+	return dropped
+}
+
+// start writing the catalog versions to an audience's catalogTrack, beginning with the current one
+func (ch *Channel) AddCatalogSubscriber(local *moqtransport.LocalTrack) error {
+	if ch == nil {
+		return errors.New("channel is nil")
+	}
+
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	w, ok := ch.catalogWriters[local]
+	if !ok {
+		w = metatrack.NewWriter(local)
+		ch.catalogWriters[local] = w
+	}
+	if ch.Catalog == nil {
+		return nil // written once received
+	}
+	payload, err := ch.Catalog.Serialize()
+	if err != nil {
+		return err
+	}
+	w.Write(ch.CatalogVersion, payload)
+	return nil
+}
+
+// stop writing catalog versions to an audience's catalogTrack
+func (ch *Channel) RemoveCatalogSubscriber(local *moqtransport.LocalTrack) {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	if w, ok := ch.catalogWriters[local]; ok {
+		delete(ch.catalogWriters, local)
+		w.Close()
+	}
+}
+
+// set the catalog as the next version and write it to the audiences' catalogTracks.
+// Caller must hold ch.Mutex.
+func (ch *Channel) setCatalog(c *catalog.Catalog) {
+	if ch.Catalog != nil {
+		ch.CatalogVersion++
+	}
+	ch.Catalog = c
+
+	payload, err := c.Serialize()
+	if err != nil {
+		log.Printf("❌ error serializing catalog: %s", err)
+		return
+	}
+	for _, w := range ch.catalogWriters {
+		w.Write(ch.CatalogVersion, payload)
+	}
+}
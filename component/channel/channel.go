@@ -1,12 +1,18 @@
 package channel
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"moqlivestream/component/audience"
 	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/channel/groupcache"
+	"moqlivestream/component/channel/sendqueue"
+	"moqlivestream/component/forwarding"
+	"moqlivestream/component/metatrack"
 	"moqlivestream/utilities"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mengelbart/moqtransport"
@@ -14,9 +20,52 @@ import (
 
 var log = utilities.NewCustomLogger()
 
+// send queue config applied to channels created afterwards
+var sendQueueConfig = sendqueue.DefaultConfig()
+
+// set the send queue capacity & overflow policy for new channels
+func SetSendQueueConfig(config sendqueue.Config) {
+	sendQueueConfig = config
+}
+
+// forwarding modes per media kind applied to channels created afterwards
+var forwardingConfig = forwarding.Config{}
+
+// set the forwarding modes overriding the catalog's for new channels
+func SetForwardingConfig(config forwarding.Config) {
+	forwardingConfig = config
+}
+
+// number of most recent groups cached per track, applied to track caches created afterwards
+var groupCacheSize = groupcache.DefaultMaxGroups
+
+func SetGroupCacheSize(maxGroups int) {
+	groupCacheSize = maxGroups
+}
+
+// set the handler notified whenever the channel's directory entry may have changed: status, catalog or audiences on its tracks.
+// Set once before the channel is shared, e.g. by the channel manager to republish its channel directory.
+func (ch *Channel) SetChangeHandler(handler func(ch *Channel)) {
+	ch.changeHandler = handler
+}
+
+// notify the change handler without blocking, safe to call while holding ch.Mutex
+func (ch *Channel) notifyChanged() {
+	if ch.changeHandler != nil {
+		go ch.changeHandler(ch)
+	}
+}
+
+// objects & payload bytes forwarded on a track, counted once per object regardless of its number of audiences
+type ForwardStats struct {
+	Objects uint64
+	Bytes   uint64
+}
+
 type TrackAudiences struct {
-	TrackName string
-	Audiences []*audience.Audience
+	TrackName  string
+	Audiences  []*audience.Audience
+	SendQueues map[uuid.UUID]*sendqueue.SendQueue // per-audience send queue, keyed by audience ID
 }
 
 func NewTracksAudiences() []*TrackAudiences {
@@ -24,29 +73,45 @@ func NewTracksAudiences() []*TrackAudiences {
 }
 
 type Channel struct {
-	ID              uuid.UUID
-	Name            string
-	Status          bool
-	Session         *moqtransport.Session
-	Catalog         *catalog.Catalog
-	Audiences       []*audience.Audience // list of Audience connected to the channel
-	TracksAudiences []*TrackAudiences    // list of Audience subscribed to a specific track
-	AudienceCh      chan *TrackAudiences // pass TrackAudiences changes
-	Mutex           sync.Mutex
+	ID               uuid.UUID
+	Name             string
+	Status           bool
+	StartTime        time.Time             // when the streamer ANNOUNCEd the channel, zero until then
+	Session          *moqtransport.Session // the streamer's session, nil on an edge
+	Source           TrackSource           // where catalogTrack & media tracks are subscribed from: the streamer or the upstream origin
+	Catalog          *catalog.Catalog
+	Audiences        []*audience.Audience              // list of Audience connected to the channel
+	TracksAudiences  []*TrackAudiences                 // list of Audience subscribed to a specific track
+	TrackCaches      map[string]*groupcache.GroupCache // most recent groups of each media track, replayed to late-joining audiences
+	SendQueueConfig  sendqueue.Config                  // capacity & overflow policy of the audiences' send queues
+	ForwardingConfig forwarding.Config                 // forwarding modes per media kind, overriding the catalog's
+	Upstreams        map[string]*upstreamTrack         // tracks subscribed from the streamer, only while audiences watch them
+	CatalogVersion   uint64                            // incremented with every catalog update, the group ID on the audiences' catalogTracks
+	forwardStats     map[string]ForwardStats           // by track name
+	catalogRemote    *moqtransport.RemoteTrack         // the streamer's catalogTrack, followed for updates
+	catalogCancel    context.CancelFunc
+	catalogWriters   map[*moqtransport.LocalTrack]*metatrack.Writer // the audiences' catalogTracks
+	changeHandler    func(ch *Channel)
+	Mutex            sync.Mutex
 }
 
 func NewChannel() *Channel {
 	id := uuid.New()
 	return &Channel{
-		ID:              id,
-		Name:            id.String(),
-		Status:          false,
-		Session:         nil, // empty on init, updated when session established
-		Catalog:         nil, // empty on init, updated when catalog is received
-		Audiences:       []*audience.Audience{},
-		TracksAudiences: NewTracksAudiences(),
-		AudienceCh:      make(chan *TrackAudiences),
-		Mutex:           sync.Mutex{},
+		ID:               id,
+		Name:             id.String(),
+		Status:           false,
+		Session:          nil, // empty on init, updated when session established
+		Catalog:          nil, // empty on init, updated when catalog is received
+		Audiences:        []*audience.Audience{},
+		TracksAudiences:  NewTracksAudiences(),
+		TrackCaches:      map[string]*groupcache.GroupCache{},
+		Upstreams:        map[string]*upstreamTrack{},
+		forwardStats:     map[string]ForwardStats{},
+		catalogWriters:   map[*moqtransport.LocalTrack]*metatrack.Writer{},
+		SendQueueConfig:  sendQueueConfig,
+		ForwardingConfig: forwardingConfig,
+		Mutex:            sync.Mutex{},
 	}
 }
 
@@ -59,19 +124,63 @@ func (ch *Channel) SetSession(session *moqtransport.Session) error {
 		return errors.New("channel is nil")
 	}
 
+	ch.Mutex.Lock()
 	ch.Session = session
+	ch.Source = NewSessionSource(session)
 	ch.Status = true
+	ch.Mutex.Unlock()
+	ch.notifyChanged()
 	return nil
 }
 
+// set where the channel's tracks are subscribed from without a streamer session, e.g. the upstream origin of an edge
+func (ch *Channel) SetSource(source TrackSource) error {
+	if source == nil {
+		return errors.New("source is nil")
+	}
+	if ch == nil {
+		return errors.New("channel is nil")
+	}
+
+	ch.Mutex.Lock()
+	ch.Source = source
+	ch.Mutex.Unlock()
+	ch.notifyChanged()
+	return nil
+}
+
+// set whether the channel is live, for channels whose status is not tied to a streamer session, e.g. mirrored from the origin
+func (ch *Channel) SetStatus(live bool) {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	if ch.Status == live {
+		return
+	}
+	ch.Status = live
+	ch.notifyChanged()
+}
+
+// whether the channel is live
+func (ch *Channel) Live() bool {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	return ch.Status
+}
+
 // remove channel session
 func (ch *Channel) RemoveSession() error {
 	if ch == nil {
 		return errors.New("channel is nil")
 	}
 
+	ch.Mutex.Lock()
 	ch.Session = nil
+	ch.Source = nil
 	ch.Status = false
+	ch.Mutex.Unlock()
+	ch.notifyChanged()
 	return nil
 }
 
@@ -84,7 +193,11 @@ func (ch *Channel) SetCatalog(catalog *catalog.Catalog) error {
 		return errors.New("channel is nil")
 	}
 
-	ch.Catalog = catalog
+	ch.Mutex.Lock()
+	ch.setCatalog(catalog)
+	ch.Mutex.Unlock()
+
+	ch.notifyChanged()
 	return nil
 }
 
@@ -94,7 +207,11 @@ func (ch *Channel) RemoveCatalog() error {
 		return errors.New("channel is nil")
 	}
 
+	ch.Mutex.Lock()
 	ch.Catalog = nil
+	ch.Mutex.Unlock()
+
+	ch.notifyChanged()
 	return nil
 }
 
@@ -139,32 +256,27 @@ func (ch *Channel) GetAudienceBySession(session *moqtransport.Session) (*audienc
 	return nil, errors.New("audience not found")
 }
 
-// add a Subscriber to the Channel's TrackAudiences list by trackName
-func (ch *Channel) AddAudienceToTrack(trackName string, au *audience.Audience) error {
+// add a Subscriber to the Channel's TrackAudiences list by trackName, objects of the track are written to the given local track of the audience's session
+func (ch *Channel) AddAudienceToTrack(trackName string, au *audience.Audience, localTrack *moqtransport.LocalTrack) error {
 	if len(au.ID.String()) != 36 { // 32 for uuid, 36 for uuid with hyphen
 		return errors.New("audience ID not valid")
 	}
 	if ch == nil {
 		return errors.New("channel is nil")
 	}
+	if localTrack == nil {
+		return errors.New("local track is nil")
+	}
 
 	ch.Mutex.Lock()
 	defer ch.Mutex.Unlock()
 
-	//! fallback method to remove audience from previous subscribed track. MOQT should remove audience's localTrack from its session?
-	// remove audience from all other track(s) (should be only one track if exists) if subscribed previously
-	if len(ch.TracksAudiences) != 0 {
-		for _, track := range ch.TracksAudiences {
-			if trackName != track.TrackName && track.TrackName != "audio" { // filter out audio track
-				err := ch.RemoveAudienceFromTrack(track.TrackName, au)
-				if err != nil {
-					log.Print(err)
-				}
-			}
-		}
-	}
+	return ch.addAudienceToTrack(trackName, au, localTrack)
+}
 
-	trackExist := false
+// caller must hold ch.Mutex
+func (ch *Channel) addAudienceToTrack(trackName string, au *audience.Audience, localTrack *moqtransport.LocalTrack) error {
+	var trackAudiences *TrackAudiences
 	for _, track := range ch.TracksAudiences {
 		if trackName == track.TrackName {
 			for _, aud := range track.Audiences {
@@ -172,42 +284,121 @@ func (ch *Channel) AddAudienceToTrack(trackName string, au *audience.Audience) e
 					return errors.New("audience already subscribed to the track")
 				}
 			}
-			track.Audiences = append(track.Audiences, au)
-			log.Printf("audience(%s) added to track %s", au.ID, trackName)
-			ch.AudienceCh <- track
-			trackExist = true
-			return nil
+			trackAudiences = track
+			break
 		}
 	}
 	// if track not exist, create a new track with the first audience on it
-	if !trackExist {
-		trackAudiences := &TrackAudiences{
-			TrackName: trackName,
-			Audiences: []*audience.Audience{au},
+	if trackAudiences == nil {
+		trackAudiences = &TrackAudiences{
+			TrackName:  trackName,
+			Audiences:  []*audience.Audience{},
+			SendQueues: map[uuid.UUID]*sendqueue.SendQueue{},
 		}
 		ch.TracksAudiences = append(ch.TracksAudiences, trackAudiences)
-		log.Printf("audience(%s) added to track %s", au.ID, trackName)
-		ch.AudienceCh <- trackAudiences
 	}
 
+	queue := sendqueue.NewSendQueue(fmt.Sprintf("%s/%s/%s", ch.Name, trackName, au.ID), localTrack, ch.SendQueueConfig, func() {
+		ch.disconnectAudience(au)
+	})
+	ch.replayCurrentGroup(trackName, queue)
+	trackAudiences.Audiences = append(trackAudiences.Audiences, au)
+	trackAudiences.SendQueues[au.ID] = queue
+	ch.acquireUpstream(trackName)
+	ch.notifyChanged()
+	log.Printf("audience(%s) added to track %s", au.ID, trackName)
+
 	return nil
 }
 
+// move an audience from one track to another, e.g. to a lower rendition. The audience keeps receiving on the same local track,
+// starting with the cached current group of the new track.
+func (ch *Channel) SwitchAudienceTrack(au *audience.Audience, fromTrack string, toTrack string) error {
+	if ch == nil {
+		return errors.New("channel is nil")
+	}
+	if fromTrack == toTrack {
+		return fmt.Errorf("audience(%s) already on track %s", au.ID, toTrack)
+	}
+
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	var localTrack *moqtransport.LocalTrack
+	for _, track := range ch.TracksAudiences {
+		if track.TrackName == fromTrack {
+			if queue, ok := track.SendQueues[au.ID]; ok {
+				localTrack = queue.LocalTrack()
+			}
+			break
+		}
+	}
+	if localTrack == nil {
+		return fmt.Errorf("audience(%s) not subscribed to the track %s", au.ID, fromTrack)
+	}
+
+	if err := ch.removeAudienceFromTrack(fromTrack, au); err != nil {
+		return err
+	}
+	if err := ch.addAudienceToTrack(toTrack, au, localTrack); err != nil {
+		// fall back to the previous track rather than leaving the subscription without a source
+		if restoreErr := ch.addAudienceToTrack(fromTrack, au, localTrack); restoreErr != nil {
+			log.Printf("❌ error restoring audience(%s) to track %s: %s", au.ID, fromTrack, restoreErr)
+		}
+		return err
+	}
+	log.Printf("🔀 audience(%s) switched from track %s to %s", au.ID, fromTrack, toTrack)
+	return nil
+}
+
+// remove the audience from the track that feeds the given local track, returns the name of that track
+func (ch *Channel) RemoveAudienceLocalTrack(au *audience.Audience, localTrack *moqtransport.LocalTrack) (string, error) {
+	if ch == nil {
+		return "", errors.New("channel is nil")
+	}
+
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	for _, track := range ch.TracksAudiences {
+		if queue, ok := track.SendQueues[au.ID]; ok && queue.LocalTrack() == localTrack {
+			return track.TrackName, ch.removeAudienceFromTrack(track.TrackName, au)
+		}
+	}
+	return "", fmt.Errorf("no track of channel %s feeds local track %s/%s of audience(%s)", ch.Name, localTrack.Namespace, localTrack.Name, au.ID)
+}
+
 // remove a Subscriber from the track of the Channel's TrackAudiences list
 func (ch *Channel) RemoveAudienceFromTrack(trackName string, au *audience.Audience) error {
-	if len(au.ID.String()) != 36 { // 32 for uuid, 36 for uuid with hyphen
-		return errors.New("audience ID not valid")
-	}
 	if ch == nil {
 		return errors.New("channel is nil")
 	}
 
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	return ch.removeAudienceFromTrack(trackName, au)
+}
+
+// caller must hold ch.Mutex
+func (ch *Channel) removeAudienceFromTrack(trackName string, au *audience.Audience) error {
+	if len(au.ID.String()) != 36 { // 32 for uuid, 36 for uuid with hyphen
+		return errors.New("audience ID not valid")
+	}
+
 	for _, track := range ch.TracksAudiences {
 		if trackName == track.TrackName {
 			for i, aud := range track.Audiences {
 				if aud.ID == au.ID {
 					track.Audiences = append(track.Audiences[:i], track.Audiences[i+1:]...)
-					ch.AudienceCh <- track
+					if queue, ok := track.SendQueues[au.ID]; ok {
+						queue.Close()
+						delete(track.SendQueues, au.ID)
+					}
+					if len(track.Audiences) == 0 {
+						ch.releaseUpstream(trackName)
+					}
+					ch.notifyChanged()
 					log.Printf("audience(%s) removed from track %s", au.ID, trackName)
 					return nil
 				}
@@ -219,7 +410,174 @@ func (ch *Channel) RemoveAudienceFromTrack(trackName string, au *audience.Audien
 	return fmt.Errorf("track %s not found", trackName)
 }
 
-// get the track name the audience is subscribed to
+// remove an audience from every track it is subscribed to, returns the names of those tracks
+func (ch *Channel) RemoveAudienceFromAllTracks(au *audience.Audience) []string {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	removed := []string{}
+	for _, track := range ch.TracksAudiences {
+		for _, aud := range track.Audiences {
+			if aud.ID == au.ID {
+				if err := ch.removeAudienceFromTrack(track.TrackName, au); err != nil {
+					log.Print(err)
+				} else {
+					removed = append(removed, track.TrackName)
+				}
+				break
+			}
+		}
+	}
+	return removed
+}
+
+// get the group cache of a track, created on first use
+func (ch *Channel) GetTrackCache(trackName string) *groupcache.GroupCache {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	return ch.getTrackCache(trackName)
+}
+
+// caller must hold ch.Mutex
+func (ch *Channel) getTrackCache(trackName string) *groupcache.GroupCache {
+	cache, ok := ch.TrackCaches[trackName]
+	if !ok {
+		cache = groupcache.NewGroupCache(trackName, groupCacheSize)
+		ch.TrackCaches[trackName] = cache
+	}
+	return cache
+}
+
+// cache an object read from the streamer's track and enqueue it for every audience subscribed to that track, in the track's
+// forwarding mode. Pushing never blocks, the network writes happen in each audience's send queue.
+func (ch *Channel) ForwardObject(trackName string, obj moqtransport.Object) {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	obj = forwarding.Apply(obj, ch.forwardingMode(trackName))
+	ch.getTrackCache(trackName).AddObject(obj)
+	stats := ch.forwardStats[trackName]
+	stats.Objects++
+	stats.Bytes += uint64(len(obj.Payload))
+	ch.forwardStats[trackName] = stats
+	for _, track := range ch.TracksAudiences {
+		if track.TrackName == trackName {
+			for _, queue := range track.SendQueues {
+				queue.Push(obj)
+			}
+		}
+	}
+}
+
+// mode the track's objects are forwarded to audiences in: the server config's for its kind, else the catalog's,
+// "" keeps the mode they arrive in. Caller must hold ch.Mutex
+func (ch *Channel) forwardingMode(trackName string) string {
+	if ch.Catalog == nil {
+		return ""
+	}
+	track := ch.Catalog.GetTrackByName(trackName)
+	if track == nil {
+		return ""
+	}
+	return ch.ForwardingConfig.Resolve(track.Kind(), track.Forwarding)
+}
+
+// enqueue the cached objects of the track's current group (from object 0) for a newly joined audience, so its decoder starts at a key frame.
+// Caller must hold ch.Mutex: objects forwarded after the replay are pushed by ForwardObject, which holds the same lock, so none is lost or duplicated.
+func (ch *Channel) replayCurrentGroup(trackName string, queue *sendqueue.SendQueue) {
+	objects := ch.getTrackCache(trackName).CurrentGroup()
+	for _, obj := range objects {
+		queue.Push(obj)
+	}
+	if len(objects) > 0 {
+		log.Printf("📦 Replayed %d cached objects of group %d on track %s to %s", len(objects), objects[0].GroupID, trackName, queue.Name)
+	}
+}
+
+// remove an audience whose send queue overflowed under the Disconnect policy from all tracks and close its session
+func (ch *Channel) disconnectAudience(au *audience.Audience) {
+	ch.Mutex.Lock()
+	for _, track := range ch.TracksAudiences {
+		if _, ok := track.SendQueues[au.ID]; ok {
+			if err := ch.removeAudienceFromTrack(track.TrackName, au); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+	ch.Mutex.Unlock()
+
+	if au.Session != nil {
+		if err := au.Session.CloseWithError(moqtransport.ErrorCodeInternal, "send queue overflow"); err != nil {
+			log.Printf("❌ error closing session of audience(%s): %s", au.ID, err)
+		}
+	}
+}
+
+// get the send queue statistics of every audience on every track: map[trackName]map[audienceID]Stats
+func (ch *Channel) SendQueueStats() map[string]map[uuid.UUID]sendqueue.Stats {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	stats := map[string]map[uuid.UUID]sendqueue.Stats{}
+	for _, track := range ch.TracksAudiences {
+		stats[track.TrackName] = map[uuid.UUID]sendqueue.Stats{}
+		for id, queue := range track.SendQueues {
+			stats[track.TrackName][id] = queue.Stats()
+		}
+	}
+	return stats
+}
+
+// get the objects & bytes forwarded on each track since the channel was created
+func (ch *Channel) ForwardStats() map[string]ForwardStats {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	stats := make(map[string]ForwardStats, len(ch.forwardStats))
+	for track, s := range ch.forwardStats {
+		stats[track] = s
+	}
+	return stats
+}
+
+// get the number of audiences on each track with audiences, and the number of distinct audiences watching the channel
+func (ch *Channel) Viewers() (map[string]int, int) {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	trackViewers := map[string]int{}
+	audiences := map[uuid.UUID]bool{}
+	for _, track := range ch.TracksAudiences {
+		if len(track.Audiences) == 0 {
+			continue
+		}
+		trackViewers[track.TrackName] = len(track.Audiences)
+		for _, aud := range track.Audiences {
+			audiences[aud.ID] = true
+		}
+	}
+	return trackViewers, len(audiences)
+}
+
+// get the catalog received from the streamer, nil until received
+func (ch *Channel) GetCatalog() *catalog.Catalog {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	return ch.Catalog
+}
+
+// get the visibility set in the channel's catalog, private until the catalog is received
+func (ch *Channel) Visibility() string {
+	c := ch.GetCatalog()
+	if c == nil {
+		return catalog.VisibilityPrivate
+	}
+	return c.Visibility()
+}
+
+// get the video track name the audience is subscribed to, by the kind of the tracks in the catalog
 func (ch *Channel) GetTrackNameByAudience(au *audience.Audience) (string, error) {
 	if len(au.ID.String()) != 36 { // 32 for uuid, 36 for uuid with hyphen
 		return "", errors.New("audience ID not valid")
@@ -227,9 +585,14 @@ func (ch *Channel) GetTrackNameByAudience(au *audience.Audience) (string, error)
 	if ch == nil {
 		return "", errors.New("channel is nil")
 	}
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+	if ch.Catalog == nil {
+		return "", errors.New("channel has no catalog")
+	}
 
 	for _, track := range ch.TracksAudiences {
-		if track.TrackName == "audio" { // filter out audio track
+		if t := ch.Catalog.GetTrackByName(track.TrackName); t == nil || t.Kind() != "video" { // filter out audio & catalog tracks
 			continue
 		}
 		for _, aud := range track.Audiences {
@@ -0,0 +1,135 @@
+package groupcache
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+const (
+	DefaultMaxGroups          = 2    // number of most recent groups kept per track
+	DefaultMaxObjectsPerGroup = 1024 // upper bound of objects cached per group, protects against streams without key frames
+)
+
+// Group holds the cached objects of one group, sorted by ObjectID
+type Group struct {
+	GroupID   uint64
+	Objects   []moqtransport.Object
+	Bytes     int
+	Truncated bool // set once the group exceeded MaxObjectsPerGroup, such a group is never replayed
+}
+
+// check if the group is cached from its first object (ObjectID 0), i.e. it starts with a key frame
+func (g *Group) Complete() bool {
+	return len(g.Objects) > 0 && g.Objects[0].ObjectID == 0 && !g.Truncated
+}
+
+// GroupCache is a bounded cache of the most recent groups of a single track
+type GroupCache struct {
+	TrackName          string
+	MaxGroups          int
+	MaxObjectsPerGroup int
+	groups             []*Group // ordered by GroupID, oldest first
+	mutex              sync.Mutex
+}
+
+func NewGroupCache(trackName string, maxGroups int) *GroupCache {
+	if maxGroups <= 0 {
+		maxGroups = DefaultMaxGroups
+	}
+	return &GroupCache{
+		TrackName:          trackName,
+		MaxGroups:          maxGroups,
+		MaxObjectsPerGroup: DefaultMaxObjectsPerGroup,
+		groups:             []*Group{},
+	}
+}
+
+// add an object to the cache, a newer GroupID starts a new group and evicts the oldest group(s) if the cache is full
+func (gc *GroupCache) AddObject(obj moqtransport.Object) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	group := gc.getGroup(obj.GroupID)
+	if group == nil {
+		if len(gc.groups) >= gc.MaxGroups && obj.GroupID < gc.groups[0].GroupID {
+			return // older than anything cached, not worth keeping
+		}
+		group = &Group{GroupID: obj.GroupID, Objects: []moqtransport.Object{}}
+		i := sort.Search(len(gc.groups), func(i int) bool { return gc.groups[i].GroupID > obj.GroupID })
+		gc.groups = append(gc.groups, nil)
+		copy(gc.groups[i+1:], gc.groups[i:])
+		gc.groups[i] = group
+		for len(gc.groups) > gc.MaxGroups {
+			gc.groups = gc.groups[1:]
+		}
+	}
+
+	if group.Truncated {
+		return
+	}
+	if len(group.Objects) >= gc.MaxObjectsPerGroup {
+		group.Truncated = true
+		group.Objects = nil
+		group.Bytes = 0
+		return
+	}
+
+	// objects may arrive out of order when each object is sent on its own stream
+	i := sort.Search(len(group.Objects), func(i int) bool { return group.Objects[i].ObjectID >= obj.ObjectID })
+	if i < len(group.Objects) && group.Objects[i].ObjectID == obj.ObjectID {
+		return // duplicate
+	}
+	group.Objects = append(group.Objects, moqtransport.Object{})
+	copy(group.Objects[i+1:], group.Objects[i:])
+	group.Objects[i] = obj
+	group.Bytes += len(obj.Payload)
+}
+
+// get the objects of the latest group starting at object 0, nil if the latest group was not cached from its start
+func (gc *GroupCache) CurrentGroup() []moqtransport.Object {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if len(gc.groups) == 0 {
+		return nil
+	}
+	latest := gc.groups[len(gc.groups)-1]
+	if !latest.Complete() {
+		return nil
+	}
+	objects := make([]moqtransport.Object, len(latest.Objects))
+	copy(objects, latest.Objects)
+	return objects
+}
+
+// get a copy of all cached groups, oldest first
+func (gc *GroupCache) Groups() []Group {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	groups := make([]Group, len(gc.groups))
+	for i, g := range gc.groups {
+		groups[i] = Group{GroupID: g.GroupID, Bytes: g.Bytes, Truncated: g.Truncated}
+		groups[i].Objects = append([]moqtransport.Object(nil), g.Objects...)
+	}
+	return groups
+}
+
+// drop all cached groups
+func (gc *GroupCache) Clear() {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	gc.groups = []*Group{}
+}
+
+func (gc *GroupCache) getGroup(groupID uint64) *Group {
+	for _, g := range gc.groups {
+		if g.GroupID == groupID {
+			return g
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package sendqueue
+
+import (
+	"context"
+	"fmt"
+	"moqlivestream/utilities"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+var log = utilities.NewCustomLogger()
+
+// OverflowPolicy decides what a SendQueue does when an object arrives while the queue is full
+type OverflowPolicy int
+
+const (
+	DropOldestGroup   OverflowPolicy = iota // drop every queued object of the oldest group, and the rest of that group
+	DropUntilKeyFrame                       // drop everything queued and incoming until the next group starts (object 0 = key frame)
+	Disconnect                              // give up on the audience and close its session
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropOldestGroup:
+		return "drop-oldest-group"
+	case DropUntilKeyFrame:
+		return "drop-until-key-frame"
+	case Disconnect:
+		return "disconnect"
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// parse an OverflowPolicy from its String() form
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{DropOldestGroup, DropUntilKeyFrame, Disconnect} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q", s)
+}
+
+type Config struct {
+	Capacity int // max number of objects queued per audience subscription
+	Policy   OverflowPolicy
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Capacity: 256,
+		Policy:   DropOldestGroup,
+	}
+}
+
+// Stats counts queue activity and how often each overflow policy fired
+type Stats struct {
+	Enqueued       uint64
+	Sent           uint64
+	DroppedObjects uint64
+	DroppedGroups  uint64 // DropOldestGroup fired
+	KeyFrameWaits  uint64 // DropUntilKeyFrame fired
+	Disconnects    uint64 // Disconnect fired
+	Queued         int    // objects waiting to be written, only set on a single queue's Stats
+}
+
+// counters summed over all queues of the server
+var totals struct {
+	enqueued, sent, droppedObjects, droppedGroups, keyFrameWaits, disconnects atomic.Uint64
+}
+
+// get the counters summed over all queues, including closed ones
+func TotalStats() Stats {
+	return Stats{
+		Enqueued:       totals.enqueued.Load(),
+		Sent:           totals.sent.Load(),
+		DroppedObjects: totals.droppedObjects.Load(),
+		DroppedGroups:  totals.droppedGroups.Load(),
+		KeyFrameWaits:  totals.keyFrameWaits.Load(),
+		Disconnects:    totals.disconnects.Load(),
+	}
+}
+
+// SendQueue is a bounded queue of objects for one audience subscription, drained by its own writer goroutine,
+// so a slow audience never blocks the channel's forwarding or other audiences
+type SendQueue struct {
+	Name         string // for logging only
+	config       Config
+	local        *moqtransport.LocalTrack
+	onDisconnect func()
+
+	objects      []moqtransport.Object
+	skipGroup    bool // drop the rest of skipGroupID, its beginning was dropped
+	skipGroupID  uint64
+	waitKeyFrame bool // drop until the next object 0
+	closed       bool
+	stats        Stats
+	mutex        sync.Mutex
+
+	signal    chan struct{}
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+}
+
+// create a SendQueue writing to local, onDisconnect is called (once, in its own goroutine) when the Disconnect policy fires
+func NewSendQueue(name string, local *moqtransport.LocalTrack, config Config, onDisconnect func()) *SendQueue {
+	if config.Capacity <= 0 {
+		config.Capacity = DefaultConfig().Capacity
+	}
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	q := &SendQueue{
+		Name:         name,
+		config:       config,
+		local:        local,
+		onDisconnect: onDisconnect,
+		objects:      make([]moqtransport.Object, 0, config.Capacity),
+		signal:       make(chan struct{}, 1),
+		ctx:          ctx,
+		cancelCtx:    cancelCtx,
+	}
+	go q.writeLoop()
+	return q
+}
+
+// enqueue an object without blocking, applying the overflow policy if the queue is full
+func (q *SendQueue) Push(obj moqtransport.Object) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return
+	}
+	if q.waitKeyFrame {
+		if obj.ObjectID != 0 {
+			q.drop(1)
+			return
+		}
+		q.waitKeyFrame = false
+	}
+	if q.skipGroup {
+		if obj.GroupID == q.skipGroupID {
+			q.drop(1)
+			return
+		}
+		q.skipGroup = false
+	}
+
+	if len(q.objects) >= q.config.Capacity {
+		switch q.config.Policy {
+		case DropOldestGroup:
+			oldest := q.objects[0].GroupID
+			kept := q.objects[:0]
+			for _, o := range q.objects {
+				if o.GroupID != oldest {
+					kept = append(kept, o)
+				}
+			}
+			q.drop(len(q.objects) - len(kept))
+			q.objects = kept
+			q.skipGroup, q.skipGroupID = true, oldest
+			q.stats.DroppedGroups++
+			totals.droppedGroups.Add(1)
+			log.Printf("🗑️ send queue %s full: dropped group %d", q.Name, oldest)
+			if obj.GroupID == oldest {
+				q.drop(1)
+				return
+			}
+		case DropUntilKeyFrame:
+			q.drop(len(q.objects))
+			q.objects = q.objects[:0]
+			q.stats.KeyFrameWaits++
+			totals.keyFrameWaits.Add(1)
+			log.Printf("🗑️ send queue %s full: dropped queued objects, waiting for next key frame", q.Name)
+			if obj.ObjectID != 0 {
+				q.waitKeyFrame = true
+				q.drop(1)
+				return
+			}
+		case Disconnect:
+			q.stats.Disconnects++
+			totals.disconnects.Add(1)
+			log.Printf("🔌 send queue %s full: disconnecting audience", q.Name)
+			q.closeLocked()
+			if q.onDisconnect != nil {
+				go q.onDisconnect()
+			}
+			return
+		}
+	}
+
+	q.objects = append(q.objects, obj)
+	q.stats.Enqueued++
+	totals.enqueued.Add(1)
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// stop the writer goroutine and discard queued objects
+func (q *SendQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closeLocked()
+}
+
+// number of objects waiting to be written
+func (q *SendQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.objects)
+}
+
+func (q *SendQueue) Stats() Stats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	stats := q.stats
+	stats.Queued = len(q.objects)
+	return stats
+}
+
+func (q *SendQueue) LocalTrack() *moqtransport.LocalTrack {
+	return q.local
+}
+
+func (q *SendQueue) closeLocked() {
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.objects = nil
+	q.cancelCtx()
+}
+
+// caller must hold q.mutex
+func (q *SendQueue) drop(n int) {
+	q.stats.DroppedObjects += uint64(n)
+	totals.droppedObjects.Add(uint64(n))
+}
+
+func (q *SendQueue) pop() (moqtransport.Object, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.objects) == 0 {
+		return moqtransport.Object{}, false
+	}
+	obj := q.objects[0]
+	q.objects = q.objects[1:]
+	return obj, true
+}
+
+func (q *SendQueue) writeLoop() {
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.signal:
+		}
+		for {
+			obj, ok := q.pop()
+			if !ok {
+				break
+			}
+			if err := q.local.WriteObject(q.ctx, obj); err != nil {
+				if q.ctx.Err() != nil {
+					return
+				}
+				log.Printf("❌ error writing to local track for %s: %s", q.Name, err)
+				continue
+			}
+			q.mutex.Lock()
+			q.stats.Sent++
+			q.mutex.Unlock()
+			totals.sent.Add(1)
+		}
+	}
+}
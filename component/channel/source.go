@@ -0,0 +1,39 @@
+package channel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// TrackSource is where a channel subscribes its catalogTrack & media tracks from: the streamer's session on an origin,
+// the session to the upstream origin on an edge
+type TrackSource interface {
+	Subscribe(ctx context.Context, namespace string, trackName string) (*moqtransport.RemoteTrack, error)
+}
+
+// SessionSource subscribes tracks over a MoQ session, its subscribe IDs (used as track aliases too) are unique within the session
+type SessionSource struct {
+	session *moqtransport.Session
+	nextID  uint64
+	mutex   sync.Mutex
+}
+
+func NewSessionSource(session *moqtransport.Session) *SessionSource {
+	return &SessionSource{session: session}
+}
+
+func (s *SessionSource) Session() *moqtransport.Session {
+	return s.session
+}
+
+// subscribe to a track with the next free subscribe ID, the first subscription gets ID 0
+func (s *SessionSource) Subscribe(ctx context.Context, namespace string, trackName string) (*moqtransport.RemoteTrack, error) {
+	s.mutex.Lock()
+	id := s.nextID
+	s.nextID++
+	s.mutex.Unlock()
+
+	return s.session.Subscribe(ctx, id, id, namespace, trackName, "")
+}
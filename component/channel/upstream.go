@@ -0,0 +1,239 @@
+package channel
+
+import (
+	"context"
+	"moqlivestream/component/payload"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// delay between the last audience leaving a track and unsubscribing it from the streamer
+var upstreamIdleDelay = 5 * time.Second
+
+// set the idle delay applied to upstream subscriptions released afterwards
+func SetUpstreamIdleDelay(delay time.Duration) {
+	upstreamIdleDelay = delay
+}
+
+const (
+	upstreamSubscribeTimeout = 10 * time.Second // wait for the streamer's SUBSCRIBE_OK
+	upstreamDrainTimeout     = 2 * time.Second  // stop draining an unsubscribed track once no object arrived for this long
+	upstreamRetryMin         = 500 * time.Millisecond
+	upstreamRetryMax         = 8 * time.Second // backoff between SUBSCRIBE attempts doubles up to this
+)
+
+// upstreamTrack is the server's subscription to one track of the streamer. It exists while audiences watch the track,
+// the streamer learns which tracks are active from these SUBSCRIBE/UNSUBSCRIBE messages and can pause unused encoders.
+type upstreamTrack struct {
+	trackName string
+	packaging string // of the track in the catalog when subscribed, objects are checked against it
+	kind      string
+	remote    *moqtransport.RemoteTrack // nil until SUBSCRIBE_OK is received
+	ctx       context.Context
+	cancel    context.CancelFunc
+	idleTimer *time.Timer // set while no audience watches the track
+}
+
+// subscribe to a track of the streamer on demand, or keep the existing subscription alive.
+// Caller must hold ch.Mutex.
+func (ch *Channel) acquireUpstream(trackName string) {
+	if u, ok := ch.Upstreams[trackName]; ok {
+		if u.idleTimer != nil {
+			u.idleTimer.Stop()
+			u.idleTimer = nil
+			log.Printf("🔼 upstream track %s/%s in use again", ch.Name, trackName)
+		}
+		return
+	}
+	if ch.Source == nil {
+		log.Printf("❌ error subscribing upstream track %s/%s: channel has no source", ch.Name, trackName)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &upstreamTrack{
+		trackName: trackName,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if ch.Catalog != nil {
+		if track := ch.Catalog.GetTrackByName(trackName); track != nil {
+			u.packaging = track.Packaging
+			u.kind = track.Kind()
+		}
+	}
+	ch.Upstreams[trackName] = u
+	go ch.subscribeUpstream(ch.Source, u)
+}
+
+// schedule unsubscribing a track of the streamer once the idle delay passed without audiences.
+// Caller must hold ch.Mutex.
+func (ch *Channel) releaseUpstream(trackName string) {
+	u, ok := ch.Upstreams[trackName]
+	if !ok || u.idleTimer != nil {
+		return
+	}
+	u.idleTimer = time.AfterFunc(upstreamIdleDelay, func() {
+		ch.Mutex.Lock()
+		if ch.Upstreams[trackName] != u || ch.trackAudienceCount(trackName) > 0 {
+			ch.Mutex.Unlock()
+			return
+		}
+		delete(ch.Upstreams, trackName)
+		if cache, ok := ch.TrackCaches[trackName]; ok {
+			cache.Clear() // stale once the streamer stops sending the track
+		}
+		ch.Mutex.Unlock()
+
+		ch.stopUpstream(u)
+		log.Printf("🔽 upstream track %s/%s idle for %v, unsubscribed", ch.Name, trackName, upstreamIdleDelay)
+	})
+}
+
+// stop every upstream subscription, e.g. when the streamer leaves
+func (ch *Channel) StopUpstreams() {
+	ch.Mutex.Lock()
+	upstreams := ch.Upstreams
+	ch.Upstreams = map[string]*upstreamTrack{}
+	ch.Mutex.Unlock()
+
+	for _, u := range upstreams {
+		if u.idleTimer != nil {
+			u.idleTimer.Stop()
+		}
+		ch.stopUpstream(u)
+	}
+}
+
+// names of the tracks currently subscribed from the streamer
+func (ch *Channel) ActiveUpstreamTracks() []string {
+	ch.Mutex.Lock()
+	defer ch.Mutex.Unlock()
+
+	tracks := []string{}
+	for name, u := range ch.Upstreams {
+		if u.idleTimer == nil {
+			tracks = append(tracks, name)
+		}
+	}
+	return tracks
+}
+
+func (ch *Channel) subscribeUpstream(source TrackSource, u *upstreamTrack) {
+	remote := ch.subscribeUpstreamWithRetry(source, u)
+	if remote == nil {
+		return
+	}
+
+	ch.Mutex.Lock()
+	if ch.Upstreams[u.trackName] != u { // released & stopped while subscribing
+		ch.Mutex.Unlock()
+		remote.Unsubscribe()
+		go drainUpstream(remote)
+		return
+	}
+	u.remote = remote
+	ch.Mutex.Unlock()
+	log.Printf("🔔 Subscribed to channel(%s)'s media track: %s", ch.Name, u.trackName)
+
+	// 1. read objs from current track from streamer
+	// 2. for each obj read, cache it and enqueue it for the audiences who have subscribed to the same track by trackName
+	check := payload.Supported(u.packaging)
+	malformed := 0
+	for {
+		obj, err := remote.ReadObject(u.ctx)
+		if err != nil {
+			if u.ctx.Err() == nil {
+				log.Printf("❌ error reading remote track object: %s", err)
+			}
+			if malformed > 0 {
+				log.Printf("⚠️ %d objects of upstream track %s/%s didn't match its %s packaging", malformed, ch.Name, u.trackName, u.packaging)
+			}
+			return
+		}
+		// objects are forwarded as they are, a mismatch is only reported
+		if check {
+			if _, err := payload.DecodeObject(u.packaging, u.kind, obj.Payload); err != nil {
+				if malformed == 0 {
+					log.Printf("⚠️ object %d/%d of upstream track %s/%s doesn't match its %s packaging: %s", obj.GroupID, obj.ObjectID, ch.Name, u.trackName, u.packaging, err)
+				}
+				malformed++
+			}
+		}
+		ch.ForwardObject(u.trackName, obj)
+	}
+}
+
+// SUBSCRIBE to the streamer's track, retried with backoff while audiences still watch it. nil once the track was released,
+// stopped or has no audience left.
+func (ch *Channel) subscribeUpstreamWithRetry(source TrackSource, u *upstreamTrack) *moqtransport.RemoteTrack {
+	backoff := upstreamRetryMin
+	for {
+		// not bound to u.ctx: a SUBSCRIBE abandoned before its response would leave moqtransport waiting for objects nobody reads
+		ctx, cancel := context.WithTimeout(context.Background(), upstreamSubscribeTimeout)
+		remote, err := source.Subscribe(ctx, ch.Name, u.trackName)
+		cancel()
+		if err == nil {
+			return remote
+		}
+
+		ch.Mutex.Lock()
+		current := ch.Upstreams[u.trackName] == u
+		retry := current && u.ctx.Err() == nil && ch.trackAudienceCount(u.trackName) > 0
+		if current && !retry {
+			delete(ch.Upstreams, u.trackName)
+		}
+		ch.Mutex.Unlock()
+		if !retry {
+			log.Printf("❌ error subscribing to upstream track %s/%s: %s", ch.Name, u.trackName, err)
+			return nil
+		}
+		log.Printf("⚠️ error subscribing to upstream track %s/%s, retrying in %v: %s", ch.Name, u.trackName, backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-u.ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, upstreamRetryMax)
+	}
+}
+
+// unsubscribe from the streamer and end the read loop
+func (ch *Channel) stopUpstream(u *upstreamTrack) {
+	ch.Mutex.Lock()
+	remote := u.remote
+	ch.Mutex.Unlock()
+
+	u.cancel()
+	if remote != nil {
+		remote.Unsubscribe()
+		go drainUpstream(remote)
+	}
+}
+
+// discard objects still in flight after UNSUBSCRIBE, moqtransport blocks the streams delivering them until they are read
+// or the streamer answers with SUBSCRIBE_DONE
+func drainUpstream(remote *moqtransport.RemoteTrack) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), upstreamDrainTimeout)
+		_, err := remote.ReadObject(ctx)
+		cancel()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// caller must hold ch.Mutex
+func (ch *Channel) trackAudienceCount(trackName string) int {
+	for _, track := range ch.TracksAudiences {
+		if track.TrackName == trackName {
+			return len(track.Audiences)
+		}
+	}
+	return 0
+}
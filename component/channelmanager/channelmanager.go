@@ -3,16 +3,21 @@ package channelmanager
 import (
 	"errors"
 	"moqlivestream/component/channel"
+	"moqlivestream/component/channel/catalog"
 	"moqlivestream/component/streamer"
 	"moqlivestream/utilities"
 	"sync"
+	"time"
 )
 
 var log = utilities.NewCustomLogger()
 
+// ChannelManager holds the channels of one server, an origin's streamers or an edge's mirrored channels, and publishes
+// them in its "channels" directory
 type ChannelManager struct {
 	Channels  []*channel.Channel
 	Streamers []*streamer.Streamer
+	directory *directory
 	mutex     sync.Mutex
 }
 
@@ -21,57 +26,137 @@ var (
 	cmOnce sync.Once
 )
 
+func NewChannelManager() *ChannelManager {
+	return &ChannelManager{
+		Channels:  []*channel.Channel{},
+		Streamers: []*streamer.Streamer{},
+		directory: newDirectory(),
+	}
+}
+
+// get the process wide ChannelManager, created on first use
 func InitChannelManager() *ChannelManager {
 	cmOnce.Do(func() {
-		cm = &ChannelManager{
-			Channels:  []*channel.Channel{},
-			Streamers: []*streamer.Streamer{},
-		}
+		cm = NewChannelManager()
 		log.Println("🪵 ChannelManager initialized")
 	})
 	return cm
 }
 
-// initialize a new streamer and Channel, and add the Channel to the ChannelManager's Channels list
-func InitStreamer() (*streamer.Streamer, error) {
-	cm := InitChannelManager()
+// create a Channel whose changes are published in the directory
+func (cm *ChannelManager) newChannel() *channel.Channel {
+	ch := channel.NewChannel()
+	ch.SetChangeHandler(func(ch *channel.Channel) { cm.publishDirectory() })
+	return ch
+}
 
+// initialize a new streamer and Channel, and add the Channel to the ChannelManager's Channels list
+func (cm *ChannelManager) InitStreamer() (*streamer.Streamer, error) {
 	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
-
 	newStreamer := streamer.NewStreamer()
-	newStreamer.Channel = channel.NewChannel()
+	newStreamer.Channel = cm.newChannel()
 
 	cm.Channels = append(cm.Channels, newStreamer.Channel)
 	cm.Streamers = append(cm.Streamers, newStreamer)
+	cm.mutex.Unlock()
+
+	cm.publishDirectory()
 	return newStreamer, nil
 }
 
-// remove a Streamer from the ChannelManager's Streamers list
-func RemoveStreamer(name string) error {
-	cm := InitChannelManager()
+// name the streamer and its Channel after the namespace it ANNOUNCEd, the name must not be taken by another Channel
+func (cm *ChannelManager) AnnounceChannel(st *streamer.Streamer, name string) error {
+	cm.mutex.Lock()
+	for _, ch := range cm.Channels {
+		if ch.Name == name && ch != st.Channel {
+			cm.mutex.Unlock()
+			return errors.New("channel(namespace) already exists")
+		}
+	}
+	st.Name = name
+	st.Channel.Name = name
+	if st.Channel.StartTime.IsZero() {
+		st.Channel.StartTime = time.Now()
+	}
+	cm.mutex.Unlock()
 
+	cm.publishDirectory()
+	return nil
+}
+
+// add a Channel without a streamer, e.g. an edge's mirror of a channel of its origin, listed in the directory right away
+func (cm *ChannelManager) AddChannel(name string, startTime time.Time) (*channel.Channel, error) {
 	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
+	for _, ch := range cm.Channels {
+		if ch.Name == name {
+			cm.mutex.Unlock()
+			return nil, errors.New("channel(namespace) already exists")
+		}
+	}
+	ch := cm.newChannel()
+	ch.Name = name
+	ch.StartTime = startTime
+	if ch.StartTime.IsZero() {
+		ch.StartTime = time.Now()
+	}
+	cm.Channels = append(cm.Channels, ch)
+	cm.mutex.Unlock()
+
+	cm.publishDirectory()
+	return ch, nil
+}
 
+// remove a Channel added by AddChannel from the ChannelManager's Channels list
+func (cm *ChannelManager) RemoveChannel(name string) error {
+	cm.mutex.Lock()
+	found := false
+	for i, ch := range cm.Channels {
+		if ch.Name == name {
+			cm.Channels = append(cm.Channels[:i], cm.Channels[i+1:]...)
+			found = true
+			break
+		}
+	}
+	cm.mutex.Unlock()
+	if !found {
+		return errors.New("channel not found")
+	}
+
+	cm.publishDirectory()
+	return nil
+}
+
+// remove a Streamer and its Channel from the ChannelManager's Streamers and Channels lists
+func (cm *ChannelManager) RemoveStreamer(name string) error {
+	cm.mutex.Lock()
+	found := false
 	for i, st := range cm.Streamers {
 		if st.Channel.Name == name {
 			cm.Streamers = append(cm.Streamers[:i], cm.Streamers[i+1:]...)
-			return nil
+			found = true
+			break
 		}
 	}
 	for i, ch := range cm.Channels {
 		if ch.Name == name {
 			cm.Channels = append(cm.Channels[:i], cm.Channels[i+1:]...)
-			return nil
+			found = true
+			break
 		}
 	}
-	return errors.New("streamer not found")
+	cm.mutex.Unlock()
+	if !found {
+		return errors.New("streamer not found")
+	}
+
+	cm.publishDirectory()
+	return nil
 }
 
 // get a list of names of all Channels
-func GetChannelNames() []string {
-	cm := InitChannelManager()
+func (cm *ChannelManager) GetChannelNames() []string {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 
 	channelNames := make([]string, len(cm.Channels))
 	for i, ch := range cm.Channels {
@@ -81,8 +166,9 @@ func GetChannelNames() []string {
 }
 
 // get a Channel by name
-func GetChannelByName(name string) (*channel.Channel, error) {
-	cm := InitChannelManager()
+func (cm *ChannelManager) GetChannelByName(name string) (*channel.Channel, error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 
 	for _, ch := range cm.Channels {
 		if ch.Name == name {
@@ -92,9 +178,18 @@ func GetChannelByName(name string) (*channel.Channel, error) {
 	return nil, errors.New("channel not found")
 }
 
+// start time of a Channel, zero until its streamer ANNOUNCEd a name
+func (cm *ChannelManager) ChannelStartTime(ch *channel.Channel) time.Time {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	return ch.StartTime
+}
+
 // check for channel name uniqueness
-func ChannelUnique(name string) bool {
-	cm := InitChannelManager()
+func (cm *ChannelManager) ChannelUnique(name string) bool {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 
 	for _, ch := range cm.Channels {
 		if ch.Name == name {
@@ -104,22 +199,74 @@ func ChannelUnique(name string) bool {
 	return true
 }
 
-// get Channel Status for announcement
+// get Channel Status for announcement, one entry of the "channels" directory
 type ChannelStatus struct {
-	Name   string
-	Status bool
+	Name         string         `json:"name"`
+	Status       bool           `json:"status"` // live while the streamer is connected
+	Title        string         `json:"title,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	Visibility   string         `json:"visibility"` // only public channels are listed to every audience
+	StartTime    time.Time      `json:"startTime"`
+	Viewers      int            `json:"viewers"`      // distinct audiences watching any track
+	TrackViewers map[string]int `json:"trackViewers"` // audiences per track
+	Renditions   []Rendition    `json:"renditions"`   // tracks of the catalog, empty until the catalog is received
+}
+
+// summary of a catalog track
+type Rendition struct {
+	Name     string `json:"name"`
+	Label    string `json:"label,omitempty"`
+	AltGroup int    `json:"altGroup,omitempty"`
+	catalog.SelectionParams
 }
 
-// get a list of all Channels with their current status: map[uuid]struct[name, status]
-func AnnounceChannelStatus() []ChannelStatus {
-	cm := InitChannelManager()
+// get a list of all announced Channels with their current status, Channels are listed once their streamer ANNOUNCEd a name
+func (cm *ChannelManager) AnnounceChannelStatus() []ChannelStatus {
+	// Name & StartTime are written by AnnounceChannel under cm.mutex, so they are copied before it's released
+	type announced struct {
+		ch        *channel.Channel
+		name      string
+		startTime time.Time
+	}
+	cm.mutex.Lock()
+	channels := []announced{}
+	for _, ch := range cm.Channels {
+		if !ch.StartTime.IsZero() {
+			channels = append(channels, announced{ch: ch, name: ch.Name, startTime: ch.StartTime})
+		}
+	}
+	cm.mutex.Unlock()
 
-	channelStatus := make([]ChannelStatus, len(cm.Channels))
-	for id, ch := range cm.Channels {
-		channelStatus[id] = ChannelStatus{
-			Name:   ch.Name,
-			Status: ch.Status,
+	channelStatus := []ChannelStatus{}
+	for _, a := range channels {
+		ch := a.ch
+		trackViewers, viewers := ch.Viewers()
+		status := ChannelStatus{
+			Name:         a.name,
+			Status:       ch.Live(),
+			StartTime:    a.startTime,
+			Viewers:      viewers,
+			TrackViewers: trackViewers,
+			Visibility:   ch.Visibility(),
+			Renditions:   []Rendition{},
+		}
+		if c := ch.GetCatalog(); c != nil {
+			for _, track := range c.Tracks {
+				status.Renditions = append(status.Renditions, Rendition{
+					Name:            track.Name,
+					Label:           track.Label,
+					AltGroup:        track.AltGroup,
+					SelectionParams: track.SelectionParams,
+				})
+			}
+			if c.Metadata != nil {
+				status.Title = c.Metadata.Title
+				status.Description = c.Metadata.Description
+				status.Tags = c.Metadata.Tags
+			}
 		}
+		channelStatus = append(channelStatus, status)
 	}
 	return channelStatus
 }
@@ -0,0 +1,130 @@
+package channelmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/metatrack"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// directory publishes the "channels" track: every change of an audience's (filtered) channel list starts a new group whose
+// only object is the full AnnounceChannelStatus() snapshot as JSON, so a subscriber only ever needs the latest object
+type directory struct {
+	snapshot      []ChannelStatus
+	snapshotBytes []byte // to skip republishing an unchanged snapshot
+	subscribers   map[*moqtransport.LocalTrack]*directorySubscriber
+	mutex         sync.Mutex
+}
+
+// one audience's "channels" local track with its filter
+type directorySubscriber struct {
+	writer  *metatrack.Writer
+	filter  *DirectoryFilter
+	visible func(ChannelStatus) bool // whether a channel that isn't public is listed to the audience
+	groupID uint64                   // group of the last queued snapshot
+	queued  bool                     // a snapshot was queued before, the next one starts a new group
+	last    []byte                   // last queued payload
+	mutex   sync.Mutex
+}
+
+func newDirectory() *directory {
+	return &directory{
+		subscribers: map[*moqtransport.LocalTrack]*directorySubscriber{},
+	}
+}
+
+// start publishing the channel directory on an audience's "channels" local track, beginning with the current snapshot.
+// Only the channels passing the filter are listed, a nil filter lists every channel. Channels that aren't public are only
+// listed if visible says so, a nil visible lists public channels only.
+func (cm *ChannelManager) SubscribeDirectory(local *moqtransport.LocalTrack, filter *DirectoryFilter, visible func(ChannelStatus) bool) {
+	dir := cm.directory
+	dir.mutex.Lock()
+	defer dir.mutex.Unlock()
+
+	if dir.snapshotBytes == nil {
+		dir.snapshot = cm.AnnounceChannelStatus()
+		dir.snapshotBytes = marshalChannelStatus(dir.snapshot)
+	}
+	if sub, ok := dir.subscribers[local]; ok { // re-subscribed to the same local track, resend the current snapshot
+		sub.mutex.Lock()
+		sub.filter = filter
+		sub.visible = visible
+		sub.last = nil
+		sub.mutex.Unlock()
+		sub.update(dir.snapshot)
+		return
+	}
+	sub := &directorySubscriber{
+		writer:  metatrack.NewWriter(local),
+		filter:  filter,
+		visible: visible,
+	}
+	dir.subscribers[local] = sub
+	sub.update(dir.snapshot)
+}
+
+// stop publishing the channel directory on an audience's "channels" local track
+func (cm *ChannelManager) UnsubscribeDirectory(local *moqtransport.LocalTrack) {
+	dir := cm.directory
+	dir.mutex.Lock()
+	defer dir.mutex.Unlock()
+
+	if sub, ok := dir.subscribers[local]; ok {
+		delete(dir.subscribers, local)
+		sub.writer.Close()
+	}
+}
+
+// publish the current snapshot to every directory subscriber whose channel list changed
+func (cm *ChannelManager) publishDirectory() {
+	dir := cm.directory
+	dir.mutex.Lock() // held while taking the snapshot, so concurrent changes are published in order
+	defer dir.mutex.Unlock()
+
+	snapshot := cm.AnnounceChannelStatus()
+	snapshotBytes := marshalChannelStatus(snapshot)
+	if snapshotBytes == nil || bytes.Equal(snapshotBytes, dir.snapshotBytes) {
+		return
+	}
+	dir.snapshot = snapshot
+	dir.snapshotBytes = snapshotBytes
+	for _, sub := range dir.subscribers {
+		sub.update(snapshot)
+	}
+	log.Printf("📇 Channel directory published to %d audiences: %s", len(dir.subscribers), snapshotBytes)
+}
+
+func marshalChannelStatus(status []ChannelStatus) []byte {
+	statusBytes, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("❌ error marshalling channel status: %s", err)
+		return nil
+	}
+	return statusBytes
+}
+
+// queue the filtered snapshot as a new group if it differs from the last one queued
+func (s *directorySubscriber) update(snapshot []ChannelStatus) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	listed := []ChannelStatus{}
+	for _, status := range snapshot {
+		if status.Visibility == catalog.VisibilityPublic || (s.visible != nil && s.visible(status)) {
+			listed = append(listed, status)
+		}
+	}
+	payload := marshalChannelStatus(s.filter.Apply(listed))
+	if payload == nil || (s.last != nil && bytes.Equal(payload, s.last)) {
+		return
+	}
+	if s.queued {
+		s.groupID++
+	}
+	s.queued = true
+	s.last = payload
+	s.writer.Write(s.groupID, payload)
+}
@@ -0,0 +1,88 @@
+package channelmanager
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DirectoryFilter selects the entries of the "channels" directory an audience receives, parsed from a URL query string:
+//
+//	q=<text>            name, title, description or a tag contains the text, case-insensitive
+//	tag=<tag>           has the tag, repeatable, all tags must match
+//	status=live|offline only live or offline channels
+type DirectoryFilter struct {
+	Query  string
+	Tags   []string
+	Status string
+}
+
+// parse a directory filter from a URL query string, an empty string matches every channel
+func ParseDirectoryFilter(query string) (*DirectoryFilter, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory filter %q: %w", query, err)
+	}
+
+	filter := &DirectoryFilter{}
+	for key, vals := range values {
+		switch key {
+		case "q":
+			filter.Query = strings.ToLower(vals[len(vals)-1])
+		case "tag":
+			for _, tag := range vals {
+				filter.Tags = append(filter.Tags, strings.ToLower(tag))
+			}
+		case "status":
+			filter.Status = vals[len(vals)-1]
+			if filter.Status != "live" && filter.Status != "offline" && filter.Status != "" {
+				return nil, fmt.Errorf("invalid directory filter status %q: must be live or offline", filter.Status)
+			}
+		default:
+			return nil, fmt.Errorf("unknown directory filter key %q", key)
+		}
+	}
+	return filter, nil
+}
+
+// check whether a channel passes the filter, a nil filter matches every channel
+func (f *DirectoryFilter) Match(status ChannelStatus) bool {
+	if f == nil {
+		return true
+	}
+	if f.Status == "live" && !status.Status || f.Status == "offline" && status.Status {
+		return false
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range status.Tags {
+		tags[strings.ToLower(tag)] = true
+	}
+	for _, tag := range f.Tags {
+		if !tags[tag] {
+			return false
+		}
+	}
+
+	if f.Query == "" {
+		return true
+	}
+	fields := append([]string{status.Name, status.Title, status.Description}, status.Tags...)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), f.Query) {
+			return true
+		}
+	}
+	return false
+}
+
+// get the channels passing the filter
+func (f *DirectoryFilter) Apply(status []ChannelStatus) []ChannelStatus {
+	filtered := []ChannelStatus{}
+	for _, s := range status {
+		if f.Match(s) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,251 @@
+package forwarding
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/quic-go/webtransport-go"
+)
+
+// stream header types of draft-ietf-moq-transport-05 that start a stream carrying several objects
+const (
+	streamHeaderTrackType = 0x50
+	streamHeaderGroupType = 0x51
+)
+
+// object message types of draft-ietf-moq-transport-05 carrying a single object
+const (
+	objectStreamType   = 0x00
+	objectDatagramType = 0x01
+)
+
+// counters of all connections, including closed ones
+type Stats struct {
+	Datagrams        uint64 // objects sent as datagram
+	DroppedDatagrams uint64 // datagrams the connection couldn't send
+	LateObjects      uint64 // objects of a group written after the next group's stream started, dropped
+	FailedStreams    uint64 // streams the connection couldn't open or write, e.g. once the session ended, their objects dropped
+}
+
+var totals struct {
+	datagrams, droppedDatagrams, lateObjects, failedStreams atomic.Uint64
+}
+
+func TotalStats() Stats {
+	return Stats{
+		Datagrams:        totals.datagrams.Load(),
+		DroppedDatagrams: totals.droppedDatagrams.Load(),
+		LateObjects:      totals.lateObjects.Load(),
+		FailedStreams:    totals.failedStreams.Load(),
+	}
+}
+
+// Conn wraps the moqtransport.Connection of a session publishing tracks, so every forwarding mode is usable with moqtransport:
+// it never closes the streams of STREAM_HEADER_GROUP & STREAM_HEADER_TRACK, which exhausts the peer's stream limit after
+// a few groups, and panics on a datagram or stream the connection can't send.
+type Conn struct {
+	moqtransport.Connection
+	streams map[uint64]*sendStream // open group or track stream by subscribe ID
+	ended   map[uint64]bool        // subscriptions ended by EndSubscription whose objects are dropped
+	mutex   sync.Mutex
+}
+
+func NewConn(conn moqtransport.Connection) *Conn {
+	return &Conn{Connection: conn, streams: map[uint64]*sendStream{}, ended: map[uint64]bool{}}
+}
+
+// a stream the connection can't open, e.g. for an object sent while the session ends, drops its objects
+func (c *Conn) OpenUniStream() (moqtransport.SendStream, error) {
+	stream, err := c.Connection.OpenUniStream()
+	if err != nil {
+		totals.failedStreams.Add(1)
+		return &sendStream{conn: c, failed: true}, nil
+	}
+	return &sendStream{SendStream: stream, conn: c}, nil
+}
+
+// a datagram the connection can't send, e.g. one too large for the path or after the session ended, is dropped like a lost one
+func (c *Conn) SendDatagram(b []byte) error {
+	if subscribeID, ok := parseSubscribeID(b); ok && c.subscriptionEnded(subscribeID) {
+		return nil
+	}
+	if err := c.Connection.SendDatagram(b); err != nil {
+		totals.droppedDatagrams.Add(1)
+		return nil
+	}
+	totals.datagrams.Add(1)
+	return nil
+}
+
+// close the open group or track stream of a subscription that ended, e.g. on UNSUBSCRIBE or SUBSCRIBE_DONE
+func (c *Conn) CloseSubscription(subscribeID uint64) {
+	c.mutex.Lock()
+	s := c.streams[subscribeID]
+	delete(c.streams, subscribeID)
+	c.mutex.Unlock()
+
+	if s != nil {
+		s.Close()
+	}
+}
+
+// end a subscription the peer didn't unsubscribe, e.g. with a SUBSCRIBE_DONE sent by the server: moqtransport has no API to
+// end it and keeps sending the objects of its local track, so they are dropped from now on
+func (c *Conn) EndSubscription(subscribeID uint64) {
+	c.mutex.Lock()
+	c.ended[subscribeID] = true
+	c.mutex.Unlock()
+
+	c.CloseSubscription(subscribeID)
+}
+
+func (c *Conn) subscriptionEnded(subscribeID uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.ended[subscribeID]
+}
+
+// register the stream a subscription's objects go on from now on and close the previous one, i.e. its previous group's
+func (c *Conn) replace(subscribeID uint64, s *sendStream) {
+	c.mutex.Lock()
+	prev := c.streams[subscribeID]
+	c.streams[subscribeID] = s
+	c.mutex.Unlock()
+
+	if prev != nil && prev != s {
+		prev.Close()
+	}
+}
+
+func (c *Conn) forget(subscribeID uint64, s *sendStream) {
+	c.mutex.Lock()
+	if c.streams[subscribeID] == s {
+		delete(c.streams, subscribeID)
+	}
+	c.mutex.Unlock()
+}
+
+// sendStream reads the subscribe ID from the stream header moqtransport writes first. Writes after Close are dropped:
+// moqtransport keeps writing objects of a group that arrive after the next group started to the group's stream.
+// Writes after an error are dropped too, moqtransport panics on write & close errors, as are streams of ended subscriptions.
+type sendStream struct {
+	moqtransport.SendStream // nil if the stream couldn't be opened or was reset
+	conn                    *Conn
+	started                 bool
+	closed                  bool
+	failed                  bool
+	registered              bool
+	subscribeID             uint64
+	mutex                   sync.Mutex
+}
+
+func (s *sendStream) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	if s.failed {
+		s.mutex.Unlock()
+		return len(p), nil
+	}
+	if s.closed {
+		s.mutex.Unlock()
+		totals.lateObjects.Add(1)
+		return len(p), nil
+	}
+	header := !s.started
+	s.started = true
+	if header {
+		if subscribeID, ok := parseSubscribeID(p); ok && s.conn.subscriptionEnded(subscribeID) {
+			s.failed = true
+			s.cancel()
+			s.mutex.Unlock()
+			return len(p), nil
+		}
+	}
+	if _, err := s.SendStream.Write(p); err != nil {
+		s.failed = true
+		s.mutex.Unlock()
+		totals.failedStreams.Add(1)
+		return len(p), nil
+	}
+	s.mutex.Unlock()
+
+	if header {
+		s.register(p)
+	}
+	return len(p), nil
+}
+
+// register a group or track stream by the subscribe ID of its header, each object of an OBJECT_STREAM has its own stream
+func (s *sendStream) register(header []byte) {
+	msgType, _, err := quicvarint.Parse(header)
+	if err != nil || (msgType != streamHeaderTrackType && msgType != streamHeaderGroupType) {
+		return
+	}
+	subscribeID, ok := parseSubscribeID(header)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.registered = true
+	s.subscribeID = subscribeID
+	s.mutex.Unlock()
+	s.conn.replace(subscribeID, s)
+}
+
+func (s *sendStream) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	if s.SendStream != nil {
+		s.SendStream.Close() // fails once the session ended, the objects are dropped then
+	}
+	registered, subscribeID := s.registered, s.subscribeID
+	s.mutex.Unlock()
+
+	if registered {
+		s.conn.forget(subscribeID, s)
+	}
+	return nil
+}
+
+// a stream that can be reset, e.g. a webtransport.SendStream
+type writeCanceler interface {
+	CancelWrite(webtransport.StreamErrorCode)
+}
+
+// reset a stream of an ended subscription before anything was written, an empty stream would fail the peer's header parsing
+func (s *sendStream) cancel() {
+	if stream, ok := s.SendStream.(writeCanceler); ok {
+		stream.CancelWrite(0)
+	} else {
+		s.SendStream.Close()
+	}
+	s.SendStream = nil
+}
+
+// the subscribe ID following the type of an object message or stream header, all object types start with both
+func parseSubscribeID(b []byte) (uint64, bool) {
+	msgType, n, err := quicvarint.Parse(b)
+	if err != nil {
+		return 0, false
+	}
+	switch msgType {
+	case objectStreamType, objectDatagramType, streamHeaderTrackType, streamHeaderGroupType:
+	default:
+		return 0, false
+	}
+	subscribeID, _, err := quicvarint.Parse(b[n:])
+	if err != nil {
+		return 0, false
+	}
+	return subscribeID, true
+}
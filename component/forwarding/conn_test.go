@@ -0,0 +1,304 @@
+package forwarding
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/quic-go/webtransport-go"
+)
+
+// a connection recording the streams it opened & the datagrams it sent, only what Conn calls is implemented
+type testConnection struct {
+	moqtransport.Connection
+	streams     []*testStream
+	datagrams   [][]byte
+	openErr     error
+	datagramErr error
+	mutex       sync.Mutex
+}
+
+func (tc *testConnection) OpenUniStream() (moqtransport.SendStream, error) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	if tc.openErr != nil {
+		return nil, tc.openErr
+	}
+	s := &testStream{}
+	tc.streams = append(tc.streams, s)
+	return s, nil
+}
+
+func (tc *testConnection) SendDatagram(b []byte) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	if tc.datagramErr != nil {
+		return tc.datagramErr
+	}
+	tc.datagrams = append(tc.datagrams, b)
+	return nil
+}
+
+type testStream struct {
+	writes   [][]byte
+	closed   bool
+	canceled bool
+	writeErr error
+}
+
+func (ts *testStream) Write(p []byte) (int, error) {
+	if ts.closed || ts.canceled {
+		return 0, errors.New("write on closed stream")
+	}
+	if ts.writeErr != nil {
+		return 0, ts.writeErr
+	}
+	ts.writes = append(ts.writes, bytes.Clone(p))
+	return len(p), nil
+}
+
+func (ts *testStream) Close() error {
+	ts.closed = true
+	return nil
+}
+
+func (ts *testStream) CancelWrite(webtransport.StreamErrorCode) {
+	ts.canceled = true
+}
+
+// a message of the given type starting with the subscribe ID followed by the other fields, e.g. a STREAM_HEADER_GROUP's
+// track alias, group ID & publisher priority
+func message(msgType, subscribeID uint64, fields ...uint64) []byte {
+	b := quicvarint.Append(quicvarint.Append(nil, msgType), subscribeID)
+	for _, f := range fields {
+		b = quicvarint.Append(b, f)
+	}
+	return b
+}
+
+func groupHeader(subscribeID, groupID uint64) []byte {
+	return message(streamHeaderGroupType, subscribeID, subscribeID, groupID, 0)
+}
+
+// open a stream on the connection and write its header, returning the stream moqtransport & the peer see
+func openStream(t *testing.T, c *Conn, tc *testConnection, header []byte) (moqtransport.SendStream, *testStream) {
+	t.Helper()
+	s, err := c.OpenUniStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	return s, tc.streams[len(tc.streams)-1]
+}
+
+func TestParseSubscribeID(t *testing.T) {
+	tests := []struct {
+		name        string
+		b           []byte
+		subscribeID uint64
+		ok          bool
+	}{
+		{"object stream", message(objectStreamType, 7, 7, 0, 0, 0), 7, true},
+		{"object datagram", message(objectDatagramType, 300, 1, 2, 3, 0), 300, true},
+		{"track header", message(streamHeaderTrackType, 1, 1, 0), 1, true},
+		{"group header", groupHeader(16384, 5), 16384, true},
+		{"subscribe ID only", message(streamHeaderGroupType, 2), 2, true},
+		{"other message type", message(0x03, 7), 0, false}, // SUBSCRIBE
+		{"type without subscribe ID", quicvarint.Append(nil, streamHeaderGroupType), 0, false},
+		{"truncated type", quicvarint.Append(nil, streamHeaderGroupType)[:1], 0, false},
+		{"empty", nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscribeID, ok := parseSubscribeID(tt.b)
+			if subscribeID != tt.subscribeID || ok != tt.ok {
+				t.Errorf("got %d, %v, want %d, %v", subscribeID, ok, tt.subscribeID, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRegisterStreams(t *testing.T) {
+	tc := &testConnection{}
+	c := NewConn(tc)
+
+	openStream(t, c, tc, groupHeader(1, 0))
+	openStream(t, c, tc, message(streamHeaderTrackType, 2, 2, 0))
+	openStream(t, c, tc, message(objectStreamType, 3, 3, 0, 0, 0))
+	openStream(t, c, tc, []byte{0x40}) // not a valid varint
+
+	if len(c.streams) != 2 || c.streams[1] == nil || c.streams[2] == nil {
+		t.Errorf("got streams %v, want the group & track streams of subscriptions 1 & 2", c.streams)
+	}
+}
+
+func TestGroupStreamReplaced(t *testing.T) {
+	tc := &testConnection{}
+	c := NewConn(tc)
+	lateObjects := totals.lateObjects.Load()
+
+	group0, peer0 := openStream(t, c, tc, groupHeader(1, 0))
+	if _, err := group0.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	_, other := openStream(t, c, tc, groupHeader(2, 0))
+	_, object := openStream(t, c, tc, message(objectStreamType, 1, 1, 1, 0, 0)) // doesn't replace the group stream
+
+	group1, peer1 := openStream(t, c, tc, groupHeader(1, 1))
+	if !peer0.closed {
+		t.Error("the previous group's stream wasn't closed once the next group started")
+	}
+	if peer1.closed || other.closed || object.closed {
+		t.Error("closed the next group's stream or a stream of another subscription")
+	}
+
+	// objects of the previous group arriving late are dropped, not written to the closed stream
+	if n, err := group0.Write([]byte{2}); n != 1 || err != nil {
+		t.Errorf("late write returned %d, %v, want 1, nil", n, err)
+	}
+	if len(peer0.writes) != 2 {
+		t.Errorf("got %d writes on the previous group's stream, want the header & 1 object", len(peer0.writes))
+	}
+	if got := totals.lateObjects.Load() - lateObjects; got != 1 {
+		t.Errorf("counted %d late objects, want 1", got)
+	}
+
+	// closing the previous group's stream again keeps the next group's registered
+	if err := group0.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.streams[1] != group1.(*sendStream) {
+		t.Error("closing the previous group's stream unregistered the next group's")
+	}
+	if err := group1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.streams[1]; ok {
+		t.Error("closed stream still registered")
+	}
+}
+
+func TestCloseSubscription(t *testing.T) {
+	tc := &testConnection{}
+	c := NewConn(tc)
+
+	group, peer := openStream(t, c, tc, groupHeader(1, 0))
+	_, other := openStream(t, c, tc, groupHeader(2, 0))
+	c.CloseSubscription(1)
+	c.CloseSubscription(3) // unknown subscriptions are ignored
+
+	if !peer.closed || other.closed {
+		t.Errorf("closed %v & %v, want only the stream of subscription 1", peer.closed, other.closed)
+	}
+	if _, ok := c.streams[1]; ok {
+		t.Error("stream of the closed subscription still registered")
+	}
+	if _, err := group.Write([]byte{1}); err != nil || len(peer.writes) != 1 {
+		t.Errorf("write after CloseSubscription returned %v with %d writes, want it dropped", err, len(peer.writes))
+	}
+
+	// unlike EndSubscription, the subscription's next group is sent
+	_, next := openStream(t, c, tc, groupHeader(1, 1))
+	if next.canceled || len(next.writes) != 1 {
+		t.Error("dropped the next group of a closed subscription")
+	}
+}
+
+func TestEndSubscription(t *testing.T) {
+	tc := &testConnection{}
+	c := NewConn(tc)
+
+	_, peer := openStream(t, c, tc, groupHeader(1, 0))
+	c.EndSubscription(1)
+	if !peer.closed {
+		t.Error("open stream of the ended subscription wasn't closed")
+	}
+
+	// streams of the ended subscription are reset before their header, other subscriptions are sent
+	next, nextPeer := openStream(t, c, tc, groupHeader(1, 1))
+	if _, err := next.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !nextPeer.canceled || len(nextPeer.writes) != 0 {
+		t.Errorf("stream of the ended subscription canceled %v with %d writes, want it reset without writes", nextPeer.canceled, len(nextPeer.writes))
+	}
+	_, object := openStream(t, c, tc, message(objectStreamType, 1, 1, 2, 0, 0))
+	if !object.canceled {
+		t.Error("sent an object stream of the ended subscription")
+	}
+	_, other := openStream(t, c, tc, groupHeader(2, 0))
+	if other.canceled || len(other.writes) != 1 {
+		t.Error("dropped a stream of another subscription")
+	}
+
+	if err := c.SendDatagram(message(objectDatagramType, 1, 1, 0, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendDatagram(message(objectDatagramType, 2, 2, 0, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tc.datagrams) != 1 {
+		t.Errorf("sent %d datagrams, want only the one of subscription 2", len(tc.datagrams))
+	}
+}
+
+func TestConnErrorsDropObjects(t *testing.T) {
+	tc := &testConnection{}
+	c := NewConn(tc)
+	before := TotalStats()
+
+	tc.openErr = errors.New("session closed")
+	s, err := c.OpenUniStream()
+	if err != nil {
+		t.Fatalf("got error %v, want a stream dropping its objects", err)
+	}
+	for _, p := range [][]byte{groupHeader(1, 0), {1}} {
+		if n, err := s.Write(p); n != len(p) || err != nil {
+			t.Errorf("write on an unopened stream returned %d, %v", n, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+	tc.openErr = nil
+
+	failing, peer := openStream(t, c, tc, groupHeader(2, 0))
+	peer.writeErr = errors.New("stream reset")
+	if _, err := failing.Write([]byte{1}); err != nil {
+		t.Errorf("got error %v on a failing stream, want the object dropped", err)
+	}
+	peer.writeErr = nil
+	if _, err := failing.Write([]byte{2}); err != nil || len(peer.writes) != 1 {
+		t.Errorf("wrote %d times after a write error, want only the header", len(peer.writes))
+	}
+
+	tc.datagramErr = errors.New("datagram too large")
+	if err := c.SendDatagram(message(objectDatagramType, 3, 3, 0, 0, 0)); err != nil {
+		t.Errorf("got error %v, want the datagram dropped", err)
+	}
+	tc.datagramErr = nil
+	if err := c.SendDatagram(message(objectDatagramType, 3, 3, 0, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	after := TotalStats()
+	if got := after.FailedStreams - before.FailedStreams; got != 2 {
+		t.Errorf("counted %d failed streams, want 2", got)
+	}
+	if got := after.DroppedDatagrams - before.DroppedDatagrams; got != 1 {
+		t.Errorf("counted %d dropped datagrams, want 1", got)
+	}
+	if got := after.Datagrams - before.Datagrams; got != 1 {
+		t.Errorf("counted %d datagrams, want 1", got)
+	}
+}
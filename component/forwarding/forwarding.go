@@ -0,0 +1,85 @@
+package forwarding
+
+import (
+	"fmt"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// forwarding modes of a track, how its objects are mapped onto QUIC streams & datagrams
+const (
+	ModeTrack    = "track"    // one stream for all objects of a subscription, STREAM_HEADER_TRACK
+	ModeGroup    = "group"    // one stream per group, STREAM_HEADER_GROUP
+	ModeObject   = "object"   // one stream per object, OBJECT_STREAM
+	ModeDatagram = "datagram" // one datagram per object, OBJECT_DATAGRAM
+)
+
+// largest object payload sent as datagram, larger objects of a datagram track go on their own stream instead. Stays below
+// what fits in a QUIC packet of the initial 1280 bytes with the QUIC, WebTransport & MoQ headers, before path MTU discovery.
+const MaxDatagramPayload = 1100
+
+var preferences = map[string]moqtransport.ObjectForwardingPreference{
+	ModeTrack:    moqtransport.ObjectForwardingPreferenceStreamTrack,
+	ModeGroup:    moqtransport.ObjectForwardingPreferenceStreamGroup,
+	ModeObject:   moqtransport.ObjectForwardingPreferenceStream,
+	ModeDatagram: moqtransport.ObjectForwardingPreferenceDatagram,
+}
+
+func Modes() []string {
+	return []string{ModeTrack, ModeGroup, ModeObject, ModeDatagram}
+}
+
+// whether mode is one of Modes
+func Valid(mode string) bool {
+	_, ok := preferences[mode]
+	return ok
+}
+
+// check a mode of a track or the server config, empty keeps the mode objects arrive in
+func Check(mode string) error {
+	if mode != "" && !Valid(mode) {
+		return fmt.Errorf("forwarding mode %q: must be one of %v", mode, Modes())
+	}
+	return nil
+}
+
+// mode of an object's forwarding preference, e.g. of one read from a remote track
+func Mode(pref moqtransport.ObjectForwardingPreference) string {
+	for mode, p := range preferences {
+		if p == pref {
+			return mode
+		}
+	}
+	return ""
+}
+
+// forward obj in mode, an empty or unknown mode keeps its forwarding preference
+func Apply(obj moqtransport.Object, mode string) moqtransport.Object {
+	pref, ok := preferences[mode]
+	if !ok {
+		return obj
+	}
+	if pref == moqtransport.ObjectForwardingPreferenceDatagram && len(obj.Payload) > MaxDatagramPayload {
+		pref = moqtransport.ObjectForwardingPreferenceStream
+	}
+	obj.ForwardingPreference = pref
+	return obj
+}
+
+// modes per media kind the server forwards tracks to audiences in, overriding the modes declared in the catalog.
+// Empty keeps the catalog's mode, or the mode objects arrive in if the catalog declares none.
+type Config struct {
+	Audio string
+	Video string
+}
+
+// mode of a track of kind ("audio" or "video") declaring catalogMode
+func (c Config) Resolve(kind string, catalogMode string) string {
+	switch {
+	case kind == "audio" && c.Audio != "":
+		return c.Audio
+	case kind == "video" && c.Video != "":
+		return c.Video
+	}
+	return catalogMode
+}
@@ -0,0 +1,167 @@
+package mediafile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	ivfSignature       = "DKIF"
+	ivfFileHeaderSize  = 32
+	ivfFrameHeaderSize = 12
+)
+
+// IVFHeader is the file header of an IVF file, the container libvpx writes VP8/VP9 frames to
+type IVFHeader struct {
+	FourCC      string // codec, e.g. "VP80"
+	Width       uint16
+	Height      uint16
+	TimebaseDen uint32 // frame timestamps are in units of TimebaseNum/TimebaseDen seconds
+	TimebaseNum uint32
+	FrameCount  uint32 // as written by the muxer, may be 0 for live captures
+}
+
+// IVFFrame is one frame of an IVF file
+type IVFFrame struct {
+	PTS  uint64 // presentation timestamp in timebase units
+	Data []byte
+}
+
+// IVFReader reads the frames of an IVF file
+type IVFReader struct {
+	r      io.Reader
+	header IVFHeader
+}
+
+// read the IVF file header, frames are read with ReadFrame
+func NewIVFReader(r io.Reader) (*IVFReader, error) {
+	buf := make([]byte, ivfFileHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("reading IVF header: %w", err)
+	}
+	if string(buf[0:4]) != ivfSignature {
+		return nil, errors.New("not an IVF file: missing DKIF signature")
+	}
+	headerSize := binary.LittleEndian.Uint16(buf[6:8])
+	if headerSize < ivfFileHeaderSize {
+		return nil, fmt.Errorf("invalid IVF header size %d", headerSize)
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(headerSize-ivfFileHeaderSize)); err != nil {
+		return nil, fmt.Errorf("reading IVF header: %w", err)
+	}
+
+	header := IVFHeader{
+		FourCC:      string(buf[8:12]),
+		Width:       binary.LittleEndian.Uint16(buf[12:14]),
+		Height:      binary.LittleEndian.Uint16(buf[14:16]),
+		TimebaseDen: binary.LittleEndian.Uint32(buf[16:20]),
+		TimebaseNum: binary.LittleEndian.Uint32(buf[20:24]),
+		FrameCount:  binary.LittleEndian.Uint32(buf[24:28]),
+	}
+	if header.TimebaseDen == 0 || header.TimebaseNum == 0 {
+		return nil, fmt.Errorf("invalid IVF timebase %d/%d", header.TimebaseNum, header.TimebaseDen)
+	}
+	return &IVFReader{r: r, header: header}, nil
+}
+
+func (r *IVFReader) Header() IVFHeader {
+	return r.header
+}
+
+// read the next frame, io.EOF after the last one
+func (r *IVFReader) ReadFrame() (*IVFFrame, error) {
+	buf := make([]byte, ivfFrameHeaderSize)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated IVF frame header: %w", err)
+		}
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(buf[0:4])
+	frame := &IVFFrame{
+		PTS:  binary.LittleEndian.Uint64(buf[4:12]),
+		Data: make([]byte, size),
+	}
+	if _, err := io.ReadFull(r.r, frame.Data); err != nil {
+		return nil, fmt.Errorf("truncated IVF frame: %w", err)
+	}
+	return frame, nil
+}
+
+// convert a frame timestamp in timebase units to a duration
+func (h IVFHeader) Timestamp(pts uint64) time.Duration {
+	return time.Duration(float64(pts) * float64(h.TimebaseNum) / float64(h.TimebaseDen) * float64(time.Second))
+}
+
+// check whether a VP8 frame is a key frame: bit 0 of its frame tag is 0 for key frames
+func IsVP8KeyFrame(frame []byte) bool {
+	return len(frame) > 0 && frame[0]&0x01 == 0
+}
+
+// IVFWriter writes frames to an IVF file
+type IVFWriter struct {
+	w      io.Writer
+	header IVFHeader
+	frames uint32
+}
+
+// write the IVF file header, the frame count is updated by Close if w is an io.WriteSeeker
+func NewIVFWriter(w io.Writer, header IVFHeader) (*IVFWriter, error) {
+	if len(header.FourCC) != 4 {
+		return nil, fmt.Errorf("invalid IVF FourCC %q", header.FourCC)
+	}
+	if header.TimebaseDen == 0 || header.TimebaseNum == 0 {
+		return nil, fmt.Errorf("invalid IVF timebase %d/%d", header.TimebaseNum, header.TimebaseDen)
+	}
+	writer := &IVFWriter{w: w, header: header}
+	if _, err := w.Write(writer.headerBytes()); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *IVFWriter) headerBytes() []byte {
+	buf := make([]byte, ivfFileHeaderSize)
+	copy(buf[0:4], ivfSignature)
+	binary.LittleEndian.PutUint16(buf[4:6], 0) // version
+	binary.LittleEndian.PutUint16(buf[6:8], ivfFileHeaderSize)
+	copy(buf[8:12], w.header.FourCC)
+	binary.LittleEndian.PutUint16(buf[12:14], w.header.Width)
+	binary.LittleEndian.PutUint16(buf[14:16], w.header.Height)
+	binary.LittleEndian.PutUint32(buf[16:20], w.header.TimebaseDen)
+	binary.LittleEndian.PutUint32(buf[20:24], w.header.TimebaseNum)
+	binary.LittleEndian.PutUint32(buf[24:28], w.frames)
+	return buf
+}
+
+// append a frame with its timestamp in timebase units
+func (w *IVFWriter) WriteFrame(pts uint64, data []byte) error {
+	buf := make([]byte, ivfFrameHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint64(buf[4:12], pts)
+	copy(buf[ivfFrameHeaderSize:], data)
+	if _, err := w.w.Write(buf); err != nil {
+		return err
+	}
+	w.frames++
+	return nil
+}
+
+// rewrite the header with the number of frames written, the underlying writer is not closed
+func (w *IVFWriter) Close() error {
+	seeker, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := seeker.Write(w.headerBytes()); err != nil {
+		return err
+	}
+	_, err := seeker.Seek(0, io.SeekEnd)
+	return err
+}
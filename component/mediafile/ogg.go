@@ -0,0 +1,312 @@
+package mediafile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	oggCapturePattern      = "OggS"
+	oggPageHeaderSize      = 27
+	oggHeaderTypeContinued = 0x01 // page starts with a packet continued from the previous page
+	oggHeaderTypeBegin     = 0x02 // first page of a logical bitstream
+	oggHeaderTypeEnd       = 0x04 // last page of a logical bitstream
+	oggMaxSegmentsPerPage  = 255
+	opusSampleRate         = 48000
+	opusDefaultPreSkip     = 3840 // 80 ms, recommended by RFC 7845 when the encoder's delay is unknown
+)
+
+// OggPacket is one packet of the first logical bitstream of an Ogg file
+type OggPacket struct {
+	Data            []byte
+	GranulePosition int64 // of the page the packet ends on, -1 if no packet ends on that page
+}
+
+// OggReader reads the packets of the first logical bitstream of an Ogg file, pages of other bitstreams are skipped
+type OggReader struct {
+	r       io.Reader
+	serial  uint32
+	started bool
+	pending [][]byte // complete packets of the current page not returned yet
+	partial []byte   // packet continued on the next page
+	granule int64
+}
+
+func NewOggReader(r io.Reader) *OggReader {
+	return &OggReader{r: r}
+}
+
+// read the next packet, io.EOF after the last one
+func (r *OggReader) ReadPacket() (*OggPacket, error) {
+	for len(r.pending) == 0 {
+		if err := r.readPage(); err != nil {
+			return nil, err
+		}
+	}
+	packet := &OggPacket{Data: r.pending[0], GranulePosition: r.granule}
+	r.pending = r.pending[1:]
+	return packet, nil
+}
+
+func (r *OggReader) readPage() error {
+	header := make([]byte, oggPageHeaderSize)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("truncated Ogg page header: %w", err)
+		}
+		return err
+	}
+	if string(header[0:4]) != oggCapturePattern {
+		return errors.New("not an Ogg page: missing OggS capture pattern")
+	}
+	headerType := header[5]
+	granule := int64(binary.LittleEndian.Uint64(header[6:14]))
+	serial := binary.LittleEndian.Uint32(header[14:18])
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r.r, segments); err != nil {
+		return fmt.Errorf("truncated Ogg segment table: %w", err)
+	}
+	size := 0
+	for _, lacing := range segments {
+		size += int(lacing)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return fmt.Errorf("truncated Ogg page: %w", err)
+	}
+
+	if !r.started {
+		if headerType&oggHeaderTypeBegin == 0 {
+			return errors.New("Ogg stream doesn't start with a beginning of stream page")
+		}
+		r.serial = serial
+		r.started = true
+	}
+	if serial != r.serial {
+		return nil // other logical bitstream
+	}
+
+	// a lacing value below 255 ends a packet, 255 continues it in the next segment
+	offset := 0
+	for _, lacing := range segments {
+		r.partial = append(r.partial, body[offset:offset+int(lacing)]...)
+		offset += int(lacing)
+		if lacing < 255 {
+			r.pending = append(r.pending, r.partial)
+			r.partial = nil
+		}
+	}
+	r.granule = granule
+	return nil
+}
+
+// OggWriter writes packets as one logical bitstream of an Ogg file, each packet on its own page(s). The last packet is held
+// back until the next one or Close, so it can be written on the end of stream page.
+type OggWriter struct {
+	w        io.Writer
+	serial   uint32
+	sequence uint32
+	started  bool
+	held     []byte
+	granule  int64
+	holding  bool
+}
+
+func NewOggWriter(w io.Writer, serial uint32) *OggWriter {
+	return &OggWriter{w: w, serial: serial}
+}
+
+// append a packet with the granule position of its last sample
+func (w *OggWriter) WritePacket(packet []byte, granule int64) error {
+	if w.holding {
+		if err := w.writePacket(w.held, w.granule, false); err != nil {
+			return err
+		}
+	}
+	w.held = append([]byte{}, packet...)
+	w.granule = granule
+	w.holding = true
+	return nil
+}
+
+// write the held back packet on the end of stream page, the underlying writer is not closed
+func (w *OggWriter) Close() error {
+	if !w.holding {
+		return nil
+	}
+	w.holding = false
+	return w.writePacket(w.held, w.granule, true)
+}
+
+// write a packet on as many pages as its lacing values need
+func (w *OggWriter) writePacket(packet []byte, granule int64, last bool) error {
+	lacing := make([]byte, 0, len(packet)/255+1)
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, 255)
+	}
+
+	offset := 0
+	for first := true; len(lacing) > 0; first = false {
+		segments := lacing
+		if len(segments) > oggMaxSegmentsPerPage {
+			segments = segments[:oggMaxSegmentsPerPage]
+		}
+		lacing = lacing[len(segments):]
+		size := 0
+		for _, l := range segments {
+			size += int(l)
+		}
+
+		var headerType byte
+		if !first {
+			headerType |= oggHeaderTypeContinued
+		}
+		if !w.started {
+			headerType |= oggHeaderTypeBegin
+			w.started = true
+		}
+		pageGranule := int64(-1) // no packet ends on this page
+		if len(lacing) == 0 {
+			pageGranule = granule
+			if last {
+				headerType |= oggHeaderTypeEnd
+			}
+		}
+
+		page := make([]byte, oggPageHeaderSize+len(segments)+size)
+		copy(page[0:4], oggCapturePattern)
+		page[4] = 0 // version
+		page[5] = headerType
+		binary.LittleEndian.PutUint64(page[6:14], uint64(pageGranule))
+		binary.LittleEndian.PutUint32(page[14:18], w.serial)
+		binary.LittleEndian.PutUint32(page[18:22], w.sequence)
+		page[26] = byte(len(segments))
+		copy(page[oggPageHeaderSize:], segments)
+		copy(page[oggPageHeaderSize+len(segments):], packet[offset:offset+size])
+		binary.LittleEndian.PutUint32(page[22:26], oggCRC(page))
+		offset += size
+		w.sequence++
+
+		if _, err := w.w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CRC-32 of an Ogg page (polynomial 0x04c11db7, not reflected), computed with the checksum field zeroed
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// OpusHead is the identification header of an Ogg Opus stream (RFC 7845)
+type OpusHead struct {
+	Channels        uint8
+	PreSkip         uint16
+	InputSampleRate uint32 // of the original audio, Opus always decodes at 48 kHz
+}
+
+// parse the first packet of an Ogg Opus stream
+func ParseOpusHead(packet []byte) (*OpusHead, error) {
+	if len(packet) < 19 || string(packet[0:8]) != "OpusHead" {
+		return nil, errors.New("not an OpusHead packet")
+	}
+	head := &OpusHead{
+		Channels:        packet[9],
+		PreSkip:         binary.LittleEndian.Uint16(packet[10:12]),
+		InputSampleRate: binary.LittleEndian.Uint32(packet[12:16]),
+	}
+	if head.Channels == 0 {
+		return nil, errors.New("OpusHead with 0 channels")
+	}
+	return head, nil
+}
+
+// build the OpusHead packet of a mono or stereo stream (channel mapping family 0)
+func OpusHeadPacket(channels uint8, inputSampleRate uint32) []byte {
+	packet := make([]byte, 19)
+	copy(packet[0:8], "OpusHead")
+	packet[8] = 1 // version
+	packet[9] = channels
+	binary.LittleEndian.PutUint16(packet[10:12], opusDefaultPreSkip)
+	binary.LittleEndian.PutUint32(packet[12:16], inputSampleRate)
+	return packet
+}
+
+// build an OpusTags packet with the vendor string and no user comments
+func OpusTagsPacket(vendor string) []byte {
+	packet := make([]byte, 8+4+len(vendor)+4)
+	copy(packet[0:8], "OpusTags")
+	binary.LittleEndian.PutUint32(packet[8:12], uint32(len(vendor)))
+	copy(packet[12:], vendor)
+	return packet
+}
+
+// granule position after the given duration of Opus audio, in 48 kHz samples including the pre-skip
+func OpusGranule(duration time.Duration) int64 {
+	return opusDefaultPreSkip + int64(duration)*opusSampleRate/int64(time.Second)
+}
+
+// check whether a packet is the OpusTags comment header
+func IsOpusTags(packet []byte) bool {
+	return len(packet) >= 8 && string(packet[0:8]) == "OpusTags"
+}
+
+// frame durations of the Opus configurations (RFC 6716, section 3.1), by config number
+var opusFrameDurations = [32]time.Duration{
+	10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond, // SILK NB
+	10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond, // SILK MB
+	10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond, // SILK WB
+	10 * time.Millisecond, 20 * time.Millisecond, // Hybrid SWB
+	10 * time.Millisecond, 20 * time.Millisecond, // Hybrid FB
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, // CELT NB
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, // CELT WB
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, // CELT SWB
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, // CELT FB
+}
+
+// duration of the audio in an Opus packet, from its TOC byte & frame count
+func OpusPacketDuration(packet []byte) (time.Duration, error) {
+	if len(packet) == 0 {
+		return 0, errors.New("empty Opus packet")
+	}
+	toc := packet[0]
+	frames := 1
+	switch toc & 0x03 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, errors.New("Opus packet without frame count byte")
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	return time.Duration(frames) * opusFrameDurations[toc>>3], nil
+}
@@ -0,0 +1,90 @@
+package metatrack
+
+import (
+	"context"
+	"moqlivestream/utilities"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+var log = utilities.NewCustomLogger()
+
+// Writer writes the versions of a meta track (channel directory, catalog) to one audience's local track. Each version is the
+// only object of its group and supersedes the previous ones, so a version not written yet is dropped once a newer one is queued.
+// Writes happen on the Writer's own goroutine, a slow audience doesn't hold up the publisher.
+type Writer struct {
+	local   *moqtransport.LocalTrack
+	groupID uint64
+	pending []byte // latest version not written yet
+	notify  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	mutex   sync.Mutex
+}
+
+func NewWriter(local *moqtransport.LocalTrack) *Writer {
+	w := &Writer{
+		local:  local,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *Writer) LocalTrack() *moqtransport.LocalTrack {
+	return w.local
+}
+
+// queue a version as the only object of group groupID
+func (w *Writer) Write(groupID uint64, payload []byte) {
+	w.mutex.Lock()
+	w.groupID = groupID
+	w.pending = payload
+	w.mutex.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default: // already notified, the writer picks up the latest version
+	}
+}
+
+// stop writing, a write in progress is canceled
+func (w *Writer) Close() {
+	w.once.Do(func() { close(w.done) })
+}
+
+func (w *Writer) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.notify:
+		}
+
+		w.mutex.Lock()
+		groupID, payload := w.groupID, w.pending
+		w.pending = nil
+		w.mutex.Unlock()
+		if payload == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-w.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err := w.local.WriteObject(ctx, moqtransport.Object{GroupID: groupID, ObjectID: 0, PublisherPriority: 0, ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream, Payload: payload})
+		cancel()
+		if err != nil {
+			log.Printf("❌ error writing group %d to meta track %s/%s: %s", groupID, w.local.Namespace, w.local.Name, err)
+			continue
+		}
+		log.Printf("📦 Meta Object written to track %s/%s: GroupID: %v, Payload: %v bytes", w.local.Namespace, w.local.Name, groupID, len(payload))
+	}
+}
@@ -0,0 +1,167 @@
+package payload
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// LOC header extension IDs (draft-ietf-moq-loc), even IDs carry a varint, odd IDs a length prefixed byte string
+const (
+	locCaptureTimestamp  = 0x02 // µs since the Unix epoch
+	locVideoFrameMarking = 0x04 // RFC 9626 frame marking
+	locAudioLevel        = 0x06 // RFC 6464 audio level
+	locVideoConfig       = 0x0d // codec extradata, e.g. avcC
+)
+
+// MoQT draft-05 objects have no extension headers, LOC objects carry theirs in front of the payload with the encoding of
+// later drafts' object extension headers:
+//
+//	extensionCount(i) | [headerType(i) | headerValue(i) or headerLength(i) headerValue(..)]... | media payload
+//
+// The media payload is the codec bitstream as WebCodecs outputs it, without the chunk framing.
+
+// FrameMarking is the LOC video frame marking header extension, the first byte of RFC 9626 frame marking
+type FrameMarking struct {
+	Start         bool // first packet of the frame
+	End           bool // last packet of the frame
+	Independent   bool // decodable without prior frames, i.e. a key frame
+	Discardable   bool // no other frame depends on this one
+	BaseLayerSync bool
+	TemporalID    uint8 // 0-7
+}
+
+func (f FrameMarking) value() uint64 {
+	var b uint64
+	for i, set := range []bool{f.Start, f.End, f.Independent, f.Discardable, f.BaseLayerSync} {
+		if set {
+			b |= 0x80 >> i
+		}
+	}
+	return b | uint64(f.TemporalID&0x07)
+}
+
+func parseFrameMarking(v uint64) FrameMarking {
+	return FrameMarking{
+		Start:         v&0x80 != 0,
+		End:           v&0x40 != 0,
+		Independent:   v&0x20 != 0,
+		Discardable:   v&0x10 != 0,
+		BaseLayerSync: v&0x08 != 0,
+		TemporalID:    uint8(v & 0x07),
+	}
+}
+
+// AudioLevel is the LOC audio level header extension, formatted as the RFC 6464 header extension byte
+type AudioLevel struct {
+	VoiceActivity bool
+	Level         uint8 // -dBov, 0 (loudest) to 127 (silence)
+}
+
+func (a AudioLevel) value() uint64 {
+	v := uint64(a.Level & 0x7f)
+	if a.VoiceActivity {
+		v |= 0x80
+	}
+	return v
+}
+
+// encode a chunk as LOC object, the Timestamp becomes the capture timestamp and is relative to the Unix epoch.
+// Video chunks without FrameMarking are marked as complete frames, independent if Key is set.
+func encodeLOC(c *Chunk) ([]byte, error) {
+	if _, err := c.Type.headerSize(); err != nil {
+		return nil, err
+	}
+	if c.Timestamp < 0 {
+		return nil, fmt.Errorf("negative LOC capture timestamp %s", c.Timestamp)
+	}
+
+	count := uint64(1)
+	extensions := appendLOCVarint(nil, locCaptureTimestamp, uint64(c.Timestamp.Microseconds()))
+	if c.IsVideo() {
+		marking := FrameMarking{Start: true, End: true, Independent: c.Key}
+		if c.FrameMarking != nil {
+			marking = *c.FrameMarking
+		}
+		extensions = appendLOCVarint(extensions, locVideoFrameMarking, marking.value())
+		count++
+		if len(c.VideoConfig) > 0 {
+			extensions = quicvarint.Append(extensions, locVideoConfig)
+			extensions = quicvarint.Append(extensions, uint64(len(c.VideoConfig)))
+			extensions = append(extensions, c.VideoConfig...)
+			count++
+		}
+	}
+	if c.IsAudio() && c.AudioLevel != nil {
+		extensions = appendLOCVarint(extensions, locAudioLevel, c.AudioLevel.value())
+		count++
+	}
+
+	buf := quicvarint.Append(make([]byte, 0, 1+len(extensions)+len(c.Data)), count)
+	buf = append(buf, extensions...)
+	return append(buf, c.Data...), nil
+}
+
+func appendLOCVarint(b []byte, id uint64, value uint64) []byte {
+	return quicvarint.Append(quicvarint.Append(b, id), value)
+}
+
+// parse a LOC object of a track of the given chunk type, unknown header extensions are skipped.
+// Video chunks are key if their frame marking says independent, audio chunks always are. The Timestamp is 0 without
+// capture timestamp.
+func decodeLOC(t ChunkType, payload []byte) (*Chunk, error) {
+	if _, err := t.headerSize(); err != nil {
+		return nil, err
+	}
+	count, n, err := quicvarint.Parse(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: LOC extension count", ErrTruncated)
+	}
+	offset := n
+
+	c := &Chunk{Type: t, Key: t == ChunkTypeAudio}
+	for i := uint64(0); i < count; i++ {
+		id, n, err := quicvarint.Parse(payload[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: LOC extension %d", ErrTruncated, i)
+		}
+		offset += n
+		value, n, err := quicvarint.Parse(payload[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: LOC extension 0x%x", ErrTruncated, id)
+		}
+		offset += n
+
+		if id%2 == 1 { // value is the length of a byte string
+			if value > uint64(len(payload)-offset) {
+				return nil, fmt.Errorf("%w: LOC extension 0x%x of %d bytes", ErrTruncated, id, value)
+			}
+			if id == locVideoConfig {
+				c.VideoConfig = payload[offset : offset+int(value)]
+			}
+			offset += int(value)
+			continue
+		}
+		switch id {
+		case locCaptureTimestamp:
+			if value > uint64(maxTimestampMicroseconds) {
+				return nil, fmt.Errorf("LOC capture timestamp %d out of range", value)
+			}
+			c.Timestamp = time.Duration(value) * time.Microsecond
+		case locVideoFrameMarking:
+			marking := parseFrameMarking(value)
+			c.FrameMarking = &marking
+			if t == ChunkTypeVideo {
+				c.Key = marking.Independent
+			}
+		case locAudioLevel:
+			c.AudioLevel = &AudioLevel{VoiceActivity: value&0x80 != 0, Level: uint8(value & 0x7f)}
+		}
+	}
+	c.Data = payload[offset:]
+	return c, nil
+}
+
+// largest capture timestamp a time.Duration can hold
+const maxTimestampMicroseconds = int64(1<<63-1) / int64(time.Microsecond)
@@ -0,0 +1,162 @@
+package payload
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func TestLOCRoundTrip(t *testing.T) {
+	capture := 1721049000123456 * time.Microsecond
+	tests := []struct {
+		name  string
+		chunk Chunk
+		want  Chunk
+	}{
+		{
+			"video key",
+			Chunk{Type: ChunkTypeVideo, Key: true, Timestamp: capture, Data: []byte{1, 2, 3}},
+			Chunk{Type: ChunkTypeVideo, Key: true, Timestamp: capture, Data: []byte{1, 2, 3},
+				FrameMarking: &FrameMarking{Start: true, End: true, Independent: true}},
+		},
+		{
+			"video delta with marking & config",
+			Chunk{Type: ChunkTypeVideo, Timestamp: capture, Data: []byte{4},
+				FrameMarking: &FrameMarking{Start: true, Discardable: true, TemporalID: 2}, VideoConfig: []byte{0x01, 0x64}},
+			Chunk{Type: ChunkTypeVideo, Timestamp: capture, Data: []byte{4},
+				FrameMarking: &FrameMarking{Start: true, Discardable: true, TemporalID: 2}, VideoConfig: []byte{0x01, 0x64}},
+		},
+		{
+			// the frame marking decides whether the chunk is key, not the Key field
+			"video marking independent",
+			Chunk{Type: ChunkTypeVideo, Timestamp: capture, FrameMarking: &FrameMarking{Independent: true, BaseLayerSync: true}},
+			Chunk{Type: ChunkTypeVideo, Key: true, Timestamp: capture, FrameMarking: &FrameMarking{Independent: true, BaseLayerSync: true}},
+		},
+		{
+			// audio chunks are always key and LOC doesn't carry their duration
+			"audio with level",
+			Chunk{Type: ChunkTypeAudio, Timestamp: capture, Duration: 20 * time.Millisecond, Data: []byte{5},
+				AudioLevel: &AudioLevel{VoiceActivity: true, Level: 30}},
+			Chunk{Type: ChunkTypeAudio, Key: true, Timestamp: capture, Data: []byte{5},
+				AudioLevel: &AudioLevel{VoiceActivity: true, Level: 30}},
+		},
+		{
+			"audio without level",
+			Chunk{Type: ChunkTypeAudio, Timestamp: capture, Data: []byte{6, 7}},
+			Chunk{Type: ChunkTypeAudio, Key: true, Timestamp: capture, Data: []byte{6, 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeObject(PackagingLOC, &tt.chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := DecodeObject(PackagingLOC, tt.chunk.Kind(), b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.Data) == 0 && len(tt.want.Data) == 0 {
+				c.Data = tt.want.Data
+			}
+			if !reflect.DeepEqual(*c, tt.want) {
+				t.Errorf("decoded %+v, want %+v", *c, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLOC(t *testing.T) {
+	// build a LOC object from its extensions & media payload
+	object := func(count uint64, extensions []byte, data ...byte) []byte {
+		return append(append(quicvarint.Append(nil, count), extensions...), data...)
+	}
+	varint := func(id, value uint64) []byte {
+		return appendLOCVarint(nil, id, value)
+	}
+	bytestring := func(id uint64, value ...byte) []byte {
+		b := quicvarint.Append(quicvarint.Append(nil, id), uint64(len(value)))
+		return append(b, value...)
+	}
+
+	tests := []struct {
+		name    string
+		kind    string
+		payload []byte
+		want    *Chunk
+		err     error
+	}{
+		{
+			name:    "no extensions",
+			kind:    "video",
+			payload: object(0, nil, 9),
+			want:    &Chunk{Type: ChunkTypeVideo, Data: []byte{9}},
+		},
+		{
+			name:    "unknown extensions skipped",
+			kind:    "audio",
+			payload: object(3, append(append(varint(0x20, 7), bytestring(0x21, 1, 2, 3)...), varint(locCaptureTimestamp, 40)...), 9),
+			want:    &Chunk{Type: ChunkTypeAudio, Key: true, Timestamp: 40 * time.Microsecond, Data: []byte{9}},
+		},
+		{
+			name:    "frame marking on audio track ignored for key",
+			kind:    "audio",
+			payload: object(1, varint(locVideoFrameMarking, 0xc0)),
+			want:    &Chunk{Type: ChunkTypeAudio, Key: true, FrameMarking: &FrameMarking{Start: true, End: true}, Data: []byte{}},
+		},
+		{name: "empty", kind: "video", payload: nil, err: ErrTruncated},
+		{name: "missing extension", kind: "video", payload: object(2, varint(locCaptureTimestamp, 1)), err: ErrTruncated},
+		{name: "missing extension value", kind: "video", payload: object(1, quicvarint.Append(nil, locCaptureTimestamp)), err: ErrTruncated},
+		{name: "byte string past the end", kind: "video", payload: object(1, bytestring(locVideoConfig, 1, 2)[:3]), err: ErrTruncated},
+		{name: "unknown kind", kind: "text", payload: object(0, nil), err: ErrUnknownType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := DecodeObject(PackagingLOC, tt.kind, tt.payload)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c, tt.want) {
+				t.Errorf("decoded %+v, want %+v", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeLOCErrors(t *testing.T) {
+	if _, err := EncodeObject(PackagingLOC, &Chunk{Type: ChunkTypeVideo, Timestamp: -time.Second}); err == nil {
+		t.Error("encoded a negative capture timestamp")
+	}
+	if _, err := EncodeObject(PackagingLOC, &Chunk{Type: 5}); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownType)
+	}
+}
+
+func TestFrameMarkingValue(t *testing.T) {
+	tests := []struct {
+		marking FrameMarking
+		value   uint64
+	}{
+		{FrameMarking{}, 0x00},
+		{FrameMarking{Start: true, End: true, Independent: true}, 0xe0},
+		{FrameMarking{Discardable: true, BaseLayerSync: true, TemporalID: 7}, 0x1f},
+		{FrameMarking{Start: true, TemporalID: 9}, 0x81}, // only 3 bits of temporal ID
+	}
+	for _, tt := range tests {
+		if v := tt.marking.value(); v != tt.value {
+			t.Errorf("%+v: value 0x%02x, want 0x%02x", tt.marking, v, tt.value)
+		}
+	}
+	if v := (AudioLevel{VoiceActivity: true, Level: 200}).value(); v != 0xc8 { // only 7 bits of level
+		t.Errorf("audio level value 0x%02x, want 0xc8", v)
+	}
+}
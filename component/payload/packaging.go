@@ -0,0 +1,59 @@
+package payload
+
+import "fmt"
+
+// packagings of the catalog's packaging field
+const (
+	PackagingChunk = "chunk" // the streamer-app's framing, see Encode
+	PackagingLOC   = "loc"
+)
+
+// chunk type of a catalog track kind, "video" or "audio"
+func ChunkTypeOf(kind string) (ChunkType, error) {
+	switch kind {
+	case "video":
+		return ChunkTypeVideo, nil
+	case "audio":
+		return ChunkTypeAudio, nil
+	}
+	return 0, fmt.Errorf("%w: track kind %q", ErrUnknownType, kind)
+}
+
+// check whether objects of the packaging can be encoded & decoded
+func Supported(packaging string) bool {
+	return packaging == PackagingChunk || packaging == PackagingLOC
+}
+
+// encode a chunk as object payload in the packaging of its track
+func EncodeObject(packaging string, c *Chunk) ([]byte, error) {
+	switch packaging {
+	case PackagingChunk:
+		return Encode(c)
+	case PackagingLOC:
+		return encodeLOC(c)
+	}
+	return nil, fmt.Errorf("packaging %q not supported", packaging)
+}
+
+// decode the object payload of a track with the given packaging & kind. The chunk framing carries its own type, which
+// has to match the track's kind.
+func DecodeObject(packaging string, kind string, payload []byte) (*Chunk, error) {
+	t, err := ChunkTypeOf(kind)
+	if err != nil {
+		return nil, err
+	}
+	switch packaging {
+	case PackagingChunk:
+		c, err := Decode(payload)
+		if err != nil {
+			return nil, err
+		}
+		if c.Type != t {
+			return nil, fmt.Errorf("%s chunk on a %s track", c.Type, kind)
+		}
+		return c, nil
+	case PackagingLOC:
+		return decodeLOC(t, payload)
+	}
+	return nil, fmt.Errorf("packaging %q not supported", packaging)
+}
@@ -0,0 +1,154 @@
+// Package payload encodes & decodes object payloads in the packagings a catalog track can name:
+//
+// "chunk" is the framing of the streamer-app's serializeEncodedChunk, all numbers little endian and totalLength counting
+// the whole payload including itself:
+//
+//	totalLength(u32) | chunkType(u8, 1 video, 0 audio) | key(u8, 1 key, 0 delta) | timestamp(f64, µs) | [duration(f64, µs), audio only] | data
+//
+// "loc" is the Low Overhead Media Container of the MoQ drafts, see loc.go.
+package payload
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type ChunkType uint8
+
+const (
+	ChunkTypeAudio ChunkType = 0
+	ChunkTypeVideo ChunkType = 1
+)
+
+// header sizes by chunk type, audio chunks carry a duration after the timestamp
+const (
+	VideoHeaderSize = 4 + 1 + 1 + 8
+	AudioHeaderSize = VideoHeaderSize + 8
+)
+
+var (
+	ErrTruncated       = errors.New("payload shorter than its chunk header")
+	ErrLengthMismatch  = errors.New("totalLength doesn't match the payload size")
+	ErrUnknownType     = errors.New("unknown chunk type")
+	ErrPayloadTooLarge = errors.New("chunk too large for its totalLength")
+)
+
+// media kind of the chunk type as used by catalog tracks: "video", "audio" or "" for an unknown type
+func (t ChunkType) String() string {
+	switch t {
+	case ChunkTypeVideo:
+		return "video"
+	case ChunkTypeAudio:
+		return "audio"
+	}
+	return ""
+}
+
+func (t ChunkType) headerSize() (int, error) {
+	switch t {
+	case ChunkTypeVideo:
+		return VideoHeaderSize, nil
+	case ChunkTypeAudio:
+		return AudioHeaderSize, nil
+	}
+	return 0, fmt.Errorf("%w %d", ErrUnknownType, t)
+}
+
+// Chunk is an encoded audio or video chunk carried by one object
+type Chunk struct {
+	Type      ChunkType
+	Key       bool          // key frame, audio chunks are always key
+	Timestamp time.Duration // presentation timestamp set by the encoder, LOC: capture time since the Unix epoch
+	Duration  time.Duration // audio only, not carried by LOC
+	Data      []byte
+
+	// LOC header extensions, not carried by the chunk framing
+	FrameMarking *FrameMarking // video only
+	AudioLevel   *AudioLevel   // audio only
+	VideoConfig  []byte        // video only, codec extradata
+}
+
+func (c *Chunk) IsVideo() bool {
+	return c.Type == ChunkTypeVideo
+}
+
+func (c *Chunk) IsAudio() bool {
+	return c.Type == ChunkTypeAudio
+}
+
+func (c *Chunk) IsKey() bool {
+	return c.Key
+}
+
+func (c *Chunk) IsDelta() bool {
+	return !c.Key
+}
+
+// "video" or "audio"
+func (c *Chunk) Kind() string {
+	return c.Type.String()
+}
+
+// frame a chunk into an object payload
+func Encode(c *Chunk) ([]byte, error) {
+	headerSize, err := c.Type.headerSize()
+	if err != nil {
+		return nil, err
+	}
+	totalLength := headerSize + len(c.Data)
+	if uint64(totalLength) > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrPayloadTooLarge, totalLength)
+	}
+
+	buf := make([]byte, totalLength)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(totalLength))
+	buf[4] = byte(c.Type)
+	if c.Key {
+		buf[5] = 1
+	}
+	binary.LittleEndian.PutUint64(buf[6:14], math.Float64bits(microseconds(c.Timestamp)))
+	if c.Type == ChunkTypeAudio {
+		binary.LittleEndian.PutUint64(buf[14:22], math.Float64bits(microseconds(c.Duration)))
+	}
+	copy(buf[headerSize:], c.Data)
+	return buf, nil
+}
+
+// parse an object payload, totalLength has to match its size. Data refers to the payload, it isn't copied.
+func Decode(payload []byte) (*Chunk, error) {
+	if len(payload) < VideoHeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTruncated, len(payload))
+	}
+	if totalLength := binary.LittleEndian.Uint32(payload[0:4]); uint64(totalLength) != uint64(len(payload)) {
+		return nil, fmt.Errorf("%w: totalLength %d, payload %d bytes", ErrLengthMismatch, totalLength, len(payload))
+	}
+	c := &Chunk{
+		Type:      ChunkType(payload[4]),
+		Key:       payload[5] == 1,
+		Timestamp: fromMicroseconds(math.Float64frombits(binary.LittleEndian.Uint64(payload[6:14]))),
+	}
+	headerSize, err := c.Type.headerSize()
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < headerSize {
+		return nil, fmt.Errorf("%w: %d bytes of %s chunk", ErrTruncated, len(payload), c.Type)
+	}
+	if c.Type == ChunkTypeAudio {
+		c.Duration = fromMicroseconds(math.Float64frombits(binary.LittleEndian.Uint64(payload[14:22])))
+	}
+	c.Data = payload[headerSize:]
+	return c, nil
+}
+
+// timestamps & durations are whole µs in float64, as WebCodecs reports them
+func microseconds(d time.Duration) float64 {
+	return float64(d.Microseconds())
+}
+
+func fromMicroseconds(us float64) time.Duration {
+	return time.Duration(math.Round(us * float64(time.Microsecond)))
+}
@@ -0,0 +1,103 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk Chunk
+		size  int
+	}{
+		{"video key", Chunk{Type: ChunkTypeVideo, Key: true, Timestamp: 33366 * time.Microsecond, Data: []byte{1, 2, 3}}, VideoHeaderSize + 3},
+		{"video delta", Chunk{Type: ChunkTypeVideo, Timestamp: 5 * time.Second, Data: []byte{4}}, VideoHeaderSize + 1},
+		{"video empty", Chunk{Type: ChunkTypeVideo, Key: true}, VideoHeaderSize},
+		{"audio", Chunk{Type: ChunkTypeAudio, Key: true, Timestamp: 20 * time.Millisecond, Duration: 20 * time.Millisecond, Data: []byte{5, 6}}, AudioHeaderSize + 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Encode(&tt.chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != tt.size {
+				t.Fatalf("encoded %d bytes, want %d", len(b), tt.size)
+			}
+			if totalLength := binary.LittleEndian.Uint32(b[0:4]); int(totalLength) != tt.size {
+				t.Errorf("totalLength %d, want %d", totalLength, tt.size)
+			}
+
+			c, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Type != tt.chunk.Type || c.Key != tt.chunk.Key || c.Timestamp != tt.chunk.Timestamp ||
+				c.Duration != tt.chunk.Duration || !bytes.Equal(c.Data, tt.chunk.Data) {
+				t.Errorf("decoded %+v, want %+v", c, tt.chunk)
+			}
+		})
+	}
+}
+
+func TestEncodeUnknownType(t *testing.T) {
+	if _, err := Encode(&Chunk{Type: 2}); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownType)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	video, err := Encode(&Chunk{Type: ChunkTypeVideo, Data: []byte{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := Encode(&Chunk{Type: ChunkTypeAudio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := bytes.Clone(video)
+	unknown[4] = 7
+	// a 14 byte audio chunk passes the video header check but lacks its duration
+	shortAudio := bytes.Clone(audio[:VideoHeaderSize])
+	binary.LittleEndian.PutUint32(shortAudio[0:4], VideoHeaderSize)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		err     error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"truncated header", video[:VideoHeaderSize-1], ErrTruncated},
+		{"truncated data", video[:len(video)-1], ErrLengthMismatch},
+		{"trailing bytes", append(bytes.Clone(video), 0), ErrLengthMismatch},
+		{"unknown type", unknown, ErrUnknownType},
+		{"audio without duration", shortAudio, ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.payload); !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeObjectKindMismatch(t *testing.T) {
+	b, err := EncodeObject(PackagingChunk, &Chunk{Type: ChunkTypeAudio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeObject(PackagingChunk, "video", b); err == nil {
+		t.Error("decoded an audio chunk on a video track")
+	}
+	if _, err := DecodeObject(PackagingChunk, "audio", b); err != nil {
+		t.Error(err)
+	}
+	if _, err := DecodeObject("cmaf", "audio", b); err == nil {
+		t.Error("decoded an unsupported packaging")
+	}
+}
@@ -3,10 +3,12 @@ module moqlivestream
 go 1.22.3
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/google/uuid v1.6.0
 	github.com/mengelbart/moqtransport v0.3.1-0.20240715134205-0c18f3a3b439
 	github.com/quic-go/quic-go v0.46.0
 	github.com/quic-go/webtransport-go v0.8.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,116 @@
+package adaptation
+
+import "time"
+
+// most sent packets remembered until acked or lost, bounds the memory of a connection's estimator
+const maxTrackedPackets = 4096
+
+// BandwidthEstimator estimates the available bandwidth of a connection from the delivery rate of its acked packets, as
+// BBR does: every acked packet yields a sample of the bytes delivered while it was in flight over the time it was in
+// flight, the estimate is the max sample of the window. Samples of packets sent while the congestion window wasn't
+// filled are application limited and only raise the estimate, since a live stream rarely fills the window.
+// Not safe for concurrent use, the tracer calls it with its mutex held.
+type BandwidthEstimator struct {
+	sent          map[int64]sentPacket // by packet number
+	delivered     int64                // bytes acked over the connection's lifetime
+	deliveredTime time.Time            // time delivered last increased
+	firstSentTime time.Time            // send time of the packet most recently acked, start of the current send interval
+	appLimited    bool                 // the congestion window isn't filled, set from the latest metrics update
+	maxRate       windowedFilter       // bytes/s
+	minRTT        windowedFilter       // µs
+}
+
+// state of the connection when a packet was sent
+type sentPacket struct {
+	size          int64
+	sentTime      time.Time
+	delivered     int64
+	deliveredTime time.Time
+	firstSentTime time.Time
+	appLimited    bool
+}
+
+// estimate over the given window, e.g. 10s
+func NewBandwidthEstimator(window time.Duration) *BandwidthEstimator {
+	return &BandwidthEstimator{
+		sent:    map[int64]sentPacket{},
+		maxRate: newMaxFilter(window),
+		minRTT:  newMinFilter(window),
+	}
+}
+
+// remember an ack-eliciting packet until it is acked or lost
+func (e *BandwidthEstimator) OnPacketSent(pn int64, size int64, now time.Time) {
+	if len(e.sent) == 0 { // nothing in flight, a new send interval starts
+		e.firstSentTime = now
+		e.deliveredTime = now
+	}
+	if len(e.sent) >= maxTrackedPackets {
+		e.prune(now)
+	}
+	e.sent[pn] = sentPacket{
+		size:          size,
+		sentTime:      now,
+		delivered:     e.delivered,
+		deliveredTime: e.deliveredTime,
+		firstSentTime: e.firstSentTime,
+		appLimited:    e.appLimited,
+	}
+}
+
+// take a delivery rate sample from an acked packet
+func (e *BandwidthEstimator) OnPacketAcked(pn int64, now time.Time) {
+	p, ok := e.sent[pn]
+	if !ok {
+		return
+	}
+	delete(e.sent, pn)
+	e.delivered += p.size
+	e.deliveredTime = now
+	e.firstSentTime = p.sentTime
+
+	// the longer of the send and the ack interval, so ack compression doesn't inflate the rate
+	interval := max(p.sentTime.Sub(p.firstSentTime), now.Sub(p.deliveredTime))
+	if interval <= 0 {
+		return
+	}
+	rate := float64(e.delivered-p.delivered) / interval.Seconds()
+	if p.appLimited && rate < e.maxRate.get() {
+		return
+	}
+	e.maxRate.update(now, rate)
+}
+
+func (e *BandwidthEstimator) OnPacketLost(pn int64) {
+	delete(e.sent, pn)
+}
+
+// feed the connection's state from a metrics update
+func (e *BandwidthEstimator) OnMetricsUpdated(latestRTT time.Duration, cwnd, bytesInFlight int64, now time.Time) {
+	e.appLimited = bytesInFlight < cwnd
+	if latestRTT > 0 {
+		e.minRTT.update(now, float64(latestRTT.Microseconds()))
+	}
+}
+
+// estimated available bandwidth in bits/s, comparable with catalog bitrates, 0 before the first sample
+func (e *BandwidthEstimator) Bandwidth() int64 {
+	return int64(e.maxRate.get() * 8)
+}
+
+// min rtt of the window, 0 before the first sample
+func (e *BandwidthEstimator) MinRTT() time.Duration {
+	return time.Duration(e.minRTT.get()) * time.Microsecond
+}
+
+// forget packets that can't be in flight anymore, or all if that isn't enough
+func (e *BandwidthEstimator) prune(now time.Time) {
+	for pn, p := range e.sent {
+		if now.Sub(p.sentTime) > e.maxRate.window {
+			delete(e.sent, pn)
+		}
+	}
+	if len(e.sent) >= maxTrackedPackets {
+		clear(e.sent)
+	}
+}
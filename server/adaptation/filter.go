@@ -0,0 +1,71 @@
+package adaptation
+
+import "time"
+
+// windowedFilter tracks the max (or min) of a value over a sliding time window in constant memory, keeping the best,
+// second best and third best sample of successive sub-windows (Kathleen Nichols' algorithm, as in BBR's minmax)
+type windowedFilter struct {
+	window  time.Duration
+	max     bool // max filter if set, min filter otherwise
+	samples [3]filterSample
+}
+
+type filterSample struct {
+	time  time.Time
+	value float64
+}
+
+func newMaxFilter(window time.Duration) windowedFilter {
+	return windowedFilter{window: window, max: true}
+}
+
+func newMinFilter(window time.Duration) windowedFilter {
+	return windowedFilter{window: window}
+}
+
+// whether a is at least as good as b
+func (f *windowedFilter) better(a, b float64) bool {
+	if f.max {
+		return a >= b
+	}
+	return a <= b
+}
+
+// best value of the window, 0 before the first sample
+func (f *windowedFilter) get() float64 {
+	return f.samples[0].value
+}
+
+func (f *windowedFilter) reset(s filterSample) {
+	f.samples = [3]filterSample{s, s, s}
+}
+
+// add a sample and return the best value of the window
+func (f *windowedFilter) update(t time.Time, value float64) float64 {
+	s := filterSample{time: t, value: value}
+	if f.samples[0].time.IsZero() || f.better(value, f.samples[0].value) || t.Sub(f.samples[2].time) > f.window {
+		f.reset(s)
+		return value
+	}
+
+	if f.better(value, f.samples[1].value) {
+		f.samples[1], f.samples[2] = s, s
+	} else if f.better(value, f.samples[2].value) {
+		f.samples[2] = s
+	}
+
+	// expire the best sample once it left the window, promote the sub-window bests
+	elapsed := t.Sub(f.samples[0].time)
+	switch {
+	case elapsed > f.window:
+		f.samples[0], f.samples[1], f.samples[2] = f.samples[1], f.samples[2], s
+		if t.Sub(f.samples[0].time) > f.window {
+			f.samples[0], f.samples[1], f.samples[2] = f.samples[1], f.samples[2], s
+		}
+	case f.samples[1].time.Equal(f.samples[0].time) && elapsed > f.window/4:
+		f.samples[1], f.samples[2] = s, s
+	case f.samples[2].time.Equal(f.samples[1].time) && elapsed > f.window/2:
+		f.samples[2] = s
+	}
+	return f.samples[0].value
+}
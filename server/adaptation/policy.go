@@ -0,0 +1,262 @@
+package adaptation
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Decision is what a RateAdaptationPolicy wants done with a connection's rendition
+type Decision int
+
+const (
+	Hold Decision = iota // keep the current rendition
+	Up                   // switch to a higher rendition
+	Down                 // switch to a lower rendition
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Hold:
+		return "hold"
+	case Up:
+		return "up"
+	case Down:
+		return "down"
+	}
+	return fmt.Sprintf("unknown(%d)", int(d))
+}
+
+// Metrics is a snapshot of one connection, taken by its tracer on a metrics update of the QUIC connection at most once
+// per check interval
+type Metrics struct {
+	Time               time.Time
+	ConnectionStart    time.Time
+	DropRate           float64       // receiver side, dropped / received packets since the last up or down decision
+	RetransmissionRate float64       // sender side, lost / sent packets since the last up or down decision
+	SmoothedRTT        time.Duration // 0 before the first rtt sample
+	RTTVariance        float64       // EMA variance of the smoothed rtt, µs²
+	CongestionWindow   int64         // bytes
+	BytesInFlight      int64
+	Bandwidth          int64         // estimated available bandwidth in bits/s, 0 until estimated
+	MinRTT             time.Duration // min rtt of the bandwidth estimator's window
+	Bitrate            int           // catalog bitrate of the current rendition in bits/s, 0 if unknown
+	UpBitrate          int           // catalog bitrate of the next higher rendition in bits/s, 0 if none
+	Rendition          int           // position of the audience's track in its rendition ladder, 0 is the best
+	Renditions         int           // number of renditions in the ladder, 0 if unknown
+	LastSwitch         time.Time     // time of the last rendition switch, zero if none yet
+}
+
+// whether there is a higher rendition to switch to
+func (m Metrics) CanUp() bool {
+	return m.Rendition > 0
+}
+
+// whether there is a lower rendition to switch to
+func (m Metrics) CanDown() bool {
+	return m.Rendition < m.Renditions-1
+}
+
+// RateAdaptationPolicy decides per Metrics snapshot whether a connection switches rendition. A policy instance belongs to
+// one connection and may keep state between calls, Decide is never called concurrently for the same instance.
+type RateAdaptationPolicy interface {
+	Name() string
+	Decide(m Metrics) Decision
+}
+
+// policy names accepted in Config.Policy
+const (
+	PolicyNone        = "none"         // never switch
+	PolicyLoss        = "loss"         // adapt down on drop or retransmission rate above threshold
+	PolicyRTTVariance = "rtt-variance" // adapt down on rtt EMA variance above threshold, minimum dwell time
+	PolicyHysteresis  = "hysteresis"   // loss & rtt variance, separate up/down thresholds, minimum dwell time and up-probing
+	PolicyBandwidth   = "bandwidth"    // keep the rendition bitrate within the estimated bandwidth
+)
+
+type Config struct {
+	Policy                      string
+	DropRateThreshold           float64
+	RetransmissionRateThreshold float64
+	RTTVarianceThreshold        float64
+	UpThresholdRatio            float64       // hysteresis: share of the down thresholds metrics must stay below to probe up
+	MinDwell                    time.Duration // hysteresis, bandwidth & rtt-variance: minimum time on a rendition before switching again
+	ProbeInterval               time.Duration // hysteresis: time metrics must stay below the up thresholds before probing up
+	MaxProbeInterval            time.Duration // hysteresis: upper bound of the probe interval backoff after failed probes
+	BandwidthHeadroom           float64       // bandwidth: share of the estimated bandwidth a higher rendition may use
+}
+
+// all policy names, for help texts & validation
+func Policies() []string {
+	return []string{PolicyNone, PolicyLoss, PolicyRTTVariance, PolicyHysteresis, PolicyBandwidth}
+}
+
+// create a policy instance for one connection
+func New(cfg Config) (RateAdaptationPolicy, error) {
+	switch cfg.Policy {
+	case PolicyNone:
+		return nonePolicy{}, nil
+	case PolicyLoss:
+		return &lossPolicy{cfg: cfg}, nil
+	case PolicyRTTVariance:
+		if cfg.MinDwell < 0 {
+			return nil, fmt.Errorf("min dwell %v must not be negative", cfg.MinDwell)
+		}
+		return &rttVariancePolicy{cfg: cfg}, nil
+	case PolicyHysteresis:
+		if cfg.UpThresholdRatio <= 0 || cfg.UpThresholdRatio >= 1 {
+			return nil, fmt.Errorf("up threshold ratio %v not in (0, 1)", cfg.UpThresholdRatio)
+		}
+		if cfg.ProbeInterval <= 0 || cfg.MaxProbeInterval < cfg.ProbeInterval {
+			return nil, fmt.Errorf("probe interval %v must be positive and at most the max probe interval %v", cfg.ProbeInterval, cfg.MaxProbeInterval)
+		}
+		if cfg.MinDwell < 0 {
+			return nil, fmt.Errorf("min dwell %v must not be negative", cfg.MinDwell)
+		}
+		return &hysteresisPolicy{cfg: cfg, probeInterval: cfg.ProbeInterval}, nil
+	case PolicyBandwidth:
+		if cfg.BandwidthHeadroom <= 0 || cfg.BandwidthHeadroom > 1 {
+			return nil, fmt.Errorf("bandwidth headroom %v not in (0, 1]", cfg.BandwidthHeadroom)
+		}
+		if cfg.MinDwell < 0 {
+			return nil, fmt.Errorf("min dwell %v must not be negative", cfg.MinDwell)
+		}
+		return &bandwidthPolicy{cfg: cfg}, nil
+	}
+	return nil, fmt.Errorf("unknown rate adaptation policy %q, one of %v", cfg.Policy, Policies())
+}
+
+type nonePolicy struct{}
+
+func (nonePolicy) Name() string            { return PolicyNone }
+func (nonePolicy) Decide(Metrics) Decision { return Hold }
+
+// the tracer's original heuristic: adapt down once the drop or retransmission rate exceeds its threshold, never up
+type lossPolicy struct {
+	cfg Config
+}
+
+func (p *lossPolicy) Name() string { return PolicyLoss }
+
+func (p *lossPolicy) Decide(m Metrics) Decision {
+	if !m.CanDown() {
+		return Hold
+	}
+	if m.DropRate > p.cfg.DropRateThreshold || m.RetransmissionRate > p.cfg.RetransmissionRateThreshold {
+		return Down
+	}
+	return Hold
+}
+
+// adapt down once the rtt fluctuates, the EMA variance check of the tracer's fluctuation methods, never up. The tracer
+// restarts the variance on a switch, which lets it build up again within MinDwell before the next switch down.
+type rttVariancePolicy struct {
+	cfg Config
+}
+
+func (p *rttVariancePolicy) Name() string { return PolicyRTTVariance }
+
+func (p *rttVariancePolicy) Decide(m Metrics) Decision {
+	if !m.CanDown() {
+		return Hold
+	}
+	if !m.LastSwitch.IsZero() && m.Time.Sub(m.LastSwitch) < p.cfg.MinDwell {
+		return Hold
+	}
+	if m.RTTVariance > p.cfg.RTTVarianceThreshold {
+		return Down
+	}
+	return Hold
+}
+
+// combines the loss & rtt variance heuristics, walking the rendition ladder one step at a time:
+//   - down once any metric exceeds its threshold, up only after all stayed below UpThresholdRatio of it for the probe interval
+//   - no switch within MinDwell of the last one, except falling back right after a failed probe
+//   - a probe is failed if it is followed by a down within the probe interval, which doubles the probe interval up to
+//     MaxProbeInterval, a successful one resets it
+type hysteresisPolicy struct {
+	cfg           Config
+	calmSince     time.Time // metrics below the up thresholds since, zero if not
+	probeInterval time.Duration
+	probeTime     time.Time // time of the last up decision, zero if none pending
+}
+
+func (p *hysteresisPolicy) Name() string { return PolicyHysteresis }
+
+func (p *hysteresisPolicy) Decide(m Metrics) Decision {
+	congested := m.DropRate > p.cfg.DropRateThreshold ||
+		m.RetransmissionRate > p.cfg.RetransmissionRateThreshold ||
+		m.RTTVariance > p.cfg.RTTVarianceThreshold
+	calm := m.DropRate <= p.cfg.DropRateThreshold*p.cfg.UpThresholdRatio &&
+		m.RetransmissionRate <= p.cfg.RetransmissionRateThreshold*p.cfg.UpThresholdRatio &&
+		m.RTTVariance <= p.cfg.RTTVarianceThreshold*p.cfg.UpThresholdRatio
+	if !calm {
+		p.calmSince = time.Time{}
+	} else if p.calmSince.IsZero() {
+		p.calmSince = m.Time
+	}
+
+	probing := !p.probeTime.IsZero() && m.Time.Sub(p.probeTime) < p.probeInterval
+	if !probing && !p.probeTime.IsZero() { // probe survived a whole probe interval
+		p.probeTime = time.Time{}
+		p.probeInterval = p.cfg.ProbeInterval
+	}
+	dwelled := m.LastSwitch.IsZero() || m.Time.Sub(m.LastSwitch) >= p.cfg.MinDwell
+
+	switch {
+	case congested && m.CanDown() && probing:
+		p.probeTime = time.Time{}
+		p.probeInterval = min(2*p.probeInterval, p.cfg.MaxProbeInterval)
+		p.calmSince = time.Time{}
+		return Down
+	case congested && m.CanDown() && dwelled:
+		return Down
+	case m.CanUp() && calm && dwelled && !probing && m.Time.Sub(p.calmSince) >= p.probeInterval:
+		p.probeTime = m.Time
+		return Up
+	}
+	return Hold
+}
+
+// compare the estimated bandwidth with the catalog bitrates: down once the current rendition's bitrate exceeds the
+// estimate, up once the next higher one fits into BandwidthHeadroom of it, at most once per MinDwell
+type bandwidthPolicy struct {
+	cfg Config
+}
+
+func (p *bandwidthPolicy) Name() string { return PolicyBandwidth }
+
+func (p *bandwidthPolicy) Decide(m Metrics) Decision {
+	if m.Bandwidth == 0 || m.Bitrate == 0 {
+		return Hold
+	}
+	if !m.LastSwitch.IsZero() && m.Time.Sub(m.LastSwitch) < p.cfg.MinDwell {
+		return Hold
+	}
+	switch {
+	case m.CanDown() && int64(m.Bitrate) > m.Bandwidth:
+		return Down
+	case m.CanUp() && m.UpBitrate > 0 && float64(m.UpBitrate) <= float64(m.Bandwidth)*p.cfg.BandwidthHeadroom:
+		return Up
+	}
+	return Hold
+}
+
+// rendition switches done on all connections of the process
+var switches struct {
+	up, down atomic.Uint64
+}
+
+// count a rendition switch that was carried out
+func CountSwitch(d Decision) {
+	switch d {
+	case Up:
+		switches.up.Add(1)
+	case Down:
+		switches.down.Add(1)
+	}
+}
+
+// get the number of rendition switches up & down so far
+func SwitchCounts() (up uint64, down uint64) {
+	return switches.up.Load(), switches.down.Load()
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"moqlivestream/server/config"
+	"moqlivestream/server/webtransportserver"
+	"moqlivestream/utilities"
+)
+
+var log = utilities.NewCustomLogger()
+
+// Server is the admin listener of a moq-live-stream server, plain HTTP meant for the testbed's local network
+type Server struct {
+	wt    *webtransportserver.Server
+	http  *http.Server
+	token string // bearer token of every request, empty on a loopback listener without token
+}
+
+// admin listener of cfg, config.Validate ensures it has a token unless it listens on loopback
+func NewServer(cfg config.AdminConfig, wt *webtransportserver.Server) *Server {
+	s := &Server{wt: wt, token: cfg.Token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", s.handleMetrics) // Prometheus text format
+	s.registerAPI(mux)                              // JSON API under /api
+	s.http = &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           s.requireToken(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// listen until the admin server is closed
+func (s *Server) ListenAndServe() error {
+	log.Printf("🛠️ admin listener on %s, token required: %t", s.http.Addr, s.token != "")
+	if err := s.http.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Close() error {
+	return s.http.Close()
+}
+
+// reject requests without the admin token as "Authorization: Bearer <token>", Prometheus sends it with its authorization
+// scrape config
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			log.Printf("🔒 admin request %s %s from %s rejected: missing or invalid token", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
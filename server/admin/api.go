@@ -0,0 +1,316 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"moqlivestream/component/audience"
+	"moqlivestream/component/channel"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/server/webtransportserver"
+
+	"github.com/google/uuid"
+)
+
+type channelInfo struct {
+	Name         string           `json:"name"`
+	Live         bool             `json:"live"`
+	StartTime    time.Time        `json:"startTime"`
+	Streamer     string           `json:"streamer,omitempty"` // streamer ID, empty for a mirrored channel of an edge
+	Viewers      int              `json:"viewers"`
+	TrackViewers map[string]int   `json:"trackViewers"`
+	Catalog      *catalog.Catalog `json:"catalog"`
+}
+
+type subscriptionInfo struct {
+	ID        uint64 `json:"id"`
+	Namespace string `json:"namespace"`
+	TrackName string `json:"trackName"`
+}
+
+type connectionInfo struct {
+	ID         string     `json:"id"`
+	RemoteAddr string     `json:"remoteAddr"`
+	StartTime  time.Time  `json:"startTime"`
+	Stats      *statsInfo `json:"stats,omitempty"` // nil if the connection has no tracer
+}
+
+// webtransportserver.ConnectionStats with explicit units
+type statsInfo struct {
+	SmoothedRTTMs    float64 `json:"smoothedRTTMs"`
+	MinRTTMs         float64 `json:"minRTTMs"`
+	CongestionWindow int64   `json:"congestionWindow"`
+	BytesInFlight    int64   `json:"bytesInFlight"`
+	PacketsSent      int64   `json:"packetsSent"`
+	PacketsReceived  int64   `json:"packetsReceived"`
+	PacketsLost      int64   `json:"packetsLost"`
+	PacketsDropped   int64   `json:"packetsDropped"`
+	BytesSent        int64   `json:"bytesSent"`
+	BytesReceived    int64   `json:"bytesReceived"`
+	Bandwidth        int64   `json:"bandwidth"` // bits/s, 0 until estimated
+}
+
+type audienceInfo struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Subscriptions []subscriptionInfo `json:"subscriptions"`
+	Connection    *connectionInfo    `json:"connection,omitempty"`
+}
+
+type streamerInfo struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Channel    string          `json:"channel,omitempty"` // empty until announced
+	Connection *connectionInfo `json:"connection,omitempty"`
+}
+
+type groupInfo struct {
+	GroupID   uint64       `json:"groupID"`
+	Bytes     int          `json:"bytes"`
+	Complete  bool         `json:"complete"`
+	Truncated bool         `json:"truncated"`
+	Objects   []objectInfo `json:"objects"`
+}
+
+type objectInfo struct {
+	ObjectID uint64 `json:"objectID"`
+	Size     int    `json:"size"`
+}
+
+type renditionRequest struct {
+	Track string `json:"track"`
+}
+
+type renditionResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// register the JSON API on the admin mux
+func (s *Server) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/channels", s.handleListChannels)
+	mux.HandleFunc("GET /api/channels/{name}", s.handleGetChannel)
+	mux.HandleFunc("DELETE /api/channels/{name}", s.handleTerminateChannel)
+	mux.HandleFunc("GET /api/channels/{name}/cache", s.handleChannelCache)
+	mux.HandleFunc("GET /api/audiences", s.handleListAudiences)
+	mux.HandleFunc("DELETE /api/audiences/{id}", s.handleKickAudience)
+	mux.HandleFunc("POST /api/audiences/{id}/rendition", s.handleForceRendition)
+	mux.HandleFunc("GET /api/streamers", s.handleListStreamers)
+}
+
+func (s *Server) handleListChannels(w http.ResponseWriter, r *http.Request) {
+	streamers := s.streamersByChannel()
+	channels := []channelInfo{}
+	for _, name := range s.wt.Channels().GetChannelNames() {
+		if ch, err := s.wt.Channels().GetChannelByName(name); err == nil {
+			channels = append(channels, s.newChannelInfo(ch, name, streamers[name]))
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	writeJSON(w, http.StatusOK, channels)
+}
+
+func (s *Server) handleGetChannel(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	ch, err := s.wt.Channels().GetChannelByName(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.newChannelInfo(ch, name, s.streamersByChannel()[name]))
+}
+
+func (s *Server) handleTerminateChannel(w http.ResponseWriter, r *http.Request) {
+	if err := s.wt.TerminateChannel(r.PathValue("name"), "terminated by admin"); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// the groups cached per track, without payloads
+func (s *Server) handleChannelCache(w http.ResponseWriter, r *http.Request) {
+	ch, err := s.wt.Channels().GetChannelByName(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	ch.Mutex.Lock()
+	tracks := sortedKeys(ch.TrackCaches)
+	ch.Mutex.Unlock()
+
+	caches := map[string][]groupInfo{}
+	for _, track := range tracks {
+		groups := []groupInfo{}
+		for _, g := range ch.GetTrackCache(track).Groups() {
+			info := groupInfo{GroupID: g.GroupID, Bytes: g.Bytes, Complete: g.Complete(), Truncated: g.Truncated, Objects: []objectInfo{}}
+			for _, obj := range g.Objects {
+				info.Objects = append(info.Objects, objectInfo{ObjectID: obj.ObjectID, Size: len(obj.Payload)})
+			}
+			groups = append(groups, info)
+		}
+		caches[track] = groups
+	}
+	writeJSON(w, http.StatusOK, caches)
+}
+
+func (s *Server) handleListAudiences(w http.ResponseWriter, r *http.Request) {
+	audiences := []audienceInfo{}
+	for _, name := range s.wt.Audiences().GetAudienceNames() {
+		au, err := s.wt.Audiences().GetAudienceByName(name)
+		if err != nil {
+			continue // removed meanwhile
+		}
+		audiences = append(audiences, audienceInfo{
+			ID:            au.ID.String(),
+			Name:          au.Name,
+			Subscriptions: subscriptionInfos(au),
+			Connection:    s.connectionInfo(au.ID),
+		})
+	}
+	sort.Slice(audiences, func(i, j int) bool { return audiences[i].ID < audiences[j].ID })
+	writeJSON(w, http.StatusOK, audiences)
+}
+
+func (s *Server) handleKickAudience(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.wt.KickAudience(id, "kicked by admin"); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// switch an audience to another rendition of its ladder, body {"track": "<name>"}
+func (s *Server) handleForceRendition(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req renditionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Track == "" {
+		writeError(w, http.StatusBadRequest, errors.New(`body must be {"track": "<name>"}`))
+		return
+	}
+	from, err := s.wt.ForceRendition(id, req.Track)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, renditionResponse{From: from, To: req.Track})
+}
+
+func (s *Server) handleListStreamers(w http.ResponseWriter, r *http.Request) {
+	streamers := []streamerInfo{}
+	for _, c := range s.wt.Connections().List() {
+		if c.Streamer == nil {
+			continue
+		}
+		info := streamerInfo{ID: c.Streamer.ID.String(), Name: c.Streamer.Name, Connection: newConnectionInfo(c)}
+		if c.Streamer.Channel != nil {
+			info.Channel = c.Streamer.Channel.Name
+		}
+		streamers = append(streamers, info)
+	}
+	sort.Slice(streamers, func(i, j int) bool { return streamers[i].ID < streamers[j].ID })
+	writeJSON(w, http.StatusOK, streamers)
+}
+
+// name as looked up, the Channel's fields are only safe to read under the channel manager's lock
+func (s *Server) newChannelInfo(ch *channel.Channel, name string, streamer string) channelInfo {
+	trackViewers, viewers := ch.Viewers()
+	return channelInfo{
+		Name:         name,
+		Live:         ch.Live(),
+		StartTime:    s.wt.Channels().ChannelStartTime(ch),
+		Streamer:     streamer,
+		Viewers:      viewers,
+		TrackViewers: trackViewers,
+		Catalog:      ch.GetCatalog(),
+	}
+}
+
+// streamer IDs by the name of their channel
+func (s *Server) streamersByChannel() map[string]string {
+	streamers := map[string]string{}
+	for _, c := range s.wt.Connections().List() {
+		if c.Streamer != nil && c.Streamer.Channel != nil {
+			streamers[c.Streamer.Channel.Name] = c.Streamer.ID.String()
+		}
+	}
+	return streamers
+}
+
+// connection of a streamer or audience, nil if its session isn't bound to one
+func (s *Server) connectionInfo(peerID uuid.UUID) *connectionInfo {
+	c, ok := s.wt.Connections().GetByPeer(peerID)
+	if !ok {
+		return nil
+	}
+	return newConnectionInfo(c)
+}
+
+func newConnectionInfo(c webtransportserver.Connection) *connectionInfo {
+	info := &connectionInfo{ID: c.ID, StartTime: c.StartTime}
+	if c.RemoteAddr != nil {
+		info.RemoteAddr = c.RemoteAddr.String()
+	}
+	if c.Tracer != nil {
+		st := c.Tracer.Stats()
+		info.Stats = &statsInfo{
+			SmoothedRTTMs:    float64(st.SmoothedRTT.Microseconds()) / 1000,
+			MinRTTMs:         float64(st.MinRTT.Microseconds()) / 1000,
+			CongestionWindow: st.CongestionWindow,
+			BytesInFlight:    st.BytesInFlight,
+			PacketsSent:      st.PacketsSent,
+			PacketsReceived:  st.PacketsReceived,
+			PacketsLost:      st.PacketsLost,
+			PacketsDropped:   st.PacketsDropped,
+			BytesSent:        st.BytesSent,
+			BytesReceived:    st.BytesReceived,
+			Bandwidth:        st.Bandwidth,
+		}
+	}
+	return info
+}
+
+func subscriptionInfos(au *audience.Audience) []subscriptionInfo {
+	subs := []subscriptionInfo{}
+	for _, sub := range au.ListSubscriptions() {
+		subs = append(subs, subscriptionInfo{ID: sub.ID, Namespace: sub.Namespace, TrackName: sub.TrackName})
+	}
+	return subs
+}
+
+// HTTP status of a control action's error
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, webtransportserver.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, webtransportserver.ErrNotPossible):
+		return http.StatusConflict
+	case errors.Is(err, webtransportserver.ErrInvalidInput):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("❌ error writing admin response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,261 @@
+package admin
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"moqlivestream/component/channel"
+	"moqlivestream/component/channel/sendqueue"
+	"moqlivestream/component/forwarding"
+	"moqlivestream/server/adaptation"
+	"moqlivestream/server/webtransportserver"
+)
+
+// metricsWriter writes metric families in the Prometheus text exposition format (version 0.0.4)
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// start a metric family, its samples must follow before the next family
+func (w *metricsWriter) family(name string, kind string, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// write a sample, labels are name & value pairs
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// state of an announced channel, collected before writing so every family lists all channels
+type channelMetrics struct {
+	name         string
+	live         bool
+	viewers      int
+	trackViewers map[string]int
+	forwarded    map[string]channel.ForwardStats
+	queues       map[string]map[string]sendqueue.Stats // by track & audience ID
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	channels := s.collectChannels()
+	connections := s.wt.Connections().List()
+	sort.Slice(connections, func(i, j int) bool { return connections[i].ID < connections[j].ID })
+
+	m := &metricsWriter{}
+
+	m.family("moq_channels_live", "gauge", "Number of announced channels whose streamer or upstream is live.")
+	live := 0
+	for _, ch := range channels {
+		if ch.live {
+			live++
+		}
+	}
+	m.sample("moq_channels_live", float64(live))
+
+	m.family("moq_channel_live", "gauge", "Whether an announced channel is live.")
+	for _, ch := range channels {
+		m.sample("moq_channel_live", boolValue(ch.live), "channel", ch.name)
+	}
+
+	m.family("moq_channel_viewers", "gauge", "Distinct audiences watching any track of a channel.")
+	for _, ch := range channels {
+		m.sample("moq_channel_viewers", float64(ch.viewers), "channel", ch.name)
+	}
+
+	m.family("moq_track_audiences", "gauge", "Audiences subscribed to a track.")
+	for _, ch := range channels {
+		for _, track := range sortedKeys(ch.trackViewers) {
+			m.sample("moq_track_audiences", float64(ch.trackViewers[track]), "channel", ch.name, "track", track)
+		}
+	}
+
+	m.family("moq_track_objects_forwarded_total", "counter", "Objects received on a track and forwarded to its audiences.")
+	for _, ch := range channels {
+		for _, track := range sortedKeys(ch.forwarded) {
+			m.sample("moq_track_objects_forwarded_total", float64(ch.forwarded[track].Objects), "channel", ch.name, "track", track)
+		}
+	}
+
+	m.family("moq_track_bytes_forwarded_total", "counter", "Object payload bytes received on a track and forwarded to its audiences.")
+	for _, ch := range channels {
+		for _, track := range sortedKeys(ch.forwarded) {
+			m.sample("moq_track_bytes_forwarded_total", float64(ch.forwarded[track].Bytes), "channel", ch.name, "track", track)
+		}
+	}
+
+	m.family("moq_send_queue_depth", "gauge", "Objects waiting in an audience's send queue of a track.")
+	for _, ch := range channels {
+		for _, track := range sortedKeys(ch.queues) {
+			for _, au := range sortedKeys(ch.queues[track]) {
+				m.sample("moq_send_queue_depth", float64(ch.queues[track][au].Queued), "channel", ch.name, "track", track, "audience", au)
+			}
+		}
+	}
+
+	m.family("moq_send_queue_dropped_objects_total", "counter", "Objects dropped by an audience's send queue of a track.")
+	for _, ch := range channels {
+		for _, track := range sortedKeys(ch.queues) {
+			for _, au := range sortedKeys(ch.queues[track]) {
+				m.sample("moq_send_queue_dropped_objects_total", float64(ch.queues[track][au].DroppedObjects), "channel", ch.name, "track", track, "audience", au)
+			}
+		}
+	}
+
+	totals := sendqueue.TotalStats()
+	m.family("moq_send_queue_objects_total", "counter", "Objects handled by all send queues of the process, closed ones included.")
+	m.sample("moq_send_queue_objects_total", float64(totals.Enqueued), "result", "enqueued")
+	m.sample("moq_send_queue_objects_total", float64(totals.Sent), "result", "sent")
+	m.sample("moq_send_queue_objects_total", float64(totals.DroppedObjects), "result", "dropped")
+
+	m.family("moq_send_queue_overflows_total", "counter", "Overflow policy activations of all send queues of the process.")
+	m.sample("moq_send_queue_overflows_total", float64(totals.DroppedGroups), "policy", sendqueue.DropOldestGroup.String())
+	m.sample("moq_send_queue_overflows_total", float64(totals.KeyFrameWaits), "policy", sendqueue.DropUntilKeyFrame.String())
+	m.sample("moq_send_queue_overflows_total", float64(totals.Disconnects), "policy", sendqueue.Disconnect.String())
+
+	forwarded := forwarding.TotalStats()
+	m.family("moq_datagrams_total", "counter", "Objects forwarded as datagrams, and the ones the connection couldn't send.")
+	m.sample("moq_datagrams_total", float64(forwarded.Datagrams), "result", "sent")
+	m.sample("moq_datagrams_total", float64(forwarded.DroppedDatagrams), "result", "dropped")
+	m.family("moq_late_objects_total", "counter", "Objects of a group dropped because the stream of the next group had started.")
+	m.sample("moq_late_objects_total", float64(forwarded.LateObjects))
+	m.family("moq_failed_streams_total", "counter", "Streams the connection couldn't open or write, e.g. once the session ended, their objects dropped.")
+	m.sample("moq_failed_streams_total", float64(forwarded.FailedStreams))
+
+	up, down := adaptation.SwitchCounts()
+	m.family("moq_rate_adaptation_switches_total", "counter", "Rendition switches done by the server side rate adaptation.")
+	m.sample("moq_rate_adaptation_switches_total", float64(up), "direction", "up")
+	m.sample("moq_rate_adaptation_switches_total", float64(down), "direction", "down")
+
+	m.family("moq_connections", "gauge", "Open QUIC connections by the kind of session on them.")
+	kinds := map[string]int{webtransportserver.PeerStreamer: 0, webtransportserver.PeerAudience: 0, "none": 0}
+	for _, c := range connections {
+		kinds[connectionKind(c)]++
+	}
+	for _, kind := range sortedKeys(kinds) {
+		m.sample("moq_connections", float64(kinds[kind]), "kind", kind)
+	}
+
+	s.writeConnections(m, connections)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(m.buf.Bytes()); err != nil {
+		log.Printf("❌ error writing metrics: %v", err)
+	}
+}
+
+// per connection QUIC metrics from the connection tracers
+func (s *Server) writeConnections(m *metricsWriter, connections []webtransportserver.Connection) {
+	stats := make([]webtransportserver.ConnectionStats, len(connections))
+	for i, c := range connections {
+		if c.Tracer != nil {
+			stats[i] = c.Tracer.Stats()
+		}
+	}
+	families := []struct {
+		name, kind, help string
+		value            func(webtransportserver.ConnectionStats) float64
+	}{
+		{"moq_connection_rtt_seconds", "gauge", "Smoothed rtt of a connection.", func(st webtransportserver.ConnectionStats) float64 { return st.SmoothedRTT.Seconds() }},
+		{"moq_connection_min_rtt_seconds", "gauge", "Min rtt of a connection within the bandwidth estimation window.", func(st webtransportserver.ConnectionStats) float64 { return st.MinRTT.Seconds() }},
+		{"moq_connection_cwnd_bytes", "gauge", "Congestion window of a connection.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.CongestionWindow) }},
+		{"moq_connection_bytes_in_flight", "gauge", "Bytes in flight on a connection.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.BytesInFlight) }},
+		{"moq_connection_bandwidth_bits_per_second", "gauge", "Estimated available bandwidth of a connection, 0 until estimated.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.Bandwidth) }},
+		{"moq_connection_packets_sent_total", "counter", "1-RTT packets sent on a connection.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.PacketsSent) }},
+		{"moq_connection_packets_received_total", "counter", "1-RTT packets received on a connection.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.PacketsReceived) }},
+		{"moq_connection_packets_lost_total", "counter", "Packets sent on a connection and declared lost.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.PacketsLost) }},
+		{"moq_connection_packets_dropped_total", "counter", "Packets received on a connection and dropped.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.PacketsDropped) }},
+		{"moq_connection_bytes_sent_total", "counter", "Bytes of 1-RTT packets sent on a connection.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.BytesSent) }},
+		{"moq_connection_bytes_received_total", "counter", "Bytes of 1-RTT packets received on a connection.", func(st webtransportserver.ConnectionStats) float64 { return float64(st.BytesReceived) }},
+	}
+	for _, f := range families {
+		m.family(f.name, f.kind, f.help)
+		for i, c := range connections {
+			if c.Tracer == nil {
+				continue
+			}
+			m.sample(f.name, f.value(stats[i]), "connection", c.ID, "kind", connectionKind(c), "peer", peerID(c))
+		}
+	}
+}
+
+// snapshot the announced channels of the server
+func (s *Server) collectChannels() []channelMetrics {
+	channels := []channelMetrics{}
+	for _, name := range s.wt.Channels().GetChannelNames() {
+		ch, err := s.wt.Channels().GetChannelByName(name)
+		if err != nil || s.wt.Channels().ChannelStartTime(ch).IsZero() {
+			continue // removed meanwhile or not announced yet
+		}
+		trackViewers, viewers := ch.Viewers()
+		queues := map[string]map[string]sendqueue.Stats{}
+		for track, byAudience := range ch.SendQueueStats() {
+			queues[track] = map[string]sendqueue.Stats{}
+			for id, stats := range byAudience {
+				queues[track][id.String()] = stats
+			}
+		}
+		channels = append(channels, channelMetrics{
+			name:         name,
+			live:         ch.Live(),
+			viewers:      viewers,
+			trackViewers: trackViewers,
+			forwarded:    ch.ForwardStats(),
+			queues:       queues,
+		})
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+	return channels
+}
+
+func connectionKind(c webtransportserver.Connection) string {
+	if c.Kind == "" {
+		return "none"
+	}
+	return c.Kind
+}
+
+// ID of the streamer or audience on the connection, empty without session
+func peerID(c webtransportserver.Connection) string {
+	switch {
+	case c.Streamer != nil:
+		return c.Streamer.ID.String()
+	case c.Audience != nil:
+		return c.Audience.ID.String()
+	}
+	return ""
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// prefix of an origin entry that is a regex rather than an exact origin or wildcard
+const RegexPrefix = "regex:"
+
+// OriginPolicy decides which Origin headers a webtransport endpoint accepts. Browsers always send one, native clients
+// like cmd/moq-publish usually don't.
+type OriginPolicy struct {
+	exact        map[string]bool  // lowercased origins, e.g. "https://example.com:8443"
+	wildcards    []string         // lowercased path.Match patterns, e.g. "https://*.example.com"
+	regexps      []*regexp.Regexp // matched against the whole origin
+	any          bool             // "*" allows every origin
+	allowMissing bool
+}
+
+// policy of the allowlist entries: "*", an exact origin like "https://example.com", a wildcard like "https://*.example.com"
+// or "https://localhost:*", or a regex prefixed with "regex:" that must match the whole origin. Exact origins & wildcards
+// are case insensitive. allowMissing accepts requests without Origin header.
+func NewOriginPolicy(entries []string, allowMissing bool) (*OriginPolicy, error) {
+	op := &OriginPolicy{exact: map[string]bool{}, allowMissing: allowMissing}
+	var errs []error
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			errs = append(errs, errors.New("empty origin"))
+		case entry == "*":
+			op.any = true
+		case strings.HasPrefix(entry, RegexPrefix):
+			expr := strings.TrimPrefix(entry, RegexPrefix)
+			if _, err := regexp.Compile(expr); err != nil {
+				errs = append(errs, fmt.Errorf("origin %q: %v", entry, err))
+				continue
+			}
+			op.regexps = append(op.regexps, regexp.MustCompile("^(?:"+expr+")$"))
+		case strings.Contains(entry, "*"):
+			if _, err := path.Match(entry, ""); err != nil {
+				errs = append(errs, fmt.Errorf("origin %q: %v", entry, err))
+				continue
+			}
+			op.wildcards = append(op.wildcards, strings.ToLower(entry))
+		default:
+			u, err := url.Parse(entry)
+			if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+				errs = append(errs, fmt.Errorf("origin %q: must be scheme://host[:port]", entry))
+				continue
+			}
+			op.exact[strings.ToLower(strings.TrimSuffix(entry, "/"))] = true
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// check an Origin header, the error tells why it isn't allowed
+func (op *OriginPolicy) Check(origin string) error {
+	if origin == "" {
+		if op.allowMissing {
+			return nil
+		}
+		return ErrOriginMissing
+	}
+	if op.any {
+		return nil
+	}
+	lower := strings.ToLower(origin)
+	if op.exact[lower] {
+		return nil
+	}
+	for _, pattern := range op.wildcards {
+		if ok, _ := path.Match(pattern, lower); ok {
+			return nil
+		}
+	}
+	for _, re := range op.regexps {
+		if re.MatchString(origin) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrOriginNotAllowed, origin)
+}
+
+// errors of OriginPolicy.Check
+var (
+	ErrOriginMissing    = errors.New("missing Origin header")
+	ErrOriginNotAllowed = errors.New("origin not in allowlist")
+)
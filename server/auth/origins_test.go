@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOriginPolicyCheck(t *testing.T) {
+	op, err := NewOriginPolicy([]string{
+		"https://example.com",
+		" https://Stream.Example.com:8443/ ",
+		"https://*.example.org",
+		"https://localhost:*",
+		`regex:https://(app|studio)-[0-9]+\.example\.net`,
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin string
+		err    error
+	}{
+		{"https://example.com", nil},
+		{"HTTPS://EXAMPLE.COM", nil}, // exact origins are case insensitive
+		{"https://example.com:443", ErrOriginNotAllowed},
+		{"http://example.com", ErrOriginNotAllowed},
+		{"https://evil-example.com", ErrOriginNotAllowed},
+		{"https://stream.example.com:8443", nil}, // trailing "/" & spaces of the entry trimmed
+		{"https://stream.example.com", ErrOriginNotAllowed},
+		{"https://a.example.org", nil},
+		{"https://A.b.Example.org", nil}, // * crosses ".", wildcards are case insensitive
+		{"https://example.org", ErrOriginNotAllowed},
+		{"https://a.example.org.evil.com", ErrOriginNotAllowed},
+		{"https://a.example.org:8443", ErrOriginNotAllowed},
+		{"https://localhost:5173", nil},
+		{"https://localhost", ErrOriginNotAllowed},
+		{"https://app-1.example.net", nil},
+		{"https://studio-42.example.net", nil},
+		{"https://app-1.example.net.evil.com", ErrOriginNotAllowed}, // regexes must match the whole origin
+		{"https://evil.com/https://app-1.example.net", ErrOriginNotAllowed},
+		{"https://appx1.example.net", ErrOriginNotAllowed}, // escaped "." & "-" are literal
+		{"https://APP-1.example.net", ErrOriginNotAllowed}, // regexes are case sensitive
+		{"", ErrOriginMissing},
+	}
+	for _, tt := range tests {
+		if err := op.Check(tt.origin); !errors.Is(err, tt.err) {
+			t.Errorf("Check(%q): got error %v, want %v", tt.origin, err, tt.err)
+		}
+	}
+}
+
+func TestOriginPolicyAnyAndMissing(t *testing.T) {
+	tests := []struct {
+		name         string
+		entries      []string
+		allowMissing bool
+		origin       string
+		err          error
+	}{
+		{"any", []string{"*"}, false, "https://whatever.example", nil},
+		{"any still needs an origin", []string{"*"}, false, "", ErrOriginMissing},
+		{"missing allowed", []string{"https://example.com"}, true, "", nil},
+		{"missing allowed, other origin", []string{"https://example.com"}, true, "https://example.org", ErrOriginNotAllowed},
+		{"empty allowlist", nil, false, "https://example.com", ErrOriginNotAllowed},
+		{"empty allowlist, missing allowed", nil, true, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := NewOriginPolicy(tt.entries, tt.allowMissing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := op.Check(tt.origin); !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewOriginPolicyErrors(t *testing.T) {
+	tests := []struct {
+		entry string
+		err   string
+	}{
+		{"", "empty origin"},
+		{"  ", "empty origin"},
+		{"regex:https://(app", "missing closing )"},
+		{"https://[*.example.com", "syntax error"},
+		{"example.com", "must be scheme://host[:port]"},
+		{"https://example.com/app", "must be scheme://host[:port]"},
+	}
+	for _, tt := range tests {
+		_, err := NewOriginPolicy([]string{"https://example.com", tt.entry}, false)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("entry %q: got error %v, want one containing %q", tt.entry, err, tt.err)
+		}
+	}
+}
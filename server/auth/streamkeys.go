@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// minimum length of a token secret in bytes
+const MinSecretLength = 16
+
+// keys file, e.g. {"keys": [{"key": "s3cret", "channels": ["demo", "lecture-*"]}]}
+type keysFile struct {
+	Keys []struct {
+		Key      string   `json:"key"`
+		Channels []string `json:"channels"` // channel names or patterns, see CheckChannelPatterns
+	} `json:"keys"`
+}
+
+// StreamAuth decides which channels a streamer may ANNOUNCE with its stream key: a key of the local key store or a
+// token signed with the token secret and scoped to streaming. Either may be unset, not both.
+type StreamAuth struct {
+	keys   map[[sha256.Size]byte][]string // channels by key digest, so lookups don't compare the keys themselves
+	secret []byte
+}
+
+// load the key store from keysPath and use secret for tokens, returns nil if both are empty, i.e. streamers aren't authenticated
+func NewStreamAuth(keysPath string, secret string) (*StreamAuth, error) {
+	if keysPath == "" && secret == "" {
+		return nil, nil
+	}
+	if secret != "" && len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("token secret must have at least %d bytes", MinSecretLength)
+	}
+	sa := &StreamAuth{keys: map[[sha256.Size]byte][]string{}, secret: []byte(secret)}
+	if keysPath == "" {
+		return sa, nil
+	}
+
+	data, err := os.ReadFile(keysPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stream keys: %v", err)
+	}
+	file := keysFile{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("error parsing stream keys %s: %v", keysPath, err)
+	}
+	var errs []error
+	for i, k := range file.Keys {
+		if k.Key == "" {
+			errs = append(errs, fmt.Errorf("keys[%d]: empty key", i))
+			continue
+		}
+		if err := CheckChannelPatterns(k.Channels); err != nil {
+			errs = append(errs, fmt.Errorf("keys[%d]: %v", i, err))
+			continue
+		}
+		digest := sha256.Sum256([]byte(k.Key))
+		if _, ok := sa.keys[digest]; ok {
+			errs = append(errs, fmt.Errorf("keys[%d]: duplicate key", i))
+			continue
+		}
+		sa.keys[digest] = k.Channels
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid stream keys %s: %w", keysPath, err)
+	}
+	return sa, nil
+}
+
+// number of keys in the key store
+func (sa *StreamAuth) Keys() int {
+	return len(sa.keys)
+}
+
+// check that key allows publishing channel, a key of the key store takes precedence over a token
+func (sa *StreamAuth) Authorize(key string, channel string, now time.Time) error {
+	if key == "" {
+		return ErrMissingKey
+	}
+	channels, ok := sa.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		if len(sa.secret) == 0 || !strings.Contains(key, ".") {
+			return fmt.Errorf("%w: unknown stream key", ErrInvalidKey)
+		}
+		return authorizeToken(sa.secret, key, ScopeStream, channel, now)
+	}
+	if !matchChannel(channels, channel) {
+		return fmt.Errorf("%w %s", ErrNotAllowed, channel)
+	}
+	return nil
+}
+
+// pattern element matching all channels below a prefix
+const AnyChannel = "**"
+
+// whether a channel name matches one of the patterns, invalid patterns never match
+func matchChannel(patterns []string, channel string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern string, channel string) bool {
+	prefix, below, err := splitPattern(pattern)
+	if err != nil {
+		return false
+	}
+	if !below {
+		ok, _ := path.Match(prefix, channel)
+		return ok
+	}
+	if prefix == "" {
+		return true
+	}
+	// match the prefix against as many elements of the name as it has, at least one has to follow
+	n := strings.Count(prefix, "/") + 1
+	elements := strings.SplitN(channel, "/", n+1)
+	if len(elements) <= n || elements[n] == "" {
+		return false
+	}
+	ok, _ := path.Match(prefix, strings.Join(elements[:n], "/"))
+	return ok
+}
+
+// split a pattern ending in "/**" or being "**" into its prefix and whether it matches the channels below it
+func splitPattern(pattern string) (prefix string, below bool, err error) {
+	prefix = pattern
+	if pattern == AnyChannel {
+		prefix, below = "", true
+	} else if p, ok := strings.CutSuffix(pattern, "/"+AnyChannel); ok {
+		prefix, below = p, true
+	}
+	if strings.Contains(prefix, AnyChannel) {
+		return "", false, fmt.Errorf("%s only allowed as the last element", AnyChannel)
+	}
+	if _, err := path.Match(prefix, ""); err != nil {
+		return "", false, err
+	}
+	return prefix, below, nil
+}
+
+// check the channel patterns of a key or token. A pattern is a channel name or a path.Match pattern, which matches the
+// name as a whole and whose * and ? don't match "/": "lecture-*" matches "lecture-1" but not "lecture-1/q&a". A pattern
+// ending in "/**" matches every channel below its prefix, e.g. "school/*/**" matches "school/math/lecture-1", and "**"
+// alone matches every channel.
+func CheckChannelPatterns(patterns []string) error {
+	if len(patterns) == 0 {
+		return errors.New("no channels")
+	}
+	for _, pattern := range patterns {
+		if _, _, err := splitPattern(pattern); err != nil {
+			return fmt.Errorf("channel pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
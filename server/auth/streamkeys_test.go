@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchChannel(t *testing.T) {
+	tests := []struct {
+		pattern string
+		channel string
+		want    bool
+	}{
+		{"demo", "demo", true},
+		{"demo", "demo2", false},
+		{"lecture-*", "lecture-1", true},
+		{"lecture-*", "lecture-", true},
+		{"lecture-*", "lecture-1/q&a", false}, // * doesn't match "/"
+		{"lecture-?", "lecture-1", true},
+		{"lecture-?", "lecture-10", false},
+		{"*", "demo", true},
+		{"*", "school/math", false},
+		{"school/*", "school/math", true},
+		{"school/*", "school/math/lecture-1", false},
+		{"school/**", "school/math", true},
+		{"school/**", "school/math/lecture-1", true},
+		{"school/**", "school", false}, // only the channels below the prefix
+		{"school/**", "school/", false},
+		{"school/**", "schools/math", false},
+		{"school/*/**", "school/math/lecture-1", true},
+		{"school/*/**", "school/math", false},
+		{"**", "demo", true},
+		{"**", "school/math/lecture-1", true},
+		{"lecture-[0-9]", "lecture-3", true},
+		{"lecture-[", "lecture-[", false}, // invalid patterns never match
+		{"school/**/math", "school/x/math", false},
+		{"lecture-**", "lecture-1", false},
+	}
+	for _, tt := range tests {
+		if got := matchChannel([]string{tt.pattern}, tt.channel); got != tt.want {
+			t.Errorf("pattern %q, channel %q: got %v, want %v", tt.pattern, tt.channel, got, tt.want)
+		}
+	}
+}
+
+func TestCheckChannelPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		err      string
+	}{
+		{[]string{"demo", "lecture-*", "school/**", "**", "school/*/**"}, ""},
+		{nil, "no channels"},
+		{[]string{"demo", "lecture-["}, "syntax error"},
+		{[]string{"school/**/math"}, "only allowed as the last element"},
+		{[]string{"lecture-**"}, "only allowed as the last element"},
+		{[]string{"school/[/**"}, "syntax error"},
+	}
+	for _, tt := range tests {
+		err := CheckChannelPatterns(tt.patterns)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("patterns %q: got error %v, want %q", tt.patterns, err, tt.err)
+		}
+	}
+}
+
+func TestStreamAuth(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	secret := "0123456789abcdef"
+	keysPath := filepath.Join(t.TempDir(), "keys.json")
+	keys := `{"keys": [{"key": "demo-key", "channels": ["demo", "lecture-*"]}, {"key": "school-key", "channels": ["school/**"]}]}`
+	if err := os.WriteFile(keysPath, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := NewStreamAuth(keysPath, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa.Keys() != 2 {
+		t.Fatalf("got %d keys, want 2", sa.Keys())
+	}
+	sign := func(claims Claims) string {
+		token, err := Sign([]byte(secret), claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	hour := now.Add(time.Hour).Unix()
+
+	tests := []struct {
+		name    string
+		key     string
+		channel string
+		err     error
+	}{
+		{"key", "demo-key", "demo", nil},
+		{"key pattern", "demo-key", "lecture-2", nil},
+		{"key other channel", "demo-key", "school/math", ErrNotAllowed},
+		{"key prefix pattern", "school-key", "school/math/lecture-1", nil},
+		{"missing key", "", "demo", ErrMissingKey},
+		{"unknown key", "nope", "demo", ErrInvalidKey},
+		{"token", sign(Claims{Scope: ScopeStream, Channels: []string{"school/**"}, Expiry: hour}), "school/math", nil},
+		{"token other channel", sign(Claims{Scope: ScopeStream, Channels: []string{"demo"}, Expiry: hour}), "lecture-1", ErrNotAllowed},
+		{"token wrong scope", sign(Claims{Scope: ScopeView, Channels: []string{"demo"}, Expiry: hour}), "demo", ErrInvalidKey},
+		{"token expired", sign(Claims{Scope: ScopeStream, Channels: []string{"demo"}, Expiry: now.Unix()}), "demo", ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sa.Authorize(tt.key, tt.channel, now); !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewStreamAuthErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   string
+		secret string
+		err    string
+	}{
+		{"short secret", "", "short", "at least 16 bytes"},
+		{"unknown field", `{"keys": [{"key": "k", "channel": ["demo"]}]}`, "", "unknown field"},
+		{"empty key", `{"keys": [{"key": "", "channels": ["demo"]}]}`, "", "empty key"},
+		{"no channels", `{"keys": [{"key": "k", "channels": []}]}`, "", "no channels"},
+		{"bad pattern", `{"keys": [{"key": "k", "channels": ["a/**/b"]}]}`, "", "only allowed as the last element"},
+		{"duplicate key", `{"keys": [{"key": "k", "channels": ["a"]}, {"key": "k", "channels": ["b"]}]}`, "", "duplicate key"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keysPath := ""
+			if tt.keys != "" {
+				keysPath = filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".json")
+				if err := os.WriteFile(keysPath, []byte(tt.keys), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := NewStreamAuth(keysPath, tt.secret)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+	if sa, err := NewStreamAuth("", ""); sa != nil || err != nil {
+		t.Errorf("got %v, %v without keys & secret, want no stream auth", sa, err)
+	}
+}
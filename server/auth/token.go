@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// token scopes, a token only authorizes what its scope names
+const (
+	ScopeStream = "stream" // publish the token's channels
+	ScopeView   = "view"   // watch the token's private channels
+	ScopeRelay  = "relay"  // an edge following its origin: list & watch every channel
+)
+
+// Claims of a signed token
+type Claims struct {
+	Scope    string   `json:"scope"`
+	Channels []string `json:"channels"` // channel names or patterns, e.g. "lecture-*", see CheckChannelPatterns
+	Expiry   int64    `json:"exp"`      // unix seconds
+}
+
+// sign claims with an HMAC-SHA256 secret: base64url(claims JSON) "." base64url(signature)
+func Sign(secret []byte, claims Claims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature(secret, payload)), nil
+}
+
+// check the signature & expiry of a token and return its claims
+func Verify(secret []byte, token string, now time.Time) (Claims, error) {
+	claims := Claims{}
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, fmt.Errorf("%w: malformed token", ErrInvalidKey)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, signature(secret, payload)) {
+		return claims, fmt.Errorf("%w: bad token signature", ErrInvalidKey)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims, fmt.Errorf("%w: malformed token payload", ErrInvalidKey)
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return claims, fmt.Errorf("%w: malformed token claims", ErrInvalidKey)
+	}
+	if now.Unix() >= claims.Expiry {
+		return claims, fmt.Errorf("%w: token expired at %s", ErrExpired, time.Unix(claims.Expiry, 0).UTC().Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+// verify a token of the scope and check that it is valid for the channel
+func authorizeToken(secret []byte, token string, scope string, channel string, now time.Time) error {
+	claims, err := Verify(secret, token, now)
+	if err != nil {
+		return err
+	}
+	if claims.Scope != scope {
+		return fmt.Errorf("%w: token scope %q", ErrInvalidKey, claims.Scope)
+	}
+	if !matchChannel(claims.Channels, channel) {
+		return fmt.Errorf("%w %s", ErrNotAllowed, channel)
+	}
+	return nil
+}
+
+func signature(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// errors of Authorize & Verify, wrapped with details
+var (
+	ErrMissingKey = errors.New("missing key")
+	ErrInvalidKey = errors.New("invalid key")
+	ErrExpired    = errors.New("expired key")
+	ErrNotAllowed = errors.New("key not allowed for channel")
+)
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	now := time.Unix(1_700_000_000, 0)
+	claims := Claims{Scope: ScopeView, Channels: []string{"demo", "school/**"}, Expiry: now.Add(time.Hour).Unix()}
+	token, err := Sign(secret, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(token, ".")
+	forged, err := Sign([]byte("fedcba9876543210"), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"scope":"stream","channels":["**"],"exp":9999999999}`)) + "." + sig
+
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+		err   error
+	}{
+		{"valid", token, now, nil},
+		{"just before expiry", token, now.Add(time.Hour - time.Second), nil},
+		{"expired", token, now.Add(time.Hour), ErrExpired},
+		{"other secret", forged, now, ErrInvalidKey},
+		{"tampered claims", tampered, now, ErrInvalidKey},
+		{"no signature", payload, now, ErrInvalidKey},
+		{"bad signature encoding", payload + ".!!", now, ErrInvalidKey},
+		{"empty", "", now, ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(secret, tt.token, tt.now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, claims) {
+				t.Errorf("got claims %+v, want %+v", got, claims)
+			}
+		})
+	}
+}
+
+func TestAuthorizeToken(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	now := time.Unix(1_700_000_000, 0)
+	sign := func(scope string, channels ...string) string {
+		token, err := Sign(secret, Claims{Scope: scope, Channels: channels, Expiry: now.Add(time.Minute).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		scope   string
+		channel string
+		err     error
+	}{
+		{"stream", sign(ScopeStream, "demo"), ScopeStream, "demo", nil},
+		{"view pattern", sign(ScopeView, "lecture-*"), ScopeView, "lecture-1", nil},
+		{"view prefix", sign(ScopeView, "school/**"), ScopeView, "school/math/lecture-1", nil},
+		{"stream token to view", sign(ScopeStream, "demo"), ScopeView, "demo", ErrInvalidKey},
+		{"view token to stream", sign(ScopeView, "demo"), ScopeStream, "demo", ErrInvalidKey},
+		{"relay token to stream", sign(ScopeRelay, AnyChannel), ScopeStream, "demo", ErrInvalidKey},
+		{"other channel", sign(ScopeView, "demo"), ScopeView, "demo2", ErrNotAllowed},
+		{"star doesn't cross /", sign(ScopeView, "school/*"), ScopeView, "school/math/lecture-1", ErrNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := authorizeToken(secret, tt.token, tt.scope, tt.channel, now); !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
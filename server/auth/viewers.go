@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+)
+
+// lifetime of the relay token an edge presents when connecting to its origin, it is only checked then
+const relayTokenTTL = time.Minute
+
+// ViewerAuth checks the viewer tokens audiences present for private channels, and the relay tokens of edges
+type ViewerAuth struct {
+	secret []byte
+}
+
+// viewer tokens signed with secret, returns nil if secret is empty, i.e. private channels can't be watched
+func NewViewerAuth(secret string) (*ViewerAuth, error) {
+	if secret == "" {
+		return nil, nil
+	}
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("token secret must have at least %d bytes", MinSecretLength)
+	}
+	return &ViewerAuth{secret: []byte(secret)}, nil
+}
+
+// check that token allows watching the private channel
+func (va *ViewerAuth) Authorize(token string, channel string, now time.Time) error {
+	if token == "" {
+		return ErrMissingKey
+	}
+	return authorizeToken(va.secret, token, ScopeView, channel, now)
+}
+
+// whether token is a valid relay token, granting an edge every channel
+func (va *ViewerAuth) Relay(token string, now time.Time) bool {
+	return token != "" && authorizeToken(va.secret, token, ScopeRelay, "*", now) == nil
+}
+
+// sign a short-lived relay token for an edge connecting to an origin with the same secret
+func (va *ViewerAuth) RelayToken(now time.Time) (string, error) {
+	return Sign(va.secret, Claims{Scope: ScopeRelay, Channels: []string{AnyChannel}, Expiry: now.Add(relayTokenTTL).Unix()})
+}
@@ -0,0 +1,590 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"moqlivestream/component/channel/sendqueue"
+	"moqlivestream/component/forwarding"
+	"moqlivestream/server/adaptation"
+	"moqlivestream/server/auth"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// server configuration, precedence (lowest to highest): defaults < config file < env vars < command line flags
+type Config struct {
+	ListenAddr string           `json:"listenAddr"` // host:port of the webtransport listener
+	TLS        TLSConfig        `json:"tls"`
+	Log        LogConfig        `json:"log"`
+	Origin     OriginConfig     `json:"origin"`
+	Adaptation AdaptationConfig `json:"adaptation"`
+	SendQueue  SendQueueConfig  `json:"sendQueue"`
+	Forwarding ForwardingConfig `json:"forwarding"`
+	GroupCache GroupCacheConfig `json:"groupCache"`
+	Upstream   UpstreamConfig   `json:"upstream"`
+	Relay      RelayConfig      `json:"relay"`
+	Admin      AdminConfig      `json:"admin"`
+	Auth       AuthConfig       `json:"auth"`
+}
+
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+type LogConfig struct {
+	QlogDir    string `json:"qlogDir"`    // qlog output, exported as QLOGDIR
+	MetricsDir string `json:"metricsDir"` // per-connection tracer logs
+}
+
+// Origin headers allowed per webtransport endpoint, entries are exact origins, wildcards or regexes, see auth.NewOriginPolicy
+type OriginConfig struct {
+	Streamer     []string `json:"streamer"`     // allowlist of /webtransport/streamer
+	Audience     []string `json:"audience"`     // allowlist of /webtransport/audience
+	AllowMissing bool     `json:"allowMissing"` // accept requests without Origin header, i.e. native clients & edges
+}
+
+// policy & thresholds of the server side rate adaptation, evaluated by the connection tracer
+type AdaptationConfig struct {
+	Policy                      string   `json:"policy"`                      // none | loss | rtt-variance | hysteresis | bandwidth
+	DropRateThreshold           float64  `json:"dropRateThreshold"`           // adapt down when receiver side drop rate exceeds it
+	RetransmissionRateThreshold float64  `json:"retransmissionRateThreshold"` // adapt down when sender side retransmission rate exceeds it
+	RTTVarianceThreshold        float64  `json:"rttVarianceThreshold"`        // EMA variance of rtt (µs²) considered as fluctuation
+	CheckInterval               Duration `json:"checkInterval"`               // interval of fluctuation & bandwidth checks
+	Alpha                       float64  `json:"alpha"`                       // EMA smoothing factor, 0 < alpha < 1
+	UpThresholdRatio            float64  `json:"upThresholdRatio"`            // hysteresis: share of the down thresholds to stay below before probing up
+	MinDwell                    Duration `json:"minDwell"`                    // hysteresis, bandwidth & rtt-variance: minimum time between two rendition switches
+	ProbeInterval               Duration `json:"probeInterval"`               // hysteresis: calm time before probing up, doubled after a failed probe
+	MaxProbeInterval            Duration `json:"maxProbeInterval"`            // hysteresis: upper bound of the probe interval
+	BandwidthWindow             Duration `json:"bandwidthWindow"`             // window of the delivery rate max & rtt min filters
+	BandwidthHeadroom           float64  `json:"bandwidthHeadroom"`           // bandwidth: share of the estimated bandwidth a higher rendition may use
+}
+
+type SendQueueConfig struct {
+	Capacity int    `json:"capacity"` // objects buffered per audience & track
+	Policy   string `json:"policy"`   // drop-oldest-group | drop-until-key-frame | disconnect
+}
+
+// forwarding modes of tracks to audiences per media kind, overriding the catalog's forwarding of the tracks
+type ForwardingConfig struct {
+	Audio string `json:"audio"` // track | group | object | datagram, empty keeps the catalog's or the streamer's mode
+	Video string `json:"video"` // same for video tracks
+}
+
+type GroupCacheConfig struct {
+	MaxGroups int `json:"maxGroups"` // most recent groups kept per track
+}
+
+type UpstreamConfig struct {
+	IdleDelay Duration `json:"idleDelay"` // delay before unsubscribing a streamer's track nobody watches
+}
+
+// edge mode: mirror the channels of an upstream origin instead of only serving local streamers
+type RelayConfig struct {
+	OriginURL          string   `json:"originURL"`          // https://host:port of the origin, empty runs the server as an origin
+	InsecureSkipVerify bool     `json:"insecureSkipVerify"` // accept the origin's certificate without verifying it, e.g. self-signed
+	ReconnectDelay     Duration `json:"reconnectDelay"`     // delay before redialing the origin once the session to it ended
+}
+
+// admin listener serving plain HTTP, the metrics endpoint for a local Prometheus & the admin API
+type AdminConfig struct {
+	ListenAddr string `json:"listenAddr"` // host:port, empty disables the admin listener
+	Token      string `json:"token"`      // bearer token every admin request must present, required unless listening on loopback
+}
+
+// streamer & audience authentication, streamers are authenticated once a stream keys file or a token secret is set
+type AuthConfig struct {
+	StreamKeysFile string `json:"streamKeysFile"` // JSON key store binding stream keys to channel names, see auth.NewStreamAuth
+	TokenSecret    string `json:"tokenSecret"`    // HMAC-SHA256 secret of signed stream, viewer & relay tokens, see cmd/moq-token
+}
+
+// time.Duration that reads & writes as a string, e.g. "1s", "250ms"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func Default() *Config {
+	return &Config{
+		ListenAddr: "10.0.2.1:443",
+		TLS: TLSConfig{
+			CertFile: "./utilities/cert.pem",
+			KeyFile:  "./utilities/key.pem",
+		},
+		Log: LogConfig{
+			QlogDir:    "log/qlog",
+			MetricsDir: "log/metrics",
+		},
+		Origin: OriginConfig{
+			Streamer:     []string{"https://localhost", "https://localhost:*", `regex:https://10\.0\.\d+\.\d+(:\d+)?`},
+			Audience:     []string{"https://localhost", "https://localhost:*", `regex:https://10\.0\.\d+\.\d+(:\d+)?`},
+			AllowMissing: true,
+		},
+		Adaptation: AdaptationConfig{
+			Policy:                      adaptation.PolicyLoss,
+			DropRateThreshold:           0.1,
+			RetransmissionRateThreshold: 0.1,
+			RTTVarianceThreshold:        2000,
+			CheckInterval:               Duration(1 * time.Second),
+			Alpha:                       0.9,
+			UpThresholdRatio:            0.5,
+			MinDwell:                    Duration(5 * time.Second),
+			ProbeInterval:               Duration(10 * time.Second),
+			MaxProbeInterval:            Duration(60 * time.Second),
+			BandwidthWindow:             Duration(10 * time.Second),
+			BandwidthHeadroom:           0.8,
+		},
+		SendQueue: SendQueueConfig{
+			Capacity: sendqueue.DefaultConfig().Capacity,
+			Policy:   sendqueue.DefaultConfig().Policy.String(),
+		},
+		GroupCache: GroupCacheConfig{
+			MaxGroups: 2,
+		},
+		Upstream: UpstreamConfig{
+			IdleDelay: Duration(5 * time.Second),
+		},
+		Relay: RelayConfig{
+			ReconnectDelay: Duration(2 * time.Second),
+		},
+	}
+}
+
+// load the config from defaults, the file given by -config (or MOQ_CONFIG), env vars and command line flags, then validate it
+func Load(args []string) (*Config, error) {
+	// first pass only resolves the config file path, flags are applied again on top of file & env values
+	var configPath string
+	fs := newFlagSet(Default(), &configPath)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if configPath == "" {
+		configPath = os.Getenv("MOQ_CONFIG")
+	}
+
+	cfg := Default()
+	if configPath != "" {
+		if err := cfg.loadFile(configPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := newFlagSet(cfg, &configPath).Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// the config file is JSON, YAML (.yaml, .yml) or TOML (.toml) by its extension, all with the JSON keys of Config. YAML &
+// TOML are converted to JSON first, so every format reports misspelled keys and reads durations as strings like "1s".
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+	if data, err = toJSON(path, data); err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// convert a YAML or TOML config file to JSON, any other file is read as JSON
+func toJSON(path string, data []byte) ([]byte, error) {
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+	return json.Marshal(values)
+}
+
+func newFlagSet(cfg *Config, configPath *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(configPath, "config", *configPath, "path to a JSON, YAML or TOML config file (env MOQ_CONFIG)")
+	fs.StringVar(&cfg.ListenAddr, "addr", cfg.ListenAddr, "listen address host:port (env MOQ_LISTEN_ADDR)")
+	fs.StringVar(&cfg.TLS.CertFile, "cert", cfg.TLS.CertFile, "TLS certificate file (env MOQ_TLS_CERT)")
+	fs.StringVar(&cfg.TLS.KeyFile, "key", cfg.TLS.KeyFile, "TLS key file (env MOQ_TLS_KEY)")
+	fs.StringVar(&cfg.Log.QlogDir, "qlog-dir", cfg.Log.QlogDir, "qlog output directory (env MOQ_QLOG_DIR)")
+	fs.StringVar(&cfg.Log.MetricsDir, "metrics-dir", cfg.Log.MetricsDir, "connection metrics log directory (env MOQ_METRICS_DIR)")
+	fs.Func("streamer-origins", "comma separated Origin allowlist of the streamer endpoint (env MOQ_STREAMER_ORIGINS)", setList(&cfg.Origin.Streamer))
+	fs.Func("audience-origins", "comma separated Origin allowlist of the audience endpoint (env MOQ_AUDIENCE_ORIGINS)", setList(&cfg.Origin.Audience))
+	fs.BoolVar(&cfg.Origin.AllowMissing, "allow-missing-origin", cfg.Origin.AllowMissing, "accept requests without Origin header, e.g. of native clients (env MOQ_ALLOW_MISSING_ORIGIN)")
+	fs.StringVar(&cfg.Adaptation.Policy, "adaptation-policy", cfg.Adaptation.Policy, fmt.Sprintf("rate adaptation policy, one of %v (env MOQ_ADAPTATION_POLICY)", adaptation.Policies()))
+	fs.Float64Var(&cfg.Adaptation.DropRateThreshold, "drop-rate", cfg.Adaptation.DropRateThreshold, "drop rate that triggers adapting down (env MOQ_DROP_RATE_THRESHOLD)")
+	fs.Float64Var(&cfg.Adaptation.RetransmissionRateThreshold, "retransmission-rate", cfg.Adaptation.RetransmissionRateThreshold, "retransmission rate that triggers adapting down (env MOQ_RETRANSMISSION_RATE_THRESHOLD)")
+	fs.Float64Var(&cfg.Adaptation.RTTVarianceThreshold, "rtt-variance", cfg.Adaptation.RTTVarianceThreshold, "rtt EMA variance considered as fluctuation (env MOQ_RTT_VARIANCE_THRESHOLD)")
+	fs.Func("check-interval", "interval of fluctuation & bandwidth checks, e.g. 1s (env MOQ_CHECK_INTERVAL)", func(s string) error {
+		return setDuration(&cfg.Adaptation.CheckInterval, s)
+	})
+	fs.Float64Var(&cfg.Adaptation.Alpha, "alpha", cfg.Adaptation.Alpha, "EMA smoothing factor (env MOQ_ALPHA)")
+	fs.Float64Var(&cfg.Adaptation.UpThresholdRatio, "up-threshold-ratio", cfg.Adaptation.UpThresholdRatio, "hysteresis: share of the down thresholds to stay below before probing up (env MOQ_UP_THRESHOLD_RATIO)")
+	fs.Func("min-dwell", "hysteresis: minimum time between two rendition switches, e.g. 5s (env MOQ_MIN_DWELL)", func(s string) error {
+		return setDuration(&cfg.Adaptation.MinDwell, s)
+	})
+	fs.Func("probe-interval", "hysteresis: calm time before probing up, e.g. 10s (env MOQ_PROBE_INTERVAL)", func(s string) error {
+		return setDuration(&cfg.Adaptation.ProbeInterval, s)
+	})
+	fs.Func("max-probe-interval", "hysteresis: upper bound of the probe interval backoff, e.g. 60s (env MOQ_MAX_PROBE_INTERVAL)", func(s string) error {
+		return setDuration(&cfg.Adaptation.MaxProbeInterval, s)
+	})
+	fs.Func("bandwidth-window", "window of the bandwidth estimation, e.g. 10s (env MOQ_BANDWIDTH_WINDOW)", func(s string) error {
+		return setDuration(&cfg.Adaptation.BandwidthWindow, s)
+	})
+	fs.Float64Var(&cfg.Adaptation.BandwidthHeadroom, "bandwidth-headroom", cfg.Adaptation.BandwidthHeadroom, "bandwidth: share of the estimated bandwidth a higher rendition may use (env MOQ_BANDWIDTH_HEADROOM)")
+	fs.IntVar(&cfg.SendQueue.Capacity, "queue-capacity", cfg.SendQueue.Capacity, "objects buffered per audience send queue (env MOQ_QUEUE_CAPACITY)")
+	fs.StringVar(&cfg.SendQueue.Policy, "queue-policy", cfg.SendQueue.Policy, "send queue overflow policy (env MOQ_QUEUE_POLICY)")
+	fs.StringVar(&cfg.Forwarding.Audio, "audio-forwarding", cfg.Forwarding.Audio, fmt.Sprintf("forwarding mode of audio tracks to audiences, one of %v, empty keeps the catalog's (env MOQ_AUDIO_FORWARDING)", forwarding.Modes()))
+	fs.StringVar(&cfg.Forwarding.Video, "video-forwarding", cfg.Forwarding.Video, fmt.Sprintf("forwarding mode of video tracks to audiences, one of %v, empty keeps the catalog's (env MOQ_VIDEO_FORWARDING)", forwarding.Modes()))
+	fs.IntVar(&cfg.GroupCache.MaxGroups, "cache-groups", cfg.GroupCache.MaxGroups, "most recent groups cached per track (env MOQ_CACHE_GROUPS)")
+	fs.Func("upstream-idle-delay", "delay before unsubscribing an unwatched streamer track, e.g. 5s (env MOQ_UPSTREAM_IDLE_DELAY)", func(s string) error {
+		return setDuration(&cfg.Upstream.IdleDelay, s)
+	})
+	fs.StringVar(&cfg.Admin.ListenAddr, "admin-addr", cfg.Admin.ListenAddr, "admin listener host:port serving /metrics & the admin API, empty disables it (env MOQ_ADMIN_ADDR)")
+	fs.StringVar(&cfg.Admin.Token, "admin-token", cfg.Admin.Token, "bearer token of the admin listener, required unless it listens on loopback, prefer the env var (env MOQ_ADMIN_TOKEN)")
+	fs.StringVar(&cfg.Auth.StreamKeysFile, "stream-keys", cfg.Auth.StreamKeysFile, "JSON file of stream keys & the channels they may publish (env MOQ_STREAM_KEYS)")
+	fs.StringVar(&cfg.Auth.TokenSecret, "token-secret", cfg.Auth.TokenSecret, "HMAC secret of signed stream & viewer tokens, prefer the env var (env MOQ_TOKEN_SECRET)")
+	fs.StringVar(&cfg.Relay.OriginURL, "relay-origin", cfg.Relay.OriginURL, "run as edge of the origin at this https URL (env MOQ_RELAY_ORIGIN)")
+	fs.BoolVar(&cfg.Relay.InsecureSkipVerify, "relay-insecure", cfg.Relay.InsecureSkipVerify, "don't verify the origin's certificate (env MOQ_RELAY_INSECURE)")
+	fs.Func("relay-reconnect-delay", "delay before redialing the origin, e.g. 2s (env MOQ_RELAY_RECONNECT_DELAY)", func(s string) error {
+		return setDuration(&cfg.Relay.ReconnectDelay, s)
+	})
+	return fs
+}
+
+func (cfg *Config) loadEnv() error {
+	setters := map[string]func(string) error{
+		"MOQ_LISTEN_ADDR":                   setString(&cfg.ListenAddr),
+		"MOQ_TLS_CERT":                      setString(&cfg.TLS.CertFile),
+		"MOQ_TLS_KEY":                       setString(&cfg.TLS.KeyFile),
+		"MOQ_QLOG_DIR":                      setString(&cfg.Log.QlogDir),
+		"MOQ_METRICS_DIR":                   setString(&cfg.Log.MetricsDir),
+		"MOQ_STREAMER_ORIGINS":              setList(&cfg.Origin.Streamer),
+		"MOQ_AUDIENCE_ORIGINS":              setList(&cfg.Origin.Audience),
+		"MOQ_ALLOW_MISSING_ORIGIN":          setBool(&cfg.Origin.AllowMissing),
+		"MOQ_ADAPTATION_POLICY":             setString(&cfg.Adaptation.Policy),
+		"MOQ_DROP_RATE_THRESHOLD":           setFloat(&cfg.Adaptation.DropRateThreshold),
+		"MOQ_RETRANSMISSION_RATE_THRESHOLD": setFloat(&cfg.Adaptation.RetransmissionRateThreshold),
+		"MOQ_RTT_VARIANCE_THRESHOLD":        setFloat(&cfg.Adaptation.RTTVarianceThreshold),
+		"MOQ_CHECK_INTERVAL":                func(s string) error { return setDuration(&cfg.Adaptation.CheckInterval, s) },
+		"MOQ_ALPHA":                         setFloat(&cfg.Adaptation.Alpha),
+		"MOQ_UP_THRESHOLD_RATIO":            setFloat(&cfg.Adaptation.UpThresholdRatio),
+		"MOQ_MIN_DWELL":                     func(s string) error { return setDuration(&cfg.Adaptation.MinDwell, s) },
+		"MOQ_PROBE_INTERVAL":                func(s string) error { return setDuration(&cfg.Adaptation.ProbeInterval, s) },
+		"MOQ_MAX_PROBE_INTERVAL":            func(s string) error { return setDuration(&cfg.Adaptation.MaxProbeInterval, s) },
+		"MOQ_BANDWIDTH_WINDOW":              func(s string) error { return setDuration(&cfg.Adaptation.BandwidthWindow, s) },
+		"MOQ_BANDWIDTH_HEADROOM":            setFloat(&cfg.Adaptation.BandwidthHeadroom),
+		"MOQ_QUEUE_CAPACITY":                setInt(&cfg.SendQueue.Capacity),
+		"MOQ_QUEUE_POLICY":                  setString(&cfg.SendQueue.Policy),
+		"MOQ_AUDIO_FORWARDING":              setString(&cfg.Forwarding.Audio),
+		"MOQ_VIDEO_FORWARDING":              setString(&cfg.Forwarding.Video),
+		"MOQ_UPSTREAM_IDLE_DELAY":           func(s string) error { return setDuration(&cfg.Upstream.IdleDelay, s) },
+		"MOQ_CACHE_GROUPS":                  setInt(&cfg.GroupCache.MaxGroups),
+		"MOQ_RELAY_ORIGIN":                  setString(&cfg.Relay.OriginURL),
+		"MOQ_RELAY_INSECURE":                setBool(&cfg.Relay.InsecureSkipVerify),
+		"MOQ_RELAY_RECONNECT_DELAY":         func(s string) error { return setDuration(&cfg.Relay.ReconnectDelay, s) },
+		"MOQ_ADMIN_ADDR":                    setString(&cfg.Admin.ListenAddr),
+		"MOQ_ADMIN_TOKEN":                   setString(&cfg.Admin.Token),
+		"MOQ_STREAM_KEYS":                   setString(&cfg.Auth.StreamKeysFile),
+		"MOQ_TOKEN_SECRET":                  setString(&cfg.Auth.TokenSecret),
+	}
+	var errs []error
+	for name, set := range setters {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := set(value); err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %v", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check every field and report all problems at once
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if _, port, err := net.SplitHostPort(cfg.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listenAddr %q: %v", cfg.ListenAddr, err))
+	} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		errs = append(errs, fmt.Errorf("listenAddr %q: invalid port", cfg.ListenAddr))
+	}
+
+	if err := checkFile(cfg.TLS.CertFile); err != nil {
+		errs = append(errs, fmt.Errorf("tls.certFile: %v", err))
+	}
+	if err := checkFile(cfg.TLS.KeyFile); err != nil {
+		errs = append(errs, fmt.Errorf("tls.keyFile: %v", err))
+	}
+
+	if cfg.Log.QlogDir == "" {
+		errs = append(errs, errors.New("log.qlogDir: must not be empty"))
+	}
+	if cfg.Log.MetricsDir == "" {
+		errs = append(errs, errors.New("log.metricsDir: must not be empty"))
+	}
+
+	if _, err := cfg.StreamerOrigins(); err != nil {
+		errs = append(errs, fmt.Errorf("origin.streamer: %v", err))
+	}
+	if _, err := cfg.AudienceOrigins(); err != nil {
+		errs = append(errs, fmt.Errorf("origin.audience: %v", err))
+	}
+
+	if r := cfg.Adaptation.DropRateThreshold; r <= 0 || r > 1 {
+		errs = append(errs, fmt.Errorf("adaptation.dropRateThreshold: %v not in (0, 1]", r))
+	}
+	if r := cfg.Adaptation.RetransmissionRateThreshold; r <= 0 || r > 1 {
+		errs = append(errs, fmt.Errorf("adaptation.retransmissionRateThreshold: %v not in (0, 1]", r))
+	}
+	if cfg.Adaptation.RTTVarianceThreshold <= 0 {
+		errs = append(errs, fmt.Errorf("adaptation.rttVarianceThreshold: %v must be positive", cfg.Adaptation.RTTVarianceThreshold))
+	}
+	if cfg.Adaptation.CheckInterval.Duration() <= 0 {
+		errs = append(errs, fmt.Errorf("adaptation.checkInterval: %v must be positive", cfg.Adaptation.CheckInterval.Duration()))
+	}
+	if cfg.Adaptation.BandwidthWindow.Duration() <= 0 {
+		errs = append(errs, fmt.Errorf("adaptation.bandwidthWindow: %v must be positive", cfg.Adaptation.BandwidthWindow.Duration()))
+	}
+	if a := cfg.Adaptation.Alpha; a <= 0 || a >= 1 {
+		errs = append(errs, fmt.Errorf("adaptation.alpha: %v not in (0, 1)", a))
+	}
+	if _, err := adaptation.New(cfg.AdaptationPolicyConfig()); err != nil {
+		errs = append(errs, fmt.Errorf("adaptation.policy: %v", err))
+	}
+
+	if cfg.SendQueue.Capacity < 1 {
+		errs = append(errs, fmt.Errorf("sendQueue.capacity: %d must be positive", cfg.SendQueue.Capacity))
+	}
+	if _, err := sendqueue.ParseOverflowPolicy(cfg.SendQueue.Policy); err != nil {
+		errs = append(errs, fmt.Errorf("sendQueue.policy: %v", err))
+	}
+
+	if err := forwarding.Check(cfg.Forwarding.Audio); err != nil {
+		errs = append(errs, fmt.Errorf("forwarding.audio: %v", err))
+	}
+	if err := forwarding.Check(cfg.Forwarding.Video); err != nil {
+		errs = append(errs, fmt.Errorf("forwarding.video: %v", err))
+	}
+
+	if cfg.GroupCache.MaxGroups < 1 {
+		errs = append(errs, fmt.Errorf("groupCache.maxGroups: %d must be positive", cfg.GroupCache.MaxGroups))
+	}
+
+	if cfg.Upstream.IdleDelay.Duration() < 0 {
+		errs = append(errs, fmt.Errorf("upstream.idleDelay: %v must not be negative", cfg.Upstream.IdleDelay.Duration()))
+	}
+
+	if cfg.Relay.OriginURL != "" {
+		if u, err := url.Parse(cfg.Relay.OriginURL); err != nil {
+			errs = append(errs, fmt.Errorf("relay.originURL: %v", err))
+		} else if u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("relay.originURL %q: must be an https URL with a host", cfg.Relay.OriginURL))
+		}
+	}
+	if cfg.Relay.ReconnectDelay.Duration() <= 0 {
+		errs = append(errs, fmt.Errorf("relay.reconnectDelay: %v must be positive", cfg.Relay.ReconnectDelay.Duration()))
+	}
+
+	if cfg.Admin.ListenAddr != "" {
+		// the admin API kicks audiences & terminates channels, only a loopback listener may go without token
+		if host, _, err := net.SplitHostPort(cfg.Admin.ListenAddr); err != nil {
+			errs = append(errs, fmt.Errorf("admin.listenAddr %q: %v", cfg.Admin.ListenAddr, err))
+		} else if cfg.Admin.Token == "" && !isLoopback(host) {
+			errs = append(errs, fmt.Errorf("admin.listenAddr %q: not a loopback address, set admin.token (MOQ_ADMIN_TOKEN)", cfg.Admin.ListenAddr))
+		}
+	}
+	if cfg.Admin.Token != "" && len(cfg.Admin.Token) < auth.MinSecretLength {
+		errs = append(errs, fmt.Errorf("admin.token: must have at least %d bytes", auth.MinSecretLength))
+	}
+
+	if _, err := cfg.StreamAuth(); err != nil {
+		errs = append(errs, fmt.Errorf("auth: %v", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// whether the server runs as an edge of an upstream origin
+func (cfg *Config) IsEdge() bool {
+	return cfg.Relay.OriginURL != ""
+}
+
+// Origin policy of the streamer endpoint
+func (cfg *Config) StreamerOrigins() (*auth.OriginPolicy, error) {
+	return auth.NewOriginPolicy(cfg.Origin.Streamer, cfg.Origin.AllowMissing)
+}
+
+// Origin policy of the audience endpoint
+func (cfg *Config) AudienceOrigins() (*auth.OriginPolicy, error) {
+	return auth.NewOriginPolicy(cfg.Origin.Audience, cfg.Origin.AllowMissing)
+}
+
+// rate adaptation policy config for the adaptation package, only valid after Validate
+func (cfg *Config) AdaptationPolicyConfig() adaptation.Config {
+	a := cfg.Adaptation
+	return adaptation.Config{
+		Policy:                      a.Policy,
+		DropRateThreshold:           a.DropRateThreshold,
+		RetransmissionRateThreshold: a.RetransmissionRateThreshold,
+		RTTVarianceThreshold:        a.RTTVarianceThreshold,
+		UpThresholdRatio:            a.UpThresholdRatio,
+		MinDwell:                    a.MinDwell.Duration(),
+		ProbeInterval:               a.ProbeInterval.Duration(),
+		MaxProbeInterval:            a.MaxProbeInterval.Duration(),
+		BandwidthHeadroom:           a.BandwidthHeadroom,
+	}
+}
+
+// streamer authentication from the key store & token secret, nil if streamers aren't authenticated
+func (cfg *Config) StreamAuth() (*auth.StreamAuth, error) {
+	return auth.NewStreamAuth(cfg.Auth.StreamKeysFile, cfg.Auth.TokenSecret)
+}
+
+// viewer token verification for private channels, nil without token secret
+func (cfg *Config) ViewerAuth() (*auth.ViewerAuth, error) {
+	return auth.NewViewerAuth(cfg.Auth.TokenSecret)
+}
+
+// send queue config for the channel package, only valid after Validate
+func (cfg *Config) QueueConfig() sendqueue.Config {
+	policy, _ := sendqueue.ParseOverflowPolicy(cfg.SendQueue.Policy)
+	return sendqueue.Config{Capacity: cfg.SendQueue.Capacity, Policy: policy}
+}
+
+// forwarding modes for the channel package, only valid after Validate
+func (cfg *Config) ForwardingConfig() forwarding.Config {
+	return forwarding.Config{Audio: cfg.Forwarding.Audio, Video: cfg.Forwarding.Video}
+}
+
+// whether host only binds the loopback interface, an empty host binds every interface
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func checkFile(path string) error {
+	if path == "" {
+		return errors.New("must not be empty")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+func setString(dst *string) func(string) error {
+	return func(s string) error {
+		*dst = s
+		return nil
+	}
+}
+
+// comma separated list replacing the previous one, empty for none
+func setList(dst *[]string) func(string) error {
+	return func(s string) error {
+		*dst = nil
+		if s != "" {
+			*dst = strings.Split(s, ",")
+		}
+		return nil
+	}
+}
+
+func setFloat(dst *float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setDuration(dst *Duration, s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*dst = Duration(v)
+	return nil
+}
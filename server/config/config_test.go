@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+  "listenAddr": "localhost:4443",
+  "origin": {"streamer": ["https://localhost:*"], "allowMissing": false},
+  "adaptation": {"policy": "hysteresis", "dropRateThreshold": 0.2, "minDwell": "3s"},
+  "groupCache": {"maxGroups": 4}
+}`,
+		"config.yaml": `
+listenAddr: localhost:4443
+origin:
+  streamer: ["https://localhost:*"]
+  allowMissing: false
+adaptation:
+  policy: hysteresis
+  dropRateThreshold: 0.2
+  minDwell: 3s
+groupCache:
+  maxGroups: 4
+`,
+		"config.toml": `
+listenAddr = "localhost:4443"
+
+[origin]
+streamer = ["https://localhost:*"]
+allowMissing = false
+
+[adaptation]
+policy = "hysteresis"
+dropRateThreshold = 0.2
+minDwell = "3s"
+
+[groupCache]
+maxGroups = 4
+`,
+	}
+
+	want := Default()
+	want.ListenAddr = "localhost:4443"
+	want.Origin.Streamer = []string{"https://localhost:*"}
+	want.Origin.AllowMissing = false
+	want.Adaptation.Policy = "hysteresis"
+	want.Adaptation.DropRateThreshold = 0.2
+	want.Adaptation.MinDwell = Duration(3 * time.Second)
+	want.GroupCache.MaxGroups = 4
+
+	dir := t.TempDir()
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg := Default()
+			if err := cfg.loadFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("got %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown.json", `{"listenAdr": "localhost:4443"}`, "unknown field"},
+		{"unknown.yaml", "sendQueue:\n  capacty: 8\n", "unknown field"},
+		{"unknown.toml", "[relay]\norignURL = \"https://origin\"\n", "unknown field"},
+		{"duration.yaml", "upstream:\n  idleDelay: 5\n", "duration must be a string"},
+		{"syntax.toml", "listenAddr = \n", "error parsing"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := Default().loadFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -1,15 +1,54 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
 	"moqlivestream/component/audiencemanager"
+	"moqlivestream/component/channel"
 	"moqlivestream/component/channelmanager"
+	"moqlivestream/server/admin"
+	"moqlivestream/server/config"
 	"moqlivestream/server/webtransportserver"
+	"moqlivestream/utilities"
 )
 
+var log = utilities.NewCustomLogger()
+
 func main() {
-	channelmanager.InitChannelManager()
-	audiencemanager.InitAudienceManager()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// the logger writes to log/server.log only, also report config errors on the terminal
+		fmt.Fprintf(os.Stderr, "❌ error loading config: %v\n", err)
+		log.Fatalf("❌ error loading config: %v", err)
+	}
+	log.Printf("🪵 config loaded, listening on %s", cfg.ListenAddr)
+
+	channel.SetSendQueueConfig(cfg.QueueConfig())
+	channel.SetForwardingConfig(cfg.ForwardingConfig())
+	channel.SetGroupCacheSize(cfg.GroupCache.MaxGroups)
+	channel.SetUpstreamIdleDelay(cfg.Upstream.IdleDelay.Duration())
 
-	go func() { webtransportserver.StartServer() }()
+	s, err := webtransportserver.NewServer(cfg, channelmanager.InitChannelManager(), audiencemanager.InitAudienceManager())
+	if err != nil {
+		log.Fatalf("❌ error creating server: %v", err)
+	}
+	if cfg.Admin.ListenAddr != "" {
+		go func() {
+			if err := admin.NewServer(cfg.Admin, s).ListenAndServe(); err != nil {
+				log.Printf("❌ error serving admin listener: %v", err)
+			}
+		}()
+	}
+	go func() {
+		if err := s.ListenAndServe(); err != nil {
+			log.Fatal(err)
+		}
+	}()
 	select {}
 }
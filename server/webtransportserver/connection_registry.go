@@ -0,0 +1,136 @@
+package webtransportserver
+
+import (
+	"errors"
+	"moqlivestream/component/audience"
+	"moqlivestream/component/streamer"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mengelbart/moqtransport"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+)
+
+// Connection associates a QUIC connection with its tracer, the WebTransport/MoQ session on it and the streamer or audience
+// using that session. Kind is empty until a session is bound and again after it ended.
+type Connection struct {
+	ID         string                   // QUIC connection ID the tracer was created for
+	TracingID  quic.ConnectionTracingID // same value as in the connection's context, links the HTTP request to the connection
+	Tracer     *ConnectionTracer        // nil if the tracer couldn't be created
+	RemoteAddr net.Addr
+	StartTime  time.Time
+
+	Kind       string // PeerStreamer or PeerAudience
+	Session    *webtransport.Session
+	MoqSession *moqtransport.Session
+	Streamer   *streamer.Streamer
+	Audience   *audience.Audience
+}
+
+// ConnectionRegistry holds the server's open QUIC connections by connection ID. Connections are added by the tracer once
+// started, bound to a session by the endpoint handlers and removed once closed.
+type ConnectionRegistry struct {
+	connections map[string]*Connection
+	byTracingID map[quic.ConnectionTracingID]string
+	mutex       sync.Mutex
+}
+
+func NewConnectionRegistry() *ConnectionRegistry {
+	return &ConnectionRegistry{
+		connections: map[string]*Connection{},
+		byTracingID: map[quic.ConnectionTracingID]string{},
+	}
+}
+
+func (cr *ConnectionRegistry) add(id string, tracingID quic.ConnectionTracingID, tracer *ConnectionTracer, remote net.Addr) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	cr.connections[id] = &Connection{ID: id, TracingID: tracingID, Tracer: tracer, RemoteAddr: remote, StartTime: time.Now()}
+	cr.byTracingID[tracingID] = id
+}
+
+// bind the session of a streamer or audience to the connection it arrived on
+func (cr *ConnectionRegistry) bind(tracingID quic.ConnectionTracingID, session *webtransport.Session, moqSession *moqtransport.Session, p *peer) error {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	c, ok := cr.connections[cr.byTracingID[tracingID]]
+	if !ok {
+		return errors.New("connection not found")
+	}
+	c.Kind = p.kind
+	c.Session = session
+	c.MoqSession = moqSession
+	c.Streamer = p.streamer
+	c.Audience = p.audience
+	return nil
+}
+
+// detach the ended session of a streamer or audience, the connection stays registered until it is closed
+func (cr *ConnectionRegistry) unbind(tracingID quic.ConnectionTracingID) (Connection, bool) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	c, ok := cr.connections[cr.byTracingID[tracingID]]
+	if !ok {
+		return Connection{}, false
+	}
+	ended := *c
+	c.Kind = ""
+	c.Session = nil
+	c.MoqSession = nil
+	c.Streamer = nil
+	c.Audience = nil
+	return ended, true
+}
+
+func (cr *ConnectionRegistry) remove(id string) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if c, ok := cr.connections[id]; ok {
+		delete(cr.byTracingID, c.TracingID)
+		delete(cr.connections, id)
+	}
+}
+
+// get a snapshot of a connection by its connection ID
+func (cr *ConnectionRegistry) Get(id string) (Connection, bool) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	c, ok := cr.connections[id]
+	if !ok {
+		return Connection{}, false
+	}
+	return *c, true
+}
+
+// get a snapshot of the connection a streamer or audience session is bound to, by the streamer's or audience's ID
+func (cr *ConnectionRegistry) GetByPeer(peerID uuid.UUID) (Connection, bool) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	for _, c := range cr.connections {
+		if (c.Streamer != nil && c.Streamer.ID == peerID) || (c.Audience != nil && c.Audience.ID == peerID) {
+			return *c, true
+		}
+	}
+	return Connection{}, false
+}
+
+// get a snapshot of every open connection
+func (cr *ConnectionRegistry) List() []Connection {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	connections := make([]Connection, 0, len(cr.connections))
+	for _, c := range cr.connections {
+		connections = append(connections, *c)
+	}
+	return connections
+}
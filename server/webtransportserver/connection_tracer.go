@@ -2,12 +2,16 @@ package webtransportserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"moqlivestream/component/audience"
+	"moqlivestream/component/channel"
+	"moqlivestream/component/channel/catalog"
 	"moqlivestream/component/channelmanager"
+	"moqlivestream/server/adaptation"
+	"moqlivestream/server/config"
 	"net"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -18,36 +22,45 @@ import (
 
 // var tracers []*ConnectionTracer
 
-type ConnectionTracer struct {
-	mu      sync.Mutex
-	connID  quic.ConnectionID
-	logFile *os.File
+// rtt & cwnd samples kept for the fluctuation check
+const maxMetricsHistory = 1024
 
-	packetsSent     int64 // sender side
-	bytesSent       int64 // sender side
-	packetsReceived int64 // receiver side
-	bytesReceived   int64 // receiver side
-	packetsLost     int64 // sender side, possibly retransmitted
-	packetsDropped  int64 // receiver side
+type ConnectionTracer struct {
+	mu           sync.Mutex
+	connectionID string // key of the connection in the ConnectionRegistry
+	connID       quic.ConnectionID
+	logFile      *os.File
+
+	packetsSent     int64           // sender side
+	bytesSent       int64           // sender side
+	packetsReceived int64           // receiver side
+	bytesReceived   int64           // receiver side
+	packetsLost     int64           // sender side, possibly retransmitted
+	packetsDropped  int64           // receiver side
+	stats           ConnectionStats // cumulative counters & latest metrics, unlike the counters above never reset
 
 	rttHistory      []float64
 	rttDerivatives  []float64
 	cwndHistory     []float64
 	cwndDerivatives []float64
+	rttEMA          float64 // running EMA of the smoothed rtt (µs), 0 before the first sample
+	rttEMAVariance  float64 // running EMA variance of the smoothed rtt (µs²), same as GetEMAVariance(rttHistory, alpha)
+	bandwidth       *adaptation.BandwidthEstimator
 
 	lastCheckTime time.Time
 	checkInterval time.Duration
 	alpha         float64 // EMA smoothing factor, 0 < alpha < 1, higher alpha gives more weight to recent data
+	adaptation    config.AdaptationConfig
+	policy        adaptation.RateAdaptationPolicy // decides at most once per checkInterval whether to switch rendition
+	lastDecision  time.Time                       // time the policy was last asked
 
-	rateAdapted         bool      // rate adaptation flag
-	lastRateAdaptedTime time.Time // use for ra-up periodically
-	startTime           time.Time //! test: manual trigger rate adaptation based on audience session start time
+	lastRateAdaptedTime time.Time // time of the last rendition switch
+	startTime           time.Time
 }
 
-func NewConnectionTracer(connectionID string) (*ConnectionTracer, error) {
-	metricsDir := "log/metrics"
+func NewConnectionTracer(connectionID string, metricsDir string, cfg config.AdaptationConfig, policy adaptation.RateAdaptationPolicy) (*ConnectionTracer, error) {
 	if _, err := os.Stat(metricsDir); os.IsNotExist(err) {
-		err := os.Mkdir(metricsDir, 0755)
+		err := os.MkdirAll(metricsDir, 0755)
 		if err != nil {
 			return nil, fmt.Errorf("error creating metrics directory: %v", err)
 		}
@@ -60,6 +73,7 @@ func NewConnectionTracer(connectionID string) (*ConnectionTracer, error) {
 		return nil, err
 	}
 	return &ConnectionTracer{
+		connectionID:    connectionID,
 		logFile:         logFile,
 		packetsLost:     0,
 		packetsDropped:  0,
@@ -68,14 +82,50 @@ func NewConnectionTracer(connectionID string) (*ConnectionTracer, error) {
 		cwndHistory:     make([]float64, 0),
 		cwndDerivatives: make([]float64, 0),
 		lastCheckTime:   time.Now(),
-		checkInterval:   1 * time.Second,
-		alpha:           0.9,
+		checkInterval:   cfg.CheckInterval.Duration(),
+		alpha:           cfg.Alpha,
+		adaptation:      cfg,
+		policy:          policy,
+		bandwidth:       adaptation.NewBandwidthEstimator(cfg.BandwidthWindow.Duration()),
 	}, nil
 }
 
-// cleanup on connection close
+// ConnectionStats is a snapshot of a connection's QUIC metrics, e.g. for the metrics endpoint
+type ConnectionStats struct {
+	SmoothedRTT      time.Duration
+	MinRTT           time.Duration // of the bandwidth estimator's window
+	CongestionWindow int64         // bytes
+	BytesInFlight    int64
+	PacketsSent      int64 // 1-RTT packets, sender side
+	PacketsReceived  int64 // 1-RTT packets, receiver side
+	PacketsLost      int64 // sender side
+	PacketsDropped   int64 // receiver side
+	BytesSent        int64
+	BytesReceived    int64
+	Bandwidth        int64 // estimated available bandwidth in bits/s, 0 until estimated
+}
+
+// get a snapshot of the connection's metrics
+func (t *ConnectionTracer) Stats() ConnectionStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.stats
+	stats.MinRTT = t.bandwidth.MinRTT()
+	stats.Bandwidth = t.bandwidth.Bandwidth()
+	return stats
+}
+
+// cleanup on connection or session close, safe to call more than once
 func (t *ConnectionTracer) CloseLogFile() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.logFile == nil {
+		return
+	}
 	t.logFile.Close()
+	t.logFile = nil
 }
 
 // // cleanup on server shutdown
@@ -87,32 +137,95 @@ func (t *ConnectionTracer) CloseLogFile() {
 // }
 
 func (t *ConnectionTracer) DropRate() float64 {
+	if t.packetsReceived == 0 {
+		return 0
+	}
 	return float64(t.packetsDropped) / float64(t.packetsReceived)
 }
 
 func (t *ConnectionTracer) RetransmissionRate() float64 {
+	if t.packetsSent == 0 {
+		return 0
+	}
 	return float64(t.packetsLost) / float64(t.packetsSent)
 }
 
-func (t *ConnectionTracer) FluctuationCheck(rttHistory, cwndHistory []float64, startTime time.Time, tracer *ConnectionTracer, TracerManager *TracerManager, EntityManager *EntityManager) {
+// estimated available bandwidth of the connection in bits/s, 0 until estimated
+func (t *ConnectionTracer) Bandwidth() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.bandwidth.Bandwidth()
+}
+
+// append a sample, dropping the oldest ones once the history is twice maxMetricsHistory long
+func appendHistory(history []float64, sample float64) []float64 {
+	if len(history) >= 2*maxMetricsHistory {
+		history = append(history[:0], history[len(history)-maxMetricsHistory:]...)
+	}
+	return append(history, sample)
+}
+
+// fold an rtt sample (µs) into the running EMA variance
+func (t *ConnectionTracer) updateRTTVariance(rtt float64) {
+	if t.rttEMA == 0 {
+		t.rttEMA = rtt
+		return
+	}
+	t.rttEMA = t.alpha*rtt + (1-t.alpha)*t.rttEMA
+	t.rttEMAVariance = t.alpha*(rtt-t.rttEMA)*(rtt-t.rttEMA) + (1-t.alpha)*t.rttEMAVariance
+}
+
+// snapshot of the connection for the rate adaptation policy, call with t.mu held
+func (t *ConnectionTracer) metrics(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, r *rendition) adaptation.Metrics {
+	m := adaptation.Metrics{
+		Time:               time.Now(),
+		ConnectionStart:    t.startTime,
+		DropRate:           t.DropRate(),
+		RetransmissionRate: t.RetransmissionRate(),
+		RTTVariance:        t.rttEMAVariance,
+		CongestionWindow:   int64(cwnd),
+		BytesInFlight:      int64(bytesInFlight),
+		Bandwidth:          t.bandwidth.Bandwidth(),
+		MinRTT:             t.bandwidth.MinRTT(),
+		LastSwitch:         t.lastRateAdaptedTime,
+	}
+	if r != nil {
+		m.Rendition, m.Renditions = r.index, len(r.ladder)
+		m.Bitrate = r.ladder[r.index].SelectionParams.Bitrate
+		if r.index > 0 {
+			m.UpBitrate = r.ladder[r.index-1].SelectionParams.Bitrate
+		}
+	}
+	if rttStats.LatestRTT() != 0 {
+		m.SmoothedRTT = rttStats.SmoothedRTT()
+	}
+	return m
+}
+
+// log the rtt & cwnd fluctuation of the last check interval with each variance method, the policies only use the EMA variance
+func (t *ConnectionTracer) FluctuationCheck(rttHistory, cwndHistory []float64, startTime time.Time) {
 	//! Method 1: Double derivatives
 	rttFirstDerivatives := GetFirstDerivatives(rttHistory)
 	cwndFirstDerivatives := GetFirstDerivatives(cwndHistory)
 	rttSecondDerivative := GetVariance(rttFirstDerivatives)
 	cwndSecondDerivative := GetVariance(cwndFirstDerivatives)
-	fmt.Fprintf(t.logFile, "Method 1: time: %v, rttSecondDerivative: %v, cwndSecondDerivative: %v\n", time.Since(startTime).Seconds(), rttSecondDerivative, cwndSecondDerivative)
 
 	//! Method 2: EMA variance
 	rttEMAVariance := GetEMAVariance(rttHistory, t.alpha)
 	cwndEMAVariance := GetEMAVariance(cwndHistory, t.alpha)
-	fmt.Fprintf(t.logFile, "Method 2: time: %v, rttEMAVariance: %v, cwndEMAVariance: %v\n", time.Since(startTime).Seconds(), rttEMAVariance, cwndEMAVariance)
-	if rttEMAVariance > 2000 {
-		// RateAdapt(tracer, TracerManager, EntityManager, "down") //! test: server side rate adaptation
-	}
 
 	//! Method 3: Custom weighted variance
 	rttCustomWeightedVariance := GetCustomWeightedVariance(rttHistory, t.alpha)
 	cwndCustomWeightedVariance := GetCustomWeightedVariance(cwndHistory, t.alpha)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.logFile == nil { // closed by the session's teardown
+		return
+	}
+	fmt.Fprintf(t.logFile, "Method 1: time: %v, rttSecondDerivative: %v, cwndSecondDerivative: %v\n", time.Since(startTime).Seconds(), rttSecondDerivative, cwndSecondDerivative)
+	fmt.Fprintf(t.logFile, "Method 2: time: %v, rttEMAVariance: %v, cwndEMAVariance: %v\n", time.Since(startTime).Seconds(), rttEMAVariance, cwndEMAVariance)
 	fmt.Fprintf(t.logFile, "Method 3: time: %v, rttCustomWeightedVariance: %v, cwndCustomWeightedVariance: %v\n", time.Since(startTime).Seconds(), rttCustomWeightedVariance, cwndCustomWeightedVariance)
 }
 
@@ -176,111 +289,105 @@ func GetCustomWeightedVariance(data []float64, alpha float64) float64 {
 	return variance
 }
 
-func RateAdapt(tracer *ConnectionTracer, TracerManager *TracerManager, EntityManager *EntityManager, direction string) {
-	tracerIndex := TracerManager.GetIndexByTracer(tracer)
-	if tracerIndex != -1 {
-		// get entity(should be an audience obj) by index
-		entity, err := EntityManager.GetEntityByIndex(tracerIndex)
+// the video track an audience watches and its rendition ladder from the channel's catalog
+type rendition struct {
+	audience *audience.Audience
+	channel  *channel.Channel
+	track    string
+	ladder   []catalog.Track
+	index    int // position of track in ladder
+}
+
+// find the rendition the audience on a connection watches
+func audienceRendition(conn Connection, channels *channelmanager.ChannelManager) (*rendition, error) {
+	if conn.Kind != PeerAudience || conn.Audience == nil {
+		return nil, fmt.Errorf("connection %s has no audience session (kind %q)", conn.ID, conn.Kind)
+	}
+	au := conn.Audience
+	for _, name := range au.Channels() {
+		ch, err := channels.GetChannelByName(name)
 		if err != nil {
-			fmt.Fprintf(tracer.logFile, "❌ error getting entity by index: %v\n", err)
+			continue
 		}
-		if entity, ok := entity.(*audience.Audience); ok {
-			// get channel by name
-			fmt.Fprintf(tracer.logFile, "🔍 entity is an audience at index %v\n", tracerIndex)
-			fmt.Fprintf(tracer.logFile, "🔍  audience's subscribed channel is: %v\n", entity.Channel)
-			channel, err := channelmanager.GetChannelByName(entity.Channel)
-			if err != nil {
-				fmt.Fprintf(tracer.logFile, "❌ error getting channel by name: %v\n", err)
-				return
-			}
-			// get track name the audience is subscribed to
-			track, err := channel.GetTrackNameByAudience(entity)
-			if err != nil {
-				fmt.Fprintf(tracer.logFile, "❌ error getting track by audience: %v\n", err)
-				return
-			}
-
-			switch direction {
-			case "up":
-				if tracer.rateAdapted {
-					if strings.Contains(track, "ra") {
-						// rate adaptation
-						// channel.ListAudiencesSubscribedToTracks() //! test, result in server.log
-						err0 := channel.RemoveAudienceFromTrack(track, entity)
-						if err0 != nil {
-							fmt.Fprintf(tracer.logFile, "❌ error removing audience from %s track: %v\n", track, err0)
-							return
-						}
-						fmt.Fprintf(tracer.logFile, "🔼 adapt up: client %s removed from track %s\n", entity.ID, track)
-						trackRA := strings.Split(track, "-")[0]
-						err1 := channel.AddAudienceToTrack(trackRA, entity)
-						if err1 != nil {
-							fmt.Fprintf(tracer.logFile, "❌ error adding audience to %s track: %v\n", trackRA, err1)
-							return
-						}
-						fmt.Fprintf(tracer.logFile, "🔼 adapt up: client %s added to track %s\n", entity.ID, trackRA)
-						// channel.ListAudiencesSubscribedToTracks() //! test, result in server.log
-						tracer.rateAdapted = false
-						tracer.lastRateAdaptedTime = time.Now()
-						return
-					} else {
-						fmt.Fprintf(tracer.logFile, "❌ adapt up failed, client already on regular track %s \n", track)
-						return
-					}
-				}
-			default: // "down"
-				if !tracer.rateAdapted {
-					if !strings.Contains(track, "ra") { // in case client already adapted rate
-						// rate adaptation
-						// channel.ListAudiencesSubscribedToTracks() //! test, result in server.log
-						err0 := channel.RemoveAudienceFromTrack(track, entity)
-						if err0 != nil {
-							fmt.Fprintf(tracer.logFile, "❌ error removing audience from %s track: %v\n", track, err0)
-							return
-						}
-						fmt.Fprintf(tracer.logFile, "🔽 adapt down: client %s removed from track %s\n", entity.ID, track)
-						trackRA := track + "-ra"
-						err1 := channel.AddAudienceToTrack(trackRA, entity)
-						if err1 != nil {
-							fmt.Fprintf(tracer.logFile, "❌ error adding audience to %s track: %v\n", trackRA, err1)
-							return
-						}
-						fmt.Fprintf(tracer.logFile, "🔽 adapt down: client %s added to track %s\n", entity.ID, trackRA)
-						// channel.ListAudiencesSubscribedToTracks() //! test, result in server.log
-						tracer.rateAdapted = true
-						tracer.lastRateAdaptedTime = time.Now()
-						return
-					} else {
-						fmt.Fprintf(tracer.logFile, "❌ adapt down failed, client already adapted to track %s \n", track)
-						return
-					}
-				}
-			}
-		} else {
-			fmt.Fprintf(tracer.logFile, "❌ entity is not an audience at index %v\n", tracerIndex)
+		track, err := ch.GetTrackNameByAudience(au)
+		if err != nil {
+			continue
+		}
+		cat := ch.GetCatalog()
+		if cat == nil {
+			return nil, fmt.Errorf("channel %s has no catalog", ch.Name)
 		}
+		ladder := cat.Ladder(track)
+		index := catalog.RenditionIndex(ladder, track)
+		if index < 0 {
+			return nil, fmt.Errorf("track %s not in the catalog of channel %s", track, ch.Name)
+		}
+		return &rendition{audience: au, channel: ch, track: track, ladder: ladder, index: index}, nil
+	}
+	return nil, errors.New("audience not subscribed to any video track")
+}
+
+// switch the audience on the tracer's connection to the adjacent rendition, "up" or "down"
+func RateAdapt(tracer *ConnectionTracer, connections *ConnectionRegistry, channels *channelmanager.ChannelManager, direction string) {
+	conn, ok := connections.Get(tracer.connectionID)
+	if !ok {
+		fmt.Fprintf(tracer.logFile, "❌ connection %s not found in ConnectionRegistry\n", tracer.connectionID)
+		return
+	}
+	r, err := audienceRendition(conn, channels)
+	if err != nil {
+		fmt.Fprintf(tracer.logFile, "❌ error getting rendition of connection %s: %v\n", conn.ID, err)
+		return
+	}
+	fmt.Fprintf(tracer.logFile, "🔍 audience %s on track %s, rendition %d of %d\n", r.audience.ID, r.track, r.index+1, len(r.ladder))
+
+	target, icon, end := r.index+1, "🔽", "lowest"
+	if direction == "up" {
+		target, icon, end = r.index-1, "🔼", "highest"
+	}
+	if target < 0 || target >= len(r.ladder) {
+		fmt.Fprintf(tracer.logFile, "❌ adapt %s failed, client already on the %s rendition %s\n", direction, end, r.track)
+		return
+	}
+	next := r.ladder[target].Name
+	if err := r.channel.SwitchAudienceTrack(r.audience, r.track, next); err != nil {
+		fmt.Fprintf(tracer.logFile, "❌ error switching audience from %s to %s track: %v\n", r.track, next, err)
+		return
+	}
+	fmt.Fprintf(tracer.logFile, "%s adapt %s: client %s switched from track %s to %s\n", icon, direction, r.audience.ID, r.track, next)
+	tracer.lastRateAdaptedTime = time.Now()
+	// the rtt of the previous rendition doesn't tell about the new one
+	tracer.rttEMA = 0
+	tracer.rttEMAVariance = 0
+	if direction == "up" {
+		adaptation.CountSwitch(adaptation.Up)
 	} else {
-		fmt.Fprintf(tracer.logFile, "❌ tracer not found in TracerManager\n")
+		adaptation.CountSwitch(adaptation.Down)
 	}
 }
 
-func NewQuicConfig(TracerManager *TracerManager, EntityManager *EntityManager) *quic.Config {
+func NewQuicConfig(cfg *config.Config, connections *ConnectionRegistry, channels *channelmanager.ChannelManager) *quic.Config {
 	return &quic.Config{
 		EnableDatagrams: true,
 		Tracer: func(ctx context.Context, p logging.Perspective, ci quic.ConnectionID) *logging.ConnectionTracer {
 			var tracer *ConnectionTracer
 			connectionID := ci.String()
+			tracingID, _ := ctx.Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
 			connectionTracer := &logging.ConnectionTracer{
 
 				StartedConnection: func(local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
-					var err error
-					tracer, err = NewConnectionTracer(connectionID)
+					policy, err := adaptation.New(cfg.AdaptationPolicyConfig())
+					if err == nil {
+						tracer, err = NewConnectionTracer(connectionID, cfg.Log.MetricsDir, cfg.Adaptation, policy)
+					}
 					if err != nil {
 						log.Printf("❌ error creating moq tracer for connection %s: %v", connectionID, err)
+						tracer = nil
+						connections.add(connectionID, tracingID, nil, remote)
 						return
 					}
 					tracer.connID = destConnID
-					TracerManager.AddTracer(connectionID, tracer)
+					connections.add(connectionID, tracingID, tracer, remote)
 					// tracers = append(tracers, tracer)
 					if tracer != nil {
 						localAddr, ok := local.(*net.UDPAddr)
@@ -291,7 +398,7 @@ func NewQuicConfig(TracerManager *TracerManager, EntityManager *EntityManager) *
 						if !ok {
 							return
 						}
-						tracer.startTime = time.Now() //! test: manual trigger rate adaptation based on audience session start time
+						tracer.startTime = time.Now()
 						tracer.mu.Lock()
 						defer tracer.mu.Unlock()
 
@@ -301,14 +408,22 @@ func NewQuicConfig(TracerManager *TracerManager, EntityManager *EntityManager) *
 
 				// sender side
 				SentShortHeaderPacket: func(header *logging.ShortHeader, size logging.ByteCount, ecn logging.ECN, af *logging.AckFrame, frames []logging.Frame) {
-					if tracer == nil || tracer.logFile == nil {
+					if tracer == nil {
 						return
 					}
 					tracer.mu.Lock()
 					defer tracer.mu.Unlock()
+					if tracer.logFile == nil { // closed by the session's teardown
+						return
+					}
 
-					tracer.packetsSent = int64(header.PacketNumber)
+					tracer.packetsSent++
 					tracer.bytesSent += int64(size)
+					tracer.stats.PacketsSent++
+					tracer.stats.BytesSent += int64(size)
+					if len(frames) > 0 { // ack-only packets are never acked
+						tracer.bandwidth.OnPacketSent(int64(header.PacketNumber), int64(size), time.Now())
+					}
 					fmt.Fprintf(tracer.logFile, "Sent packet %d (%d bytes) with ack: %v\n", header.PacketNumber, size, af)
 					// Sent packet 0 (57 bytes) with ack: <nil>
 					// ...
@@ -317,73 +432,108 @@ func NewQuicConfig(TracerManager *TracerManager, EntityManager *EntityManager) *
 
 				// receiver side
 				ReceivedShortHeaderPacket: func(header *logging.ShortHeader, size logging.ByteCount, ecn logging.ECN, frames []logging.Frame) {
-					if tracer == nil || tracer.logFile == nil {
+					if tracer == nil {
 						return
 					}
 					tracer.mu.Lock()
 					defer tracer.mu.Unlock()
+					if tracer.logFile == nil { // closed by the session's teardown
+						return
+					}
 
-					tracer.packetsReceived = int64(header.PacketNumber)
+					tracer.packetsReceived++
 					tracer.bytesReceived += int64(size)
+					tracer.stats.PacketsReceived++
+					tracer.stats.BytesReceived += int64(size)
 					fmt.Fprintf(tracer.logFile, "Received packet %d (%d bytes)\n", header.PacketNumber, size)
 					// Received packet 7 (27 bytes)
 				},
 
 				// sender side
 				LostPacket: func(encLevel logging.EncryptionLevel, packetNumber logging.PacketNumber, reason logging.PacketLossReason) {
-					if tracer == nil || tracer.logFile == nil {
+					if tracer == nil {
 						return
 					}
 					tracer.mu.Lock()
 					defer tracer.mu.Unlock()
+					if tracer.logFile == nil { // closed by the session's teardown
+						return
+					}
 
 					tracer.packetsLost++
+					tracer.stats.PacketsLost++
+					if encLevel == logging.Encryption1RTT {
+						tracer.bandwidth.OnPacketLost(int64(packetNumber))
+					}
 					fmt.Fprintf(tracer.logFile, "Lost packet %d: %v\n", packetNumber, reason)
 				},
 
+				// sender side, delivery rate samples for the bandwidth estimation
+				AcknowledgedPacket: func(encLevel logging.EncryptionLevel, packetNumber logging.PacketNumber) {
+					if tracer == nil || encLevel != logging.Encryption1RTT {
+						return
+					}
+					tracer.mu.Lock()
+					defer tracer.mu.Unlock()
+
+					tracer.bandwidth.OnPacketAcked(int64(packetNumber), time.Now())
+				},
+
 				// receiver side
 				DroppedPacket: func(packetType logging.PacketType, packetNumber logging.PacketNumber, packetSize logging.ByteCount, reason logging.PacketDropReason) {
-					if tracer == nil || tracer.logFile == nil {
+					if tracer == nil {
 						return
 					}
 					tracer.mu.Lock()
 					defer tracer.mu.Unlock()
+					if tracer.logFile == nil { // closed by the session's teardown
+						return
+					}
 
 					tracer.packetsDropped++
+					tracer.stats.PacketsDropped++
 					fmt.Fprintf(tracer.logFile, "Dropped packet %d (%d bytes): %v\n", packetNumber, packetSize, reason)
 				},
 
 				UpdatedMetrics: func(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
-					if tracer == nil || tracer.logFile == nil {
+					if tracer == nil {
 						return
 					}
 					tracer.mu.Lock()
 					defer tracer.mu.Unlock()
+					if tracer.logFile == nil { // closed by the session's teardown
+						return
+					}
 
 					latestRTT := float64(rttStats.SmoothedRTT().Microseconds())
 					if rttStats.LatestRTT() != 0 { // LatestRTT returns the most recent rtt measurement. May return Zero if no valid updates have occurred.
-						tracer.rttHistory = append(tracer.rttHistory, latestRTT)
+						tracer.rttHistory = appendHistory(tracer.rttHistory, latestRTT)
+						tracer.updateRTTVariance(latestRTT)
 					}
-					tracer.cwndHistory = append(tracer.cwndHistory, float64(cwnd))
+					tracer.cwndHistory = appendHistory(tracer.cwndHistory, float64(cwnd))
+					tracer.stats.SmoothedRTT = rttStats.SmoothedRTT()
+					tracer.stats.CongestionWindow = int64(cwnd)
+					tracer.stats.BytesInFlight = int64(bytesInFlight)
+					tracer.bandwidth.OnMetricsUpdated(rttStats.LatestRTT(), int64(cwnd), int64(bytesInFlight), time.Now())
 
 					fmt.Fprintf(tracer.logFile, "Updated metrics: rtt=%v, cwnd=%d, bytesInFlight=%d, packetsInFlight=%d\n", latestRTT, cwnd, bytesInFlight, packetsInFlight)
 					// Updated metrics: rtt=0s, cwnd=40960, bytesInFlight=131, packetsInFlight=1
 
-					// check DropRate and RetransmissionRate
-					dropRate := tracer.DropRate()
-					retransmissionRate := tracer.RetransmissionRate()
-					fmt.Fprintf(tracer.logFile, "DropRate: %v, RetransmissionRate: %v\n", dropRate, retransmissionRate)
-					if dropRate > 0.1 {
-						RateAdapt(tracer, TracerManager, EntityManager, "down")
-						// reset drop rate
-						tracer.packetsDropped = 0
-						tracer.packetsReceived = 0
-					}
-					if retransmissionRate > 0.1 {
-						RateAdapt(tracer, TracerManager, EntityManager, "down")
-						// reset retransmission rate
-						tracer.packetsLost = 0
-						tracer.packetsSent = 0
+					fmt.Fprintf(tracer.logFile, "DropRate: %v, RetransmissionRate: %v\n", tracer.DropRate(), tracer.RetransmissionRate())
+					// metrics update on every ack, looking up the rendition & asking the policy once per check interval is enough
+					if conn, ok := connections.Get(tracer.connectionID); ok && conn.Kind == PeerAudience && time.Since(tracer.lastDecision) >= tracer.checkInterval { // only audiences switch renditions
+						tracer.lastDecision = time.Now()
+						r, _ := audienceRendition(conn, channels) // nil until the audience watches a track of a channel with catalog
+						switch decision := tracer.policy.Decide(tracer.metrics(rttStats, cwnd, bytesInFlight, r)); decision {
+						case adaptation.Up, adaptation.Down:
+							fmt.Fprintf(tracer.logFile, "⚖️ %s policy decided %s\n", tracer.policy.Name(), decision)
+							RateAdapt(tracer, connections, channels, decision.String())
+							// rates are measured since the last decision
+							tracer.packetsDropped = 0
+							tracer.packetsReceived = 0
+							tracer.packetsLost = 0
+							tracer.packetsSent = 0
+						}
 					}
 
 					// check rtt and cwnd fluctuations
@@ -391,38 +541,19 @@ func NewQuicConfig(TracerManager *TracerManager, EntityManager *EntityManager) *
 						capturedCheckTime := tracer.lastCheckTime
 						rttCopy := append([]float64(nil), tracer.rttHistory...)
 						cwndCopy := append([]float64(nil), tracer.cwndHistory...)
-						go tracer.FluctuationCheck(rttCopy, cwndCopy, capturedCheckTime, tracer, TracerManager, EntityManager)
+						go tracer.FluctuationCheck(rttCopy, cwndCopy, capturedCheckTime)
 						tracer.lastCheckTime = time.Now()
 
 						// check bandwidth (upload/download) with bytesSent/bytesReceived history
-						fmt.Fprintf(tracer.logFile, "Realtime bandwidth: upload: %v Bytes/s; download: %v Bytes/s\n", tracer.bytesSent/int64(tracer.checkInterval.Seconds()), tracer.bytesReceived/int64(tracer.checkInterval.Seconds()))
+						elapsed := time.Since(capturedCheckTime).Seconds()
+						fmt.Fprintf(tracer.logFile, "Realtime bandwidth: upload: %.0f Bytes/s; download: %.0f Bytes/s; estimated available: %d bit/s, min rtt %v\n", float64(tracer.bytesSent)/elapsed, float64(tracer.bytesReceived)/elapsed, tracer.bandwidth.Bandwidth(), tracer.bandwidth.MinRTT())
 						tracer.bytesSent = 0
 						tracer.bytesReceived = 0
 					}
-
-					//! enable one of the following test scenarios at a time
-
-					//! test: manual test: rate adapt down at 10 seconds after startTime, rate adapt up at 20 seconds
-					// if !tracer.rateAdapted && time.Since(tracer.startTime) > 10*time.Second {
-					// 	RateAdapt(tracer, TracerManager, EntityManager, "down")
-					// }
-					// if tracer.rateAdapted && time.Since(tracer.startTime) > 20*time.Second {
-					// 	RateAdapt(tracer, TracerManager, EntityManager, "up")
-					// }
-
-					// //! test: adapt up periodically if server rate adapted (may fall back to ra track if drop rate rises)
-					// if tracer.rateAdapted && time.Since(tracer.lastRateAdaptedTime) > 30*time.Second {
-					// 	RateAdapt(tracer, TracerManager, EntityManager, "up")
-					// }
-
-					// //! test: adapt up periodically if client side rate adapted (may fall back to ra track if drop rate rises)
-					// if time.Since(tracer.startTime) > 30*time.Second {
-					// tracer.rateAdapted = true
-					// 	RateAdapt(tracer, TracerManager, EntityManager, "up")
-					// }
 				},
 
 				ClosedConnection: func(err error) {
+					connections.remove(connectionID)
 					if tracer != nil {
 						tracer.CloseLogFile()
 					}
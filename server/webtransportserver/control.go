@@ -0,0 +1,80 @@
+package webtransportserver
+
+import (
+	"errors"
+	"fmt"
+	"moqlivestream/component/channel/catalog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mengelbart/moqtransport"
+)
+
+// errors of the control actions, wrapped with details
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrNotPossible  = errors.New("not possible")
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// close an audience's session, its lifecycle tears it down like any other disconnect
+func (s *Server) KickAudience(id uuid.UUID, reason string) error {
+	conn, ok := s.connections.GetByPeer(id)
+	if !ok || conn.Audience == nil {
+		return fmt.Errorf("audience(%s): %w", id, ErrNotFound)
+	}
+	if err := conn.MoqSession.CloseWithError(moqtransport.ErrorCodeNoError, reason); err != nil {
+		return fmt.Errorf("error closing session of audience(%s): %v", id, err)
+	}
+	log.Printf("👢 audience(%s) kicked: %s", id, reason)
+	return nil
+}
+
+// close the session of a channel's streamer, ending the channel for all its audiences. Mirrored channels of an edge have
+// no streamer here and can only be terminated on their origin.
+func (s *Server) TerminateChannel(name string, reason string) error {
+	if _, err := s.channels.GetChannelByName(name); err != nil {
+		return fmt.Errorf("channel %s: %w", name, ErrNotFound)
+	}
+	for _, conn := range s.connections.List() {
+		if conn.Streamer == nil || conn.Streamer.Channel == nil || conn.Streamer.Channel.Name != name {
+			continue
+		}
+		if err := conn.MoqSession.CloseWithError(moqtransport.ErrorCodeNoError, reason); err != nil {
+			return fmt.Errorf("error closing session of streamer(%s): %v", conn.Streamer.ID, err)
+		}
+		log.Printf("⛔ channel %s terminated: %s", name, reason)
+		return nil
+	}
+	return fmt.Errorf("channel %s has no streamer on this server: %w", name, ErrNotPossible)
+}
+
+// switch an audience to another rendition of the track it watches, as RateAdapt does but to any track of the ladder.
+// The switch counts as the connection's last rendition switch, so the adaptation policy waits its dwell time before
+// switching again. Returns the track the audience was switched from.
+func (s *Server) ForceRendition(id uuid.UUID, trackName string) (string, error) {
+	conn, ok := s.connections.GetByPeer(id)
+	if !ok || conn.Audience == nil {
+		return "", fmt.Errorf("audience(%s): %w", id, ErrNotFound)
+	}
+	r, err := audienceRendition(conn, s.channels)
+	if err != nil {
+		return "", fmt.Errorf("%v: %w", err, ErrNotPossible)
+	}
+	if catalog.RenditionIndex(r.ladder, trackName) < 0 {
+		return "", fmt.Errorf("track %s not in the rendition ladder of %s: %w", trackName, r.track, ErrInvalidInput)
+	}
+	if trackName == r.track {
+		return r.track, nil
+	}
+	if err := r.channel.SwitchAudienceTrack(r.audience, r.track, trackName); err != nil {
+		return "", fmt.Errorf("error switching audience(%s) from %s to %s track: %v", id, r.track, trackName, err)
+	}
+	if conn.Tracer != nil {
+		conn.Tracer.mu.Lock()
+		conn.Tracer.lastRateAdaptedTime = time.Now()
+		conn.Tracer.mu.Unlock()
+	}
+	log.Printf("🎚️ audience(%s) forced from track %s to %s", id, r.track, trackName)
+	return r.track, nil
+}
@@ -0,0 +1,301 @@
+package webtransportserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// control message types of draft-ietf-moq-transport-05
+const (
+	subscribeUpdateMessageType    = 0x02
+	subscribeMessageType          = 0x03
+	subscribeOkMessageType        = 0x04
+	subscribeErrorMessageType     = 0x05
+	announceMessageType           = 0x06
+	announceOkMessageType         = 0x07
+	announceErrorMessageType      = 0x08
+	unannounceMessageType         = 0x09
+	unsubscribeMessageType        = 0x0a
+	subscribeDoneMessageType      = 0x0b
+	announceCancelMessageType     = 0x0c
+	trackStatusRequestMessageType = 0x0d
+	trackStatusMessageType        = 0x0e
+	goAwayMessageType             = 0x10
+	clientSetupMessageType        = 0x40
+	serverSetupMessageType        = 0x41
+)
+
+// subscribe filter types, absolute filters carry start (and end) group/object
+const (
+	filterTypeAbsoluteStart = 0x03
+	filterTypeAbsoluteRange = 0x04
+)
+
+// version specific parameters of draft-05
+const (
+	authorizationParameterKey = 0x02 // ANNOUNCE & SUBSCRIBE authorization info
+)
+
+// subscribe parameters of this server, outside the range draft-05 defines
+const (
+	directoryFilterParameterKey = 0x20 // URL query filtering the "channels" directory, see channelmanager.ParseDirectoryFilter
+)
+
+// the fields of a control message the server cares about, other fields are skipped
+type controlMessage struct {
+	Type        uint64
+	SubscribeID uint64
+	Namespace   string
+	TrackName   string
+	Parameters  map[uint64][]byte // raw parameter values by key
+}
+
+// controlMessageParser parses the control messages of a stream incrementally,
+// messages have no length prefix in draft-05 so every message type must be parsed to find the next one
+type controlMessageParser struct {
+	buf    []byte
+	broken bool
+}
+
+// append stream data and return the messages completed by it
+func (p *controlMessageParser) feed(data []byte) ([]controlMessage, error) {
+	if p.broken {
+		return nil, nil
+	}
+	p.buf = append(p.buf, data...)
+
+	messages := []controlMessage{}
+	for len(p.buf) > 0 {
+		r := bytes.NewReader(p.buf)
+		msg, err := parseControlMessage(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break // incomplete message, wait for more data
+		}
+		if err != nil {
+			p.broken = true
+			p.buf = nil
+			return messages, err
+		}
+		consumed := len(p.buf) - r.Len()
+		p.buf = append(p.buf[:0], p.buf[consumed:]...)
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func parseControlMessage(r *bytes.Reader) (controlMessage, error) {
+	msg := controlMessage{}
+	var err error
+	if msg.Type, err = quicvarint.Read(r); err != nil {
+		return msg, err
+	}
+
+	switch msg.Type {
+	case subscribeMessageType:
+		if msg.SubscribeID, err = quicvarint.Read(r); err != nil {
+			return msg, err
+		}
+		if _, err = quicvarint.Read(r); err != nil { // track alias
+			return msg, err
+		}
+		if msg.Namespace, err = readString(r); err != nil {
+			return msg, err
+		}
+		if msg.TrackName, err = readString(r); err != nil {
+			return msg, err
+		}
+		if err = skip(r, 2); err != nil { // subscriber priority, group order
+			return msg, err
+		}
+		var filterType uint64
+		if filterType, err = quicvarint.Read(r); err != nil {
+			return msg, err
+		}
+		if filterType == filterTypeAbsoluteStart || filterType == filterTypeAbsoluteRange {
+			if err = skipVarints(r, 2); err != nil {
+				return msg, err
+			}
+		}
+		if filterType == filterTypeAbsoluteRange {
+			if err = skipVarints(r, 2); err != nil {
+				return msg, err
+			}
+		}
+		msg.Parameters, err = readParameters(r)
+	case subscribeUpdateMessageType:
+		if msg.SubscribeID, err = quicvarint.Read(r); err != nil {
+			return msg, err
+		}
+		if err = skipVarints(r, 4); err != nil {
+			return msg, err
+		}
+		if err = skip(r, 1); err != nil {
+			return msg, err
+		}
+		msg.Parameters, err = readParameters(r)
+	case subscribeOkMessageType:
+		if msg.SubscribeID, err = quicvarint.Read(r); err != nil {
+			return msg, err
+		}
+		if err = skipVarints(r, 1); err != nil { // expires
+			return msg, err
+		}
+		if err = skip(r, 1); err != nil { // group order
+			return msg, err
+		}
+		err = skipFinalGroupObject(r)
+	case subscribeErrorMessageType:
+		if msg.SubscribeID, err = quicvarint.Read(r); err != nil {
+			return msg, err
+		}
+		if err = skipVarints(r, 1); err != nil {
+			return msg, err
+		}
+		if _, err = readString(r); err != nil {
+			return msg, err
+		}
+		err = skipVarints(r, 1)
+	case unsubscribeMessageType:
+		msg.SubscribeID, err = quicvarint.Read(r)
+	case subscribeDoneMessageType:
+		if msg.SubscribeID, err = quicvarint.Read(r); err != nil {
+			return msg, err
+		}
+		if err = skipVarints(r, 1); err != nil {
+			return msg, err
+		}
+		if _, err = readString(r); err != nil {
+			return msg, err
+		}
+		err = skipFinalGroupObject(r)
+	case announceMessageType:
+		if msg.Namespace, err = readString(r); err != nil {
+			return msg, err
+		}
+		msg.Parameters, err = readParameters(r)
+	case announceOkMessageType, unannounceMessageType, announceCancelMessageType:
+		msg.Namespace, err = readString(r)
+	case announceErrorMessageType:
+		if msg.Namespace, err = readString(r); err != nil {
+			return msg, err
+		}
+		if err = skipVarints(r, 1); err != nil {
+			return msg, err
+		}
+		_, err = readString(r)
+	case trackStatusRequestMessageType:
+		if msg.Namespace, err = readString(r); err != nil {
+			return msg, err
+		}
+		msg.TrackName, err = readString(r)
+	case trackStatusMessageType:
+		if msg.Namespace, err = readString(r); err != nil {
+			return msg, err
+		}
+		if msg.TrackName, err = readString(r); err != nil {
+			return msg, err
+		}
+		err = skipVarints(r, 3)
+	case goAwayMessageType:
+		_, err = readString(r)
+	case clientSetupMessageType:
+		var versions uint64
+		if versions, err = quicvarint.Read(r); err != nil {
+			return msg, err
+		}
+		if err = skipVarints(r, int(versions)); err != nil {
+			return msg, err
+		}
+		msg.Parameters, err = readParameters(r)
+	case serverSetupMessageType:
+		if err = skipVarints(r, 1); err != nil {
+			return msg, err
+		}
+		msg.Parameters, err = readParameters(r)
+	default:
+		return msg, fmt.Errorf("unknown control message type 0x%x", msg.Type)
+	}
+	return msg, err
+}
+
+// peek the type and subscribe ID of a single encoded SUBSCRIBE_OK/ERROR/DONE message
+func peekSubscribeResponse(p []byte) (msgType uint64, subscribeID uint64, ok bool) {
+	msgType, n, err := quicvarint.Parse(p)
+	if err != nil {
+		return 0, 0, false
+	}
+	subscribeID, _, err = quicvarint.Parse(p[n:])
+	if err != nil {
+		return 0, 0, false
+	}
+	return msgType, subscribeID, true
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	length, err := quicvarint.Read(r)
+	if err != nil {
+		return "", err
+	}
+	if length > uint64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// parameters are encoded as key, length, value
+func readParameters(r *bytes.Reader) (map[uint64][]byte, error) {
+	count, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	params := map[uint64][]byte{}
+	for i := uint64(0); i < count; i++ {
+		key, err := quicvarint.Read(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		params[key] = []byte(value)
+	}
+	return params, nil
+}
+
+func skip(r *bytes.Reader, n int) error {
+	if r.Len() < n {
+		return io.ErrUnexpectedEOF
+	}
+	_, err := r.Seek(int64(n), io.SeekCurrent)
+	return err
+}
+
+func skipVarints(r *bytes.Reader, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := quicvarint.Read(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContentExists byte, followed by final group & object if set
+func skipFinalGroupObject(r *bytes.Reader) error {
+	contentExists, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if contentExists == 1 {
+		return skipVarints(r, 2)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package webtransportserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"moqlivestream/component/channel"
+	"moqlivestream/component/channelmanager"
+	"moqlivestream/server/auth"
+	"moqlivestream/server/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+)
+
+// edge mirrors the channels of an upstream origin. It connects to the origin's audience endpoint like any audience, follows the
+// origin's "channels" directory and adds a channel for every listed one. Their catalogTracks are followed from the origin and
+// media tracks subscribed from the origin on demand, then fanned out to local audiences like the tracks of a local streamer.
+type edge struct {
+	originURL      string // the origin's audience endpoint
+	dialer         *webtransport.Dialer
+	reconnectDelay time.Duration
+	channels       *channelmanager.ChannelManager
+	lifecycle      *Lifecycle
+	viewerAuth     *auth.ViewerAuth            // signs the relay token for the origin, nil without token secret
+	mirrored       map[string]*channel.Channel // channels added from the origin's directory, by name
+	ctx            context.Context
+	cancel         context.CancelFunc
+	mutex          sync.Mutex
+}
+
+func newEdge(cfg config.RelayConfig, channels *channelmanager.ChannelManager, lifecycle *Lifecycle, viewerAuth *auth.ViewerAuth) *edge {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &edge{
+		originURL: audienceEndpoint(cfg.OriginURL),
+		dialer: &webtransport.Dialer{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+			QUICConfig:      &quic.Config{EnableDatagrams: true},
+		},
+		reconnectDelay: cfg.ReconnectDelay.Duration(),
+		channels:       channels,
+		lifecycle:      lifecycle,
+		viewerAuth:     viewerAuth,
+		mirrored:       map[string]*channel.Channel{},
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// the origin's audience endpoint, an origin URL without a path gets the default one
+func audienceEndpoint(originURL string) string {
+	u, err := url.Parse(originURL)
+	if err != nil || strings.Trim(u.Path, "/") != "" {
+		return originURL
+	}
+	u.Path = "/webtransport/audience"
+	return u.String()
+}
+
+// the origin's audience endpoint with a fresh relay token if the edge has the origin's token secret, the origin then lists
+// and serves its unlisted & private channels to the edge too
+func (e *edge) endpoint() (string, error) {
+	if e.viewerAuth == nil {
+		return e.originURL, nil
+	}
+	token, err := e.viewerAuth.RelayToken(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("signing relay token: %w", err)
+	}
+	u, err := url.Parse(e.originURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// keep a session to the origin until the edge is stopped, redialing after the reconnect delay whenever it ends
+func (e *edge) run() {
+	for {
+		err := e.follow()
+		e.removeAll("origin session ended")
+		if e.ctx.Err() != nil {
+			log.Printf("🔌 edge stopped following origin %s", e.originURL)
+			return
+		}
+		log.Printf("❌ edge session to origin %s ended, reconnecting in %v: %v", e.originURL, e.reconnectDelay, err)
+
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-time.After(e.reconnectDelay):
+		}
+	}
+}
+
+// stop following the origin, the session to it is closed and the mirrored channels end
+func (e *edge) stop() {
+	e.cancel()
+}
+
+// connect to the origin and mirror its channel directory until the session ends
+func (e *edge) follow() error {
+	endpoint, err := e.endpoint()
+	if err != nil {
+		return err
+	}
+	_, session, err := e.dialer.Dial(e.ctx, endpoint, http.Header{})
+	if err != nil {
+		return fmt.Errorf("dialing origin: %w", err)
+	}
+	defer session.CloseWithError(0, "edge stopped following")
+
+	moqSession := &moqtransport.Session{
+		Conn:                webtransportmoq.New(session),
+		EnableDatagrams:     true, // receive the objects the origin forwards as datagrams
+		LocalRole:           moqtransport.RoleSubscriber,
+		RemoteRole:          moqtransport.RolePublisher,
+		AnnouncementHandler: e,
+		SubscriptionHandler: nil,
+	}
+	if err := moqSession.RunClient(); err != nil {
+		return fmt.Errorf("running moqt client: %w", err)
+	}
+	log.Printf("🔗 Edge connected to origin %s", e.originURL)
+
+	// remote tracks aren't closed with the session, reads end with this context instead
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	source := channel.NewSessionSource(moqSession)
+	subscribeCtx, subscribeCancel := context.WithTimeout(ctx, catalogTimeout)
+	directory, err := source.Subscribe(subscribeCtx, "channels", "channelListTrack")
+	subscribeCancel()
+	if err != nil {
+		return fmt.Errorf("subscribing to the origin's channel directory: %w", err)
+	}
+	log.Printf("🔔 Subscribed to channel directory of origin %s", e.originURL)
+
+	applied, latest := false, uint64(0) // group of the last snapshot synced
+	for {
+		obj, err := directory.ReadObject(ctx)
+		if err != nil {
+			if cause := context.Cause(session.Context()); cause != nil {
+				return cause
+			}
+			return err
+		}
+		// each snapshot is a group on its own stream and may overtake the previous one, which would end channels still listed
+		if applied && obj.GroupID <= latest {
+			continue
+		}
+		applied, latest = true, obj.GroupID
+		var snapshot []channelmanager.ChannelStatus
+		if err := json.Unmarshal(obj.Payload, &snapshot); err != nil {
+			log.Printf("❌ error parsing channel directory of origin %s (group %d): %s", e.originURL, obj.GroupID, err)
+			continue
+		}
+		e.sync(source, snapshot)
+	}
+}
+
+// accept the origin's ANNOUNCE of the "channels" namespace, the edge doesn't take other announcements from the origin
+func (e *edge) HandleAnnouncement(publisherSession *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
+	if a.Namespace() != "channels" {
+		arw.Reject(http.StatusBadRequest, "edge only follows the channels namespace")
+		return
+	}
+	arw.Accept()
+}
+
+// add the channels new in the origin's directory, update the status of mirrored ones and end those the origin no longer lists
+func (e *edge) sync(source channel.TrackSource, snapshot []channelmanager.ChannelStatus) {
+	listed := map[string]bool{}
+	for _, status := range snapshot {
+		listed[status.Name] = true
+
+		e.mutex.Lock()
+		ch, ok := e.mirrored[status.Name]
+		e.mutex.Unlock()
+		if ok {
+			ch.SetStatus(status.Status)
+			continue
+		}
+
+		ch, err := e.channels.AddChannel(status.Name, status.StartTime)
+		if err != nil {
+			log.Printf("❌ error mirroring channel %s of origin %s: %s", status.Name, e.originURL, err)
+			continue
+		}
+		ch.SetSource(source)
+		ch.SetStatus(status.Status)
+		e.mutex.Lock()
+		e.mirrored[status.Name] = ch
+		e.mutex.Unlock()
+		log.Printf("🆕 Channel %s mirrored from origin %s", status.Name, e.originURL)
+		go e.followCatalog(source, ch)
+	}
+
+	e.mutex.Lock()
+	ended := []*channel.Channel{}
+	for name, ch := range e.mirrored {
+		if !listed[name] {
+			delete(e.mirrored, name)
+			ended = append(ended, ch)
+		}
+	}
+	e.mutex.Unlock()
+	for _, ch := range ended {
+		e.removeChannel(ch, "channel ended on origin")
+	}
+}
+
+// fetch a mirrored channel's catalog from the origin and follow its updates
+func (e *edge) followCatalog(source channel.TrackSource, ch *channel.Channel) {
+	catalogTrack, catalogJSON, err := fetchCatalog(source, ch.Name)
+	if err != nil {
+		log.Printf("❌ error receiving catalog of mirrored channel %s: %s", ch.Name, err)
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.mirrored[ch.Name] != ch { // ended while fetching
+		stopCatalogTrack(catalogTrack)
+		return
+	}
+	ch.SetCatalog(catalogJSON)
+	ch.FollowCatalog(catalogTrack, e.lifecycle.catalogHandlers(nil)) // the origin checked the catalog
+	log.Printf("📦 Catalog of mirrored channel %s set: %d tracks", ch.Name, len(catalogJSON.Tracks))
+}
+
+// end every mirrored channel, e.g. once the session to the origin ended
+func (e *edge) removeAll(reason string) {
+	e.mutex.Lock()
+	ended := e.mirrored
+	e.mirrored = map[string]*channel.Channel{}
+	e.mutex.Unlock()
+
+	for _, ch := range ended {
+		e.removeChannel(ch, reason)
+	}
+}
+
+// end the audiences' subscriptions to a mirrored channel and remove it
+func (e *edge) removeChannel(ch *channel.Channel, reason string) {
+	e.lifecycle.endChannel(ch, reason)
+	ch.RemoveSession()
+	if err := e.channels.RemoveChannel(ch.Name); err != nil {
+		log.Printf("❌ error removing mirrored channel %s: %s", ch.Name, err)
+	}
+	log.Printf("🧹 Mirrored channel %s removed: %s", ch.Name, reason)
+}
@@ -0,0 +1,247 @@
+package webtransportserver
+
+import (
+	"context"
+	"fmt"
+	"moqlivestream/component/audience"
+	"moqlivestream/component/audiencemanager"
+	"moqlivestream/component/channel"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/channelmanager"
+	"moqlivestream/component/streamer"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mengelbart/moqtransport"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+)
+
+const (
+	PeerStreamer = "streamer"
+	PeerAudience = "audience"
+)
+
+// TeardownEvent is emitted once a streamer or audience session ended and the peer was removed from every registry
+type TeardownEvent struct {
+	Kind   string // PeerStreamer or PeerAudience
+	ID     uuid.UUID
+	Name   string // channel name for a streamer, audience name for an audience
+	Reason string
+	Time   time.Time
+}
+
+// a streamer or audience with everything attached to its session
+type peer struct {
+	kind      string
+	streamer  *streamer.Streamer
+	audience  *audience.Audience
+	sm        *sessionManager
+	conn      *moqConnection
+	tracingID quic.ConnectionTracingID
+}
+
+func (p *peer) id() uuid.UUID {
+	if p.kind == PeerStreamer {
+		return p.streamer.ID
+	}
+	return p.audience.ID
+}
+
+// Lifecycle watches streamer and audience sessions and removes a peer from every registry once its session terminates
+type Lifecycle struct {
+	channels    *channelmanager.ChannelManager
+	audiences   *audiencemanager.AudienceManager
+	connections *ConnectionRegistry
+	peers       map[uuid.UUID]*peer
+	handlers    []func(TeardownEvent)
+	mutex       sync.Mutex
+}
+
+func NewLifecycle(channels *channelmanager.ChannelManager, audiences *audiencemanager.AudienceManager, connections *ConnectionRegistry) *Lifecycle {
+	return &Lifecycle{
+		channels:    channels,
+		audiences:   audiences,
+		connections: connections,
+		peers:       map[uuid.UUID]*peer{},
+		handlers:    []func(TeardownEvent){},
+	}
+}
+
+// register a handler called for every TeardownEvent
+func (lc *Lifecycle) OnTeardown(handler func(TeardownEvent)) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	lc.handlers = append(lc.handlers, handler)
+}
+
+// track a peer until its WebTransport session terminates, then tear it down
+func (lc *Lifecycle) watch(session *webtransport.Session, p *peer) {
+	lc.mutex.Lock()
+	lc.peers[p.id()] = p
+	lc.mutex.Unlock()
+
+	go func() {
+		<-session.Context().Done()
+		reason := "session closed"
+		if cause := context.Cause(session.Context()); cause != nil {
+			reason = cause.Error()
+		}
+		lc.teardown(p.id(), reason)
+	}()
+}
+
+// remove a peer from every registry, runs at most once per peer
+func (lc *Lifecycle) teardown(id uuid.UUID, reason string) {
+	lc.mutex.Lock()
+	p, ok := lc.peers[id]
+	if !ok {
+		lc.mutex.Unlock()
+		return
+	}
+	delete(lc.peers, id)
+	lc.mutex.Unlock()
+
+	var event TeardownEvent
+	switch p.kind {
+	case PeerStreamer:
+		event = lc.teardownStreamer(p)
+	default:
+		event = lc.teardownAudience(p)
+	}
+	event.Reason = reason
+	event.Time = time.Now()
+
+	// the connection itself is removed from the registry once closed
+	if ended, ok := lc.connections.unbind(p.tracingID); ok && ended.Tracer != nil {
+		ended.Tracer.CloseLogFile()
+	}
+
+	log.Printf("🧹 %s(%s) %s torn down: %s", event.Kind, event.ID, event.Name, event.Reason)
+	lc.mutex.Lock()
+	handlers := append([]func(TeardownEvent){}, lc.handlers...)
+	lc.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// end the subscriptions of every audience watching the streamer's channel, then remove the streamer and its channel
+func (lc *Lifecycle) teardownStreamer(p *peer) TeardownEvent {
+	channel := p.streamer.Channel
+	lc.endChannel(channel, "channel ended")
+	if err := p.streamer.StopStreaming(); err != nil {
+		log.Printf("❌ error stopping streamer(%s): %v", p.streamer.ID, err)
+	}
+	if err := lc.channels.RemoveStreamer(channel.Name); err != nil {
+		log.Printf("❌ error removing streamer(%s) from channel manager: %v", p.streamer.ID, err)
+	}
+	return TeardownEvent{Kind: PeerStreamer, ID: p.streamer.ID, Name: channel.Name}
+}
+
+// end the subscriptions of every audience watching a channel and stop following its upstream catalogTrack & tracks
+func (lc *Lifecycle) endChannel(ch *channel.Channel, reason string) {
+	lc.mutex.Lock()
+	audiences := []*peer{}
+	for _, other := range lc.peers {
+		if other.kind == PeerAudience {
+			audiences = append(audiences, other)
+		}
+	}
+	lc.mutex.Unlock()
+
+	for _, au := range audiences {
+		ch.RemoveAudienceFromAllTracks(au.audience)
+		for _, s := range au.audience.RemoveSubscriptionsInNamespace(ch.Name) {
+			endSubscription(au, s, reason)
+		}
+	}
+
+	ch.StopCatalog()
+	ch.StopUpstreams()
+}
+
+// remove the audience from the channel directory, the tracks of its channel and from the audience manager
+func (lc *Lifecycle) teardownAudience(p *peer) TeardownEvent {
+	au := p.audience
+	for _, s := range au.RemoveSubscriptionsInNamespace("channels") {
+		lc.channels.UnsubscribeDirectory(s.LocalTrack)
+	}
+	for _, name := range au.Channels() {
+		if channel, err := lc.channels.GetChannelByName(name); err == nil {
+			channel.RemoveAudienceFromAllTracks(au)
+			if local, err := au.GetLocalTrack(name, "catalogTrack"); err == nil {
+				channel.RemoveCatalogSubscriber(local)
+			}
+		}
+	}
+	if err := lc.audiences.RemoveAudience(au.ID); err != nil {
+		log.Printf("❌ error removing audience(%s) from audience manager: %v", au.ID, err)
+	}
+	au.RemoveSession()
+	return TeardownEvent{Kind: PeerAudience, ID: au.ID, Name: au.Name}
+}
+
+// end the audiences' subscriptions fed by tracks a channel's catalog dropped
+func (lc *Lifecycle) endDroppedFeeds(dropped []channel.DroppedFeed) {
+	for _, feed := range dropped {
+		lc.mutex.Lock()
+		au, ok := lc.peers[feed.Audience.ID]
+		lc.mutex.Unlock()
+		if !ok {
+			continue
+		}
+		s, err := feed.Audience.RemoveSubscriptionByLocalTrack(feed.LocalTrack)
+		if err != nil {
+			log.Printf("❌ error ending feed of dropped track %s: %v", feed.TrackName, err)
+			continue
+		}
+		endSubscription(au, s, fmt.Sprintf("track %s removed from catalog", feed.TrackName))
+	}
+}
+
+// handlers of a followed catalog: check each version, end the feeds of the tracks it dropped and check the audiences'
+// subscriptions again once it changed the visibility
+func (lc *Lifecycle) catalogHandlers(check func(*catalog.Catalog) error) channel.CatalogHandlers {
+	return channel.CatalogHandlers{Check: check, Dropped: lc.endDroppedFeeds, Visibility: lc.reauthorizeChannel}
+}
+
+// check every audience subscription to a channel again, ending those no longer authorized
+func (lc *Lifecycle) reauthorizeChannel(ch *channel.Channel) {
+	lc.mutex.Lock()
+	audiences := []*peer{}
+	for _, p := range lc.peers {
+		if p.kind == PeerAudience && p.sm != nil {
+			audiences = append(audiences, p)
+		}
+	}
+	lc.mutex.Unlock()
+
+	for _, p := range audiences {
+		p.sm.reauthorize(ch)
+	}
+}
+
+// end one subscription of a watched audience, after it was removed from the audience
+func (lc *Lifecycle) endAudienceSubscription(id uuid.UUID, s *audience.Subscription, reason string) {
+	lc.mutex.Lock()
+	au, ok := lc.peers[id]
+	lc.mutex.Unlock()
+	if ok {
+		endSubscription(au, s, reason)
+	}
+}
+
+// tell an audience a subscription ended, after it was removed from the audience
+func endSubscription(au *peer, s *audience.Subscription, reason string) {
+	if au.sm != nil {
+		au.sm.forgetSubscribeToken(s.ID)
+	}
+	if err := au.conn.SubscribeDone(s.ID, moqtransport.SubscribeStatusTrackEnded, reason); err != nil {
+		log.Printf("❌ error sending SUBSCRIBE_DONE(%d) to audience(%s): %v", s.ID, au.audience.ID, err)
+		return
+	}
+	log.Printf("🏁 SUBSCRIBE_DONE(%d) sent to audience(%s): %s", s.ID, au.audience.ID, reason)
+}
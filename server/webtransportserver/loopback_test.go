@@ -0,0 +1,581 @@
+package webtransportserver_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"moqlivestream/component/audiencemanager"
+	"moqlivestream/component/channel/catalog"
+	"moqlivestream/component/channelmanager"
+	"moqlivestream/component/payload"
+	"moqlivestream/server/auth"
+	"moqlivestream/server/config"
+	"moqlivestream/server/webtransportserver"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+)
+
+const (
+	testChannel = "loopback"
+	testTrack   = "video"
+	waitTimeout = 10 * time.Second
+)
+
+// an origin and two edges on loopback sockets: a streamer publishes through the origin, an audience on each edge receives the
+// track, and both edges drop the mirrored channel once the streamer leaves. Each server only knows its own audiences, the
+// edges are the origin's.
+func TestOriginEdgesLoopback(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+
+	origin, originAddr := startServer(t, testConfig(t, certFile, keyFile, ""))
+	edges := []*webtransportserver.Server{}
+	edgeAddrs := []string{}
+	for i := 0; i < 2; i++ {
+		edge, addr := startServer(t, testConfig(t, certFile, keyFile, "https://"+originAddr))
+		edges = append(edges, edge)
+		edgeAddrs = append(edgeAddrs, addr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamer := publish(t, ctx, originAddr)
+
+	for i, edge := range edges {
+		waitFor(t, fmt.Sprintf("edge %d to mirror the channel with its catalog", i), func() bool {
+			ch, err := edge.Channels().GetChannelByName(testChannel)
+			return err == nil && ch.GetCatalog() != nil
+		})
+	}
+
+	audiences := []*audienceClient{}
+	for i, addr := range edgeAddrs {
+		a, err := subscribe(ctx, addr)
+		if err != nil {
+			t.Fatalf("audience of edge %d: %v", i, err)
+		}
+		defer a.close()
+		audiences = append(audiences, a)
+	}
+	waitFor(t, "the origin to count both edges as its audiences", func() bool {
+		return len(origin.Audiences().GetAudienceNames()) == 2
+	})
+	for i, edge := range edges {
+		if n := len(edge.Audiences().GetAudienceNames()); n != 1 {
+			t.Errorf("edge %d has %d audiences, want its own one", i, n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i, a := range audiences {
+		wg.Add(1)
+		go func(i int, a *audienceClient) {
+			defer wg.Done()
+			if err := a.receive(ctx, 3); err != nil {
+				t.Errorf("audience of edge %d: %v", i, err)
+			}
+		}(i, a)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	streamer.leave()
+	waitFor(t, "the origin to remove the channel", func() bool {
+		_, err := origin.Channels().GetChannelByName(testChannel)
+		return err != nil
+	})
+	for i, edge := range edges {
+		waitFor(t, fmt.Sprintf("edge %d to drop the mirrored channel", i), func() bool {
+			_, err := edge.Channels().GetChannelByName(testChannel)
+			return err != nil
+		})
+	}
+}
+
+// self-signed certificate for 127.0.0.1, clients skip verification like moq-publish -insecure
+func writeCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// default config with the test's certificate & log dirs, an edge of originURL unless it is empty
+func testConfig(t *testing.T, certFile, keyFile, originURL string) *config.Config {
+	cfg := config.Default()
+	cfg.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile}
+	cfg.Log.QlogDir = t.TempDir()
+	cfg.Log.MetricsDir = t.TempDir()
+	cfg.Relay.OriginURL = originURL
+	cfg.Relay.InsecureSkipVerify = true
+	cfg.Relay.ReconnectDelay = config.Duration(100 * time.Millisecond)
+	return cfg
+}
+
+// serve on a free loopback port until the test ends
+func startServer(t *testing.T, cfg *config.Config) (*webtransportserver.Server, string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ListenAddr = conn.LocalAddr().String()
+	s, err := webtransportserver.NewServer(cfg, channelmanager.NewChannelManager(), audiencemanager.NewAudienceManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(conn)
+	t.Cleanup(func() {
+		s.Close()
+		conn.Close()
+	})
+	return s, cfg.ListenAddr
+}
+
+func dial(ctx context.Context, addr string, endpoint string) (*webtransport.Session, error) {
+	dialer := &webtransport.Dialer{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		QUICConfig:      &quic.Config{EnableDatagrams: true},
+	}
+	_, session, err := dialer.Dial(ctx, fmt.Sprintf("https://%s/webtransport/%s", addr, endpoint), http.Header{})
+	return session, err
+}
+
+// a streamer publishing the test channel on the origin
+type testStreamer struct {
+	session   *webtransport.Session
+	stop      context.CancelFunc
+	done      chan struct{}
+	tracks    chan *moqtransport.LocalTrack
+	publisher *testPublisher
+}
+
+// ANNOUNCE the test channel on the origin and publish a key frame per group every 20ms once the track is subscribed
+func publish(t *testing.T, ctx context.Context, addr string) *testStreamer {
+	t.Helper()
+	return publishWithKey(t, ctx, addr, "")
+}
+
+// publish with a stream key, the server authenticates streamers
+func publishWithKey(t *testing.T, ctx context.Context, addr string, key string) *testStreamer {
+	t.Helper()
+	endpoint := "streamer"
+	if key != "" {
+		endpoint += "?key=" + url.QueryEscape(key)
+	}
+	session, err := dial(ctx, addr, endpoint)
+	if err != nil {
+		t.Fatalf("dialing origin: %v", err)
+	}
+	t.Cleanup(func() { session.CloseWithError(0, "test ended") })
+
+	c := &catalog.Catalog{
+		Version:                1,
+		StreamingFormat:        1,
+		StreamingFormatVersion: "0.1",
+		CommonTrackFields:      catalog.CommonTrackFields{Namespace: testChannel, Packaging: payload.PackagingChunk, RenderGroup: 1},
+		Tracks: []catalog.Track{{
+			Name:            testTrack,
+			SelectionParams: catalog.SelectionParams{Codec: "vp8", MimeType: "video/webm", Width: 640, Height: 360, Framerate: 30, Bitrate: 500_000},
+		}},
+	}
+	catalogBytes, err := c.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(ctx)
+	st := &testStreamer{session: session, stop: stop, done: make(chan struct{}), tracks: make(chan *moqtransport.LocalTrack, 2)}
+	p := &testPublisher{catalog: catalogBytes, tracks: st.tracks, media: make(chan *moqtransport.LocalTrack, 1)}
+	st.publisher = p
+	moqSession := &moqtransport.Session{
+		Conn:                webtransportmoq.New(session),
+		EnableDatagrams:     false,
+		LocalRole:           moqtransport.RolePublisher,
+		RemoteRole:          moqtransport.RoleSubscriber,
+		AnnouncementHandler: nil,
+		SubscriptionHandler: p,
+	}
+	if err := moqSession.RunClient(); err != nil {
+		t.Fatalf("running moqt client: %v", err)
+	}
+	announceCtx, cancel := context.WithTimeout(ctx, waitTimeout)
+	defer cancel()
+	if err := moqSession.Announce(announceCtx, testChannel); err != nil {
+		t.Fatalf("announcing %s: %v", testChannel, err)
+	}
+
+	go func() {
+		defer close(st.done)
+		var local *moqtransport.LocalTrack
+		select {
+		case local = <-p.media:
+		case <-ctx.Done():
+			return
+		}
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for groupID := uint64(0); ; groupID++ {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			framed, err := payload.EncodeObject(payload.PackagingChunk, &payload.Chunk{
+				Type:      payload.ChunkTypeVideo,
+				Key:       true,
+				Timestamp: time.Duration(groupID) * 20 * time.Millisecond,
+				Data:      frameData(groupID),
+			})
+			if err != nil {
+				return
+			}
+			local.WriteObject(ctx, moqtransport.Object{
+				GroupID:              groupID,
+				ObjectID:             0,
+				ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream,
+				Payload:              framed,
+			})
+		}
+	}()
+	t.Cleanup(st.leave)
+	return st
+}
+
+// stop publishing and close the session, moqtransport panics on objects it can't send once the session is closed, so the
+// tracks are closed first
+func (st *testStreamer) leave() {
+	st.stop()
+	<-st.done
+	for len(st.tracks) > 0 {
+		(<-st.tracks).Close()
+	}
+	st.session.CloseWithError(0, "streamer left")
+}
+
+// send a new catalog version on the catalogTrack, a new group after the previous version
+func (st *testStreamer) updateCatalog(ctx context.Context, c *catalog.Catalog) error {
+	data, err := c.Serialize()
+	if err != nil {
+		return err
+	}
+	st.publisher.mutex.Lock()
+	defer st.publisher.mutex.Unlock()
+	if st.publisher.catalogTrack == nil {
+		return errors.New("catalogTrack not subscribed")
+	}
+	st.publisher.catalogGroup++
+	return st.publisher.catalogTrack.WriteObject(ctx, moqtransport.Object{
+		GroupID:              st.publisher.catalogGroup,
+		ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream,
+		Payload:              data,
+	})
+}
+
+func frameData(groupID uint64) []byte {
+	return []byte(fmt.Sprintf("frame %d", groupID))
+}
+
+// serves the catalog and hands out the media track once the origin subscribes it
+type testPublisher struct {
+	catalog []byte
+	tracks  chan *moqtransport.LocalTrack // every track subscribed, closed when the streamer leaves
+	media   chan *moqtransport.LocalTrack
+
+	mutex        sync.Mutex
+	catalogTrack *moqtransport.LocalTrack // for catalog updates
+	catalogGroup uint64                   // group of the latest catalog version
+}
+
+func (p *testPublisher) HandleSubscription(session *moqtransport.Session, s *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+	if s.Namespace != testChannel || (s.TrackName != "catalogTrack" && s.TrackName != testTrack) {
+		srw.Reject(moqtransport.ErrorCodeTrackNotFound, "unknown track")
+		return
+	}
+	local := moqtransport.NewLocalTrack(s.Namespace, s.TrackName)
+	if err := session.AddLocalTrack(local); err != nil {
+		srw.Reject(moqtransport.ErrorCodeInternal, err.Error())
+		return
+	}
+	srw.Accept(local)
+	p.tracks <- local
+
+	if s.TrackName == "catalogTrack" {
+		p.mutex.Lock()
+		p.catalogTrack = local
+		p.mutex.Unlock()
+		go local.WriteObject(context.Background(), moqtransport.Object{ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream, Payload: p.catalog})
+		return
+	}
+	p.media <- local
+}
+
+// an audience of an edge subscribed to the test track
+type audienceClient struct {
+	session    *webtransport.Session
+	moqSession *moqtransport.Session
+	remote     *moqtransport.RemoteTrack
+}
+
+// subscribe the test track on a server as an audience
+func subscribe(ctx context.Context, addr string) (*audienceClient, error) {
+	return subscribeAt(ctx, addr, "audience")
+}
+
+// subscribe the test track as an audience of the endpoint, e.g. with a token query
+func subscribeAt(ctx context.Context, addr string, endpoint string) (*audienceClient, error) {
+	ctx, cancel := context.WithTimeout(ctx, waitTimeout)
+	defer cancel()
+	session, err := dial(ctx, addr, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("dialing edge: %w", err)
+	}
+
+	moqSession := &moqtransport.Session{
+		Conn:            webtransportmoq.New(session),
+		EnableDatagrams: true,
+		LocalRole:       moqtransport.RoleSubscriber,
+		RemoteRole:      moqtransport.RolePublisher,
+		AnnouncementHandler: moqtransport.AnnouncementHandlerFunc(func(_ *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
+			arw.Accept()
+		}),
+		SubscriptionHandler: nil,
+	}
+	if err := moqSession.RunClient(); err != nil {
+		session.CloseWithError(0, "moqt setup failed")
+		return nil, fmt.Errorf("running moqt client: %w", err)
+	}
+	remote, err := moqSession.Subscribe(ctx, 0, 0, testChannel, testTrack, "")
+	if err != nil {
+		session.CloseWithError(0, "subscribe failed")
+		return nil, fmt.Errorf("subscribing %s/%s: %w", testChannel, testTrack, err)
+	}
+	return &audienceClient{session: session, moqSession: moqSession, remote: remote}, nil
+}
+
+// check the next n objects are the published frames
+func (a *audienceClient) receive(ctx context.Context, n int) error {
+	ctx, cancel := context.WithTimeout(ctx, waitTimeout)
+	defer cancel()
+	for i := 0; i < n; i++ {
+		obj, err := a.remote.ReadObject(ctx)
+		if err != nil {
+			return fmt.Errorf("reading object %d: %w", i, err)
+		}
+		c, err := payload.DecodeObject(payload.PackagingChunk, "video", obj.Payload)
+		if err != nil {
+			return fmt.Errorf("decoding object %d/%d: %w", obj.GroupID, obj.ObjectID, err)
+		}
+		if want := string(frameData(obj.GroupID)); string(c.Data) != want {
+			return fmt.Errorf("object %d/%d carries %q, want %q", obj.GroupID, obj.ObjectID, c.Data, want)
+		}
+	}
+	return nil
+}
+
+func (a *audienceClient) close() {
+	a.session.CloseWithError(0, "audience done")
+}
+
+// a second SUBSCRIBE to a track the audience already subscribed is accepted by moqtransport on its own, the server must end
+// it with SUBSCRIBE_DONE instead of sending the track twice
+func TestDuplicateSubscriptionEnded(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	_, originAddr := startServer(t, testConfig(t, certFile, keyFile, ""))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publish(t, ctx, originAddr)
+
+	a, err := subscribe(ctx, originAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.close()
+	if err := a.receive(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	subscribeCtx, cancelSubscribe := context.WithTimeout(ctx, waitTimeout)
+	defer cancelSubscribe()
+	duplicate, err := a.moqSession.Subscribe(subscribeCtx, 1, 1, testChannel, testTrack, "")
+	if err != nil {
+		t.Fatalf("subscribing %s/%s again: %v", testChannel, testTrack, err)
+	}
+	if err := a.receive(ctx, 10); err != nil {
+		t.Fatalf("first subscription: %v", err)
+	}
+	readCtx, cancelRead := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancelRead()
+	if obj, err := duplicate.ReadObject(readCtx); err == nil {
+		t.Errorf("duplicate subscription received object %d/%d", obj.GroupID, obj.ObjectID)
+	}
+}
+
+// the test catalog with the given visibility & title
+func testCatalog(visibility string, title string) *catalog.Catalog {
+	return &catalog.Catalog{
+		Version:                1,
+		StreamingFormat:        1,
+		StreamingFormatVersion: "0.1",
+		CommonTrackFields:      catalog.CommonTrackFields{Namespace: testChannel, Packaging: payload.PackagingChunk, RenderGroup: 1},
+		Tracks: []catalog.Track{{
+			Name:            testTrack,
+			SelectionParams: catalog.SelectionParams{Codec: "vp8", MimeType: "video/webm", Width: 640, Height: 360, Framerate: 30, Bitrate: 500_000},
+		}},
+		Metadata: &catalog.Metadata{Title: title, Visibility: visibility},
+	}
+}
+
+// number of subscriptions the server serves to its audiences
+func subscriptions(s *webtransportserver.Server) int {
+	n := 0
+	for _, name := range s.Audiences().GetAudienceNames() {
+		if au, err := s.Audiences().GetAudienceByName(name); err == nil {
+			n += len(au.ListSubscriptions())
+		}
+	}
+	return n
+}
+
+// a catalog update making the channel private ends the catalogTrack & media subscriptions of audiences without a viewer
+// token for it, an audience with one keeps watching
+func TestPrivateCatalogUpdateEndsSubscriptions(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	cfg := testConfig(t, certFile, keyFile, "")
+	cfg.Auth.TokenSecret = "0123456789abcdef"
+	origin, originAddr := startServer(t, cfg)
+	sign := func(scope string) string {
+		token, err := auth.Sign([]byte(cfg.Auth.TokenSecret), auth.Claims{Scope: scope, Channels: []string{testChannel}, Expiry: time.Now().Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamer := publishWithKey(t, ctx, originAddr, sign(auth.ScopeStream))
+
+	viewer, err := subscribeAt(ctx, originAddr, "audience?token="+url.QueryEscape(sign(auth.ScopeView)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.close()
+	anonymous, err := subscribe(ctx, originAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anonymous.close()
+	subscribeCtx, cancelSubscribe := context.WithTimeout(ctx, waitTimeout)
+	defer cancelSubscribe()
+	if _, err := anonymous.moqSession.Subscribe(subscribeCtx, 1, 1, testChannel, "catalogTrack", ""); err != nil {
+		t.Fatalf("subscribing catalogTrack: %v", err)
+	}
+	waitFor(t, "the origin to serve 3 subscriptions", func() bool { return subscriptions(origin) == 3 })
+
+	if err := streamer.updateCatalog(ctx, testCatalog(catalog.VisibilityPrivate, "private now")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the anonymous audience's subscriptions to end", func() bool { return subscriptions(origin) == 1 })
+	if err := viewer.receive(ctx, 5); err != nil {
+		t.Fatalf("audience with viewer token: %v", err)
+	}
+}
+
+// without token secret nobody could watch a private channel, a catalog update making it private is rejected like such an
+// ANNOUNCE
+func TestPrivateCatalogUpdateRejectedWithoutSecret(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	origin, originAddr := startServer(t, testConfig(t, certFile, keyFile, ""))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamer := publish(t, ctx, originAddr)
+	a, err := subscribe(ctx, originAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.close()
+	if err := a.receive(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := origin.Channels().GetChannelByName(testChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := streamer.updateCatalog(ctx, testCatalog(catalog.VisibilityPrivate, "private")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if ch.Visibility() != catalog.VisibilityPublic {
+		t.Fatalf("channel visibility %s after the rejected update, want %s", ch.Visibility(), catalog.VisibilityPublic)
+	}
+
+	// later updates still apply
+	if err := streamer.updateCatalog(ctx, testCatalog(catalog.VisibilityUnlisted, "unlisted")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the unlisted catalog update", func() bool { return ch.Visibility() == catalog.VisibilityUnlisted })
+	if err := a.receive(ctx, 5); err != nil {
+		t.Fatalf("audience after the rejected update: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
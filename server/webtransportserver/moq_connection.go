@@ -0,0 +1,176 @@
+package webtransportserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"moqlivestream/component/forwarding"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/quic-go/webtransport-go"
+)
+
+// hooks on the control messages of a session, called synchronously from the control stream, must not block
+type controlMessageHooks struct {
+	// a SUBSCRIBE of the peer was accepted, either by the SubscriptionHandler or by moqtransport for an already added local track
+	subscribeAccepted func(msg controlMessage)
+	// the peer sent an UNSUBSCRIBE, moqtransport answers it with SUBSCRIBE_DONE on its own
+	unsubscribeReceived func(subscribeID uint64)
+	// the peer sent a SUBSCRIBE, called before moqtransport hands it to the SubscriptionHandler
+	subscribeReceived func(msg controlMessage)
+	// the peer sent an ANNOUNCE, called before moqtransport hands it to the AnnouncementHandler
+	announceReceived func(msg controlMessage)
+}
+
+// moqConnection wraps the moqtransport.Connection of a WebTransport session and keeps a handle on the MoQ control stream.
+// moqtransport does not expose its control stream, so messages it has no API for (e.g. a publisher-side SUBSCRIBE_DONE) are written here,
+// and the messages it handles internally (SUBSCRIBE to an existing local track, UNSUBSCRIBE) are observed here.
+// Objects are sent through a forwarding.Conn, closing a subscription's group & track streams once it ends.
+type moqConnection struct {
+	moqtransport.Connection
+	objects       *forwarding.Conn
+	controlStream *controlStream
+	hooks         controlMessageHooks
+	mutex         sync.Mutex
+}
+
+func newMoqConnection(session *webtransport.Session) *moqConnection {
+	objects := forwarding.NewConn(webtransportmoq.New(session))
+	return &moqConnection{
+		Connection: objects,
+		objects:    objects,
+	}
+}
+
+// set the control message hooks, must be called before the moqtransport session runs
+func (c *moqConnection) setHooks(hooks controlMessageHooks) {
+	c.hooks = hooks
+}
+
+// the first bidirectional stream accepted on a server session is the control stream
+func (c *moqConnection) AcceptStream(ctx context.Context) (moqtransport.Stream, error) {
+	stream, err := c.Connection.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.controlStream != nil {
+		return stream, nil
+	}
+	c.controlStream = &controlStream{Stream: stream, conn: c, subscribes: map[uint64]controlMessage{}}
+	return c.controlStream, nil
+}
+
+func (c *moqConnection) getControlStream() (*controlStream, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.controlStream == nil {
+		return nil, errors.New("control stream not established")
+	}
+	return c.controlStream, nil
+}
+
+// end a subscription the peer made to us by sending SUBSCRIBE_DONE without final group/object, objects moqtransport still
+// sends for it are dropped
+func (c *moqConnection) SubscribeDone(subscribeID uint64, statusCode uint64, reason string) error {
+	cs, err := c.getControlStream()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 0, 32+len(reason))
+	buf = quicvarint.Append(buf, subscribeDoneMessageType)
+	buf = quicvarint.Append(buf, subscribeID)
+	buf = quicvarint.Append(buf, statusCode)
+	buf = quicvarint.Append(buf, uint64(len(reason)))
+	buf = append(buf, reason...)
+	buf = append(buf, 0) // ContentExists: false
+	_, err = cs.Write(buf)
+	c.objects.EndSubscription(subscribeID)
+	return err
+}
+
+// controlStream serializes writes, moqtransport writes each control message with a single Write call,
+// so messages written by the server never interleave with the ones written by moqtransport.
+// Reads are parsed on the side to observe the peer's messages.
+type controlStream struct {
+	moqtransport.Stream
+	conn       *moqConnection
+	writeMutex sync.Mutex
+
+	parser     controlMessageParser
+	subscribes map[uint64]controlMessage // SUBSCRIBEs received but not answered yet, by subscribe ID
+	mutex      sync.Mutex
+}
+
+func (s *controlStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	if n > 0 {
+		s.observe(p[:n])
+	}
+	return n, err
+}
+
+func (s *controlStream) Write(p []byte) (int, error) {
+	s.writeMutex.Lock()
+	n, err := s.Stream.Write(p)
+	s.writeMutex.Unlock()
+
+	if err == nil {
+		s.observeResponse(p)
+	}
+	return n, err
+}
+
+// parse the peer's messages before moqtransport handles them
+func (s *controlStream) observe(data []byte) {
+	s.mutex.Lock()
+	messages, err := s.parser.feed(data)
+	for _, msg := range messages {
+		if msg.Type == subscribeMessageType {
+			s.subscribes[msg.SubscribeID] = msg
+		}
+	}
+	s.mutex.Unlock()
+
+	if err != nil {
+		log.Printf("❌ error parsing control stream, stop observing: %v", err)
+	}
+	for _, msg := range messages {
+		if msg.Type == subscribeMessageType && s.conn.hooks.subscribeReceived != nil {
+			s.conn.hooks.subscribeReceived(msg)
+		}
+		if msg.Type == unsubscribeMessageType {
+			s.conn.objects.CloseSubscription(msg.SubscribeID)
+			if s.conn.hooks.unsubscribeReceived != nil {
+				s.conn.hooks.unsubscribeReceived(msg.SubscribeID)
+			}
+		}
+		if msg.Type == announceMessageType && s.conn.hooks.announceReceived != nil {
+			s.conn.hooks.announceReceived(msg)
+		}
+	}
+}
+
+// match SUBSCRIBE_OK/ERROR written by moqtransport with the SUBSCRIBE they answer
+func (s *controlStream) observeResponse(p []byte) {
+	msgType, subscribeID, ok := peekSubscribeResponse(p)
+	if !ok || (msgType != subscribeOkMessageType && msgType != subscribeErrorMessageType) {
+		return
+	}
+
+	s.mutex.Lock()
+	msg, found := s.subscribes[subscribeID]
+	delete(s.subscribes, subscribeID)
+	s.mutex.Unlock()
+
+	if found && msgType == subscribeOkMessageType && s.conn.hooks.subscribeAccepted != nil {
+		s.conn.hooks.subscribeAccepted(msg)
+	}
+}
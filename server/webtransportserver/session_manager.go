@@ -2,279 +2,420 @@ package webtransportserver
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"moqlivestream/component/audience"
+	"moqlivestream/component/channel"
 	"moqlivestream/component/channel/catalog"
 	"moqlivestream/component/channelmanager"
 	"moqlivestream/component/streamer"
+	"moqlivestream/server/auth"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mengelbart/moqtransport"
 )
 
-// empty struct that groups session management functions
+// time the streamer has to send its catalog after ANNOUNCE
+const catalogTimeout = 10 * time.Second
+
+// groups session management functions of one streamer or audience session
 type sessionManager struct {
-	// subscribeId uint64 // saved for later use
-	// trackAlias  uint64 // saved for later use
-	streamer *streamer.Streamer
-	audience *audience.Audience
+	streamer  *streamer.Streamer
+	audience  *audience.Audience
+	lifecycle *Lifecycle
+
+	streamAuth   *auth.StreamAuth  // nil if streamers aren't authenticated
+	streamKey    string            // stream key of the streamer's URL query
+	announceKeys map[string]string // stream keys of the streamer's ANNOUNCE authorization parameters, by namespace
+
+	viewerAuth      *auth.ViewerAuth  // nil if no token secret is set, private channels can't be watched then
+	viewerToken     string            // viewer token of the audience's URL query
+	relay           bool              // the audience is an edge with a valid relay token
+	subscribeTokens map[uint64]string // viewer tokens of the audience's SUBSCRIBE authorization parameters, by subscribe ID, until the subscription ends
+	mutex           sync.Mutex
+}
+
+func newSessionManager(streamer *streamer.Streamer, audience *audience.Audience, lifecycle *Lifecycle) *sessionManager {
+	return &sessionManager{
+		streamer:  streamer,
+		audience:  audience,
+		lifecycle: lifecycle,
+	}
+}
+
+// authenticate the streamer's ANNOUNCEs with the key of its URL query or of each ANNOUNCE's authorization parameter
+func (sm *sessionManager) requireStreamKey(streamAuth *auth.StreamAuth, key string) {
+	sm.streamAuth = streamAuth
+	sm.streamKey = key
+	sm.announceKeys = map[string]string{}
+}
+
+// remember the authorization parameter of an ANNOUNCE until it is handled
+func (sm *sessionManager) announceReceived(msg controlMessage) {
+	key, ok := msg.Parameters[authorizationParameterKey]
+	if !ok {
+		return
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.announceKeys[msg.Namespace] = string(key)
+}
+
+// check the viewer tokens of the audience's subscriptions to private channels with the token of its URL query or of each
+// SUBSCRIBE's authorization parameter, a relay token grants every channel
+func (sm *sessionManager) acceptViewerTokens(viewerAuth *auth.ViewerAuth, token string) {
+	sm.viewerAuth = viewerAuth
+	sm.viewerToken = token
+	sm.relay = viewerAuth != nil && viewerAuth.Relay(token, time.Now())
+	sm.subscribeTokens = map[uint64]string{}
+}
+
+// remember the authorization parameter of a SUBSCRIBE until the subscription ends, it is checked again once the channel's
+// visibility changes
+func (sm *sessionManager) subscribeReceived(msg controlMessage) {
+	token, ok := msg.Parameters[authorizationParameterKey]
+	if !ok {
+		return
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.subscribeTokens[msg.SubscribeID] = string(token)
+}
+
+// drop the viewer token of a subscription that was rejected or ended
+func (sm *sessionManager) forgetSubscribeToken(subscribeID uint64) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	delete(sm.subscribeTokens, subscribeID)
+}
+
+// the viewer token of a subscription, the authorization parameter takes precedence over the URL query
+func (sm *sessionManager) subscribeToken(subscribeID uint64) string {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if token, ok := sm.subscribeTokens[subscribeID]; ok {
+		return token
+	}
+	return sm.viewerToken
+}
+
+// check that the audience may watch a channel, only private channels need a viewer token
+func (sm *sessionManager) authorizeChannel(ch *channel.Channel, subscribeID uint64) error {
+	if ch.Visibility() != catalog.VisibilityPrivate || sm.relay {
+		return nil
+	}
+	if sm.viewerAuth == nil {
+		return fmt.Errorf("%w: private channel", auth.ErrNotAllowed)
+	}
+	return sm.viewerAuth.Authorize(sm.subscribeToken(subscribeID), ch.Name, time.Now())
+}
+
+// end the audience's subscriptions to a channel it may no longer watch, after the channel's visibility changed
+func (sm *sessionManager) reauthorize(ch *channel.Channel) {
+	for _, sub := range sm.audience.ListSubscriptions() {
+		if sub.Namespace != ch.Name {
+			continue
+		}
+		err := sm.authorizeChannel(ch, sub.ID)
+		if err == nil {
+			continue
+		}
+		removed, removeErr := sm.audience.RemoveSubscription(sub.ID)
+		if removeErr != nil {
+			continue // ended meanwhile
+		}
+		sm.stopServing(ch, removed)
+		log.Printf("🔒 Subscription(%d) of audience(%s) to %s/%s no longer authorized: %v", sub.ID, sm.audience.ID, sub.Namespace, sub.TrackName, err)
+		sm.lifecycle.endAudienceSubscription(sm.audience.ID, removed, err.Error())
+	}
+}
+
+// reject a catalog making the channel private on a server without token secret, nobody could watch the channel
+func (sm *sessionManager) checkCatalogVisibility(c *catalog.Catalog) error {
+	if c.Visibility() == catalog.VisibilityPrivate && sm.viewerAuth == nil {
+		return errors.New("private channels need a token secret on the server")
+	}
+	return nil
+}
+
+// which channels besides the public ones the audience's directory lists: the private channels its viewer token is valid
+// for, or every channel for an edge
+func (sm *sessionManager) directoryVisible(subscribeID uint64) func(channelmanager.ChannelStatus) bool {
+	if sm.relay {
+		return func(channelmanager.ChannelStatus) bool { return true }
+	}
+	if sm.viewerAuth == nil {
+		return nil
+	}
+	token := sm.subscribeToken(subscribeID)
+	return func(status channelmanager.ChannelStatus) bool {
+		return status.Visibility == catalog.VisibilityPrivate && sm.viewerAuth.Authorize(token, status.Name, time.Now()) == nil
+	}
 }
 
-func newSessionManager(streamer *streamer.Streamer, audience *audience.Audience) *sessionManager {
-	return &sessionManager{streamer, audience}
+// check the stream key of an ANNOUNCE, the authorization parameter takes precedence over the URL query
+func (sm *sessionManager) authorizeAnnouncement(namespace string) error {
+	if sm.streamAuth == nil {
+		return nil
+	}
+	sm.mutex.Lock()
+	key, ok := sm.announceKeys[namespace]
+	delete(sm.announceKeys, namespace)
+	sm.mutex.Unlock()
+	if !ok {
+		key = sm.streamKey
+	}
+	return sm.streamAuth.Authorize(key, namespace, time.Now())
 }
 
 func (sm *sessionManager) HandleAnnouncement(publisherSession *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
 	log.Printf("📢 Announcement received: %s", a.Namespace())
+	if err := sm.authorizeAnnouncement(a.Namespace()); err != nil {
+		log.Printf("🔒 Announcement of %s by streamer(%s) rejected: %v", a.Namespace(), sm.streamer.ID, err)
+		status := http.StatusForbidden
+		if errors.Is(err, auth.ErrMissingKey) {
+			status = http.StatusUnauthorized
+		}
+		arw.Reject(uint64(status), err.Error())
+		return
+	}
 	//! A0: a.Namespace() = channel name
-	if !channelmanager.ChannelUnique(a.Namespace()) {
+	if !sm.lifecycle.channels.ChannelUnique(a.Namespace()) {
 		arw.Reject(http.StatusConflict, "channel(namespace) already exists")
 		return
 	}
-	arw.Accept()
 
-	sm.streamer.Name = a.Namespace()
+	//! S2: sub to catalogTrack for catalog file, the announcement is only accepted with a valid catalog
+	catalogTrack, catalogJSON, err := fetchCatalog(sm.streamer.Channel.Source, a.Namespace())
+	if err != nil {
+		log.Printf("❌ error receiving catalog of channel %s: %s", a.Namespace(), err)
+		arw.Reject(http.StatusBadRequest, fmt.Sprintf("invalid catalog: %s", err))
+		return
+	}
+
+	if err := sm.checkCatalogVisibility(catalogJSON); err != nil {
+		stopCatalogTrack(catalogTrack)
+		arw.Reject(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := sm.lifecycle.channels.AnnounceChannel(sm.streamer, a.Namespace()); err != nil { // publishes the channel in the "channels" directory
+		stopCatalogTrack(catalogTrack)
+		arw.Reject(http.StatusConflict, err.Error())
+		return
+	}
 	channel := sm.streamer.Channel
-	channel.Name = a.Namespace()
+	channel.SetCatalog(catalogJSON) // lists the renditions & metadata in the "channels" directory
+	channel.FollowCatalog(catalogTrack, sm.lifecycle.catalogHandlers(sm.checkCatalogVisibility))
+	arw.Accept()
 	log.Printf("🔔 Streamer & Channel name updated to: %s", a.Namespace())
+	log.Printf("📦 Channel Catalog set: %v", catalogJSON)
+
+	//! S0: media tracks are subscribed from the streamer on demand, once the first audience subscribes to them (see channel.acquireUpstream)
+	log.Printf("🔔 Channel %s ready, %d tracks subscribed on demand", channel.Name, len(catalogJSON.Tracks))
+}
 
-	//! S2: sub to catalogTrack for catalog file
-	catalogTrack, err := publisherSession.Subscribe(context.Background(), 0, 0, a.Namespace(), "catalogTrack", "")
+// subscribe to the catalogTrack of the streamer or upstream origin and read the first catalog, then normalize & validate it.
+// The catalogTrack stays subscribed for catalog updates if the catalog is valid.
+func fetchCatalog(source channel.TrackSource, namespace string) (*moqtransport.RemoteTrack, *catalog.Catalog, error) {
+	if source == nil {
+		return nil, nil, errors.New("no session to subscribe the catalogTrack from")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), catalogTimeout)
+	defer cancel()
+
+	catalogTrack, err := source.Subscribe(ctx, namespace, "catalogTrack")
 	if err != nil {
-		log.Printf("❌ error subscribing to streamer-app's catalogTrack: %s", err)
-		return
+		return nil, nil, fmt.Errorf("subscribing to catalogTrack: %w", err)
 	}
+
 	log.Printf("📦 Catalog file receiving...")
-	o, err := catalogTrack.ReadObject(context.Background())
+	o, err := catalogTrack.ReadObject(ctx)
 	if err != nil {
-		log.Printf("❌ error reading catalog file: %s", err)
-		return
+		stopCatalogTrack(catalogTrack)
+		return nil, nil, fmt.Errorf("reading catalog: %w", err)
 	}
 	catalogJSON, err := catalog.ParseCatalog(o.Payload)
 	if err != nil {
-		log.Printf("❌ error parsing catalog file: %s", err)
-		return
+		stopCatalogTrack(catalogTrack)
+		return nil, nil, fmt.Errorf("parsing catalog: %w", err)
 	}
-	channel.Catalog = catalogJSON
-	log.Printf("📦 Channel Catalog set: %v", channel.Catalog)
-	catalogTrack.Unsubscribe()
-
-	//! S0: sub to media track => default video track & audio track
-	// TODO: update track sub on demand (pending multiple audio track support)
-	// subscribe to all tracks in the catalog: audio, hd, md, hd-ra, md-ra
-	for i := 0; i < len(channel.Catalog.Tracks); i++ {
-		// for i := 0; i < 2; i++ { //! testbed: latency test_0
-		go sm.subscribeToStreamerMediaTrack(publisherSession, uint64(i+1), uint64(i+1), channel.Name, channel.Catalog.Tracks[i].Name)
+	catalogJSON.Normalize()
+	if err := catalogJSON.Validate(); err != nil {
+		stopCatalogTrack(catalogTrack)
+		return nil, nil, errors.New(strings.ReplaceAll(err.Error(), "\n", "; ")) // one line for the ANNOUNCE_ERROR reason
 	}
+	return catalogTrack, catalogJSON, nil
 }
 
-func (sm *sessionManager) subscribeToStreamerMediaTrack(publisherSession *moqtransport.Session, subscribeID uint64, trackAlias uint64, namespace string, trackName string) {
-	ctx := context.Background()
-	channel := sm.streamer.Channel
-	track := moqtransport.NewLocalTrack(namespace, trackName)
-	channel.Session.AddLocalTrack(track)
-	sub, err := publisherSession.Subscribe(ctx, subscribeID, trackAlias, namespace, trackName, "")
-	if err != nil {
-		log.Printf("❌ error subscribing to streamer-app's catalogTrack: %s", err)
-		return
-	}
-	log.Printf("🔔 Subscribed to channel(%s)'s media track: %s", namespace, trackName)
-
-	// monitor channel.TracksAudiences for audience list updates
+// unsubscribe from a catalogTrack that is not followed, discarding objects still in flight
+func stopCatalogTrack(catalogTrack *moqtransport.RemoteTrack) {
+	catalogTrack.Unsubscribe()
 	go func() {
-		for updatedTrack := range channel.AudienceCh {
-			if updatedTrack.TrackName == trackName {
-				channel.Mutex.Lock()
-				for _, track := range channel.TracksAudiences {
-					if track.TrackName == trackName {
-						track.Audiences = updatedTrack.Audiences
-					}
-				}
-				channel.Mutex.Unlock()
-			}
-		}
-	}()
-
-	// 1. read objs from current track from streamer
-	// 2. for each obj read, write to the audience's LocalTrack who has subscribed to the same track by trackName
-	go func(remote *moqtransport.RemoteTrack, trackName string) {
+		ctx, cancel := context.WithTimeout(context.Background(), catalogTimeout)
+		defer cancel()
 		for {
-			obj, err := remote.ReadObject(ctx)
-			if err != nil {
-				log.Printf("❌ error reading remote track object: %s", err)
+			if _, err := catalogTrack.ReadObject(ctx); err != nil {
 				return
 			}
-			channel.Mutex.Lock()
-			for _, track := range channel.TracksAudiences {
-				if track.TrackName == trackName {
-					for _, au := range track.Audiences {
-						if au.LocalTrack != nil { // wait for Accept() to set LocalTrack
-							if err := au.LocalTrack.WriteObject(ctx, obj); err != nil {
-								log.Printf("❌ error writing to local track for audience: %s", err)
-							}
-						}
-					}
-				}
-			}
-			channel.Mutex.Unlock()
 		}
-	}(sub, trackName)
+	}()
 }
 
-func writeMetaObject(session *moqtransport.Session, namespace string, trackName string, groupID uint64, objectID uint64, publisherPriority uint8, payload []byte, srw moqtransport.SubscriptionResponseWriter) {
-	track := moqtransport.NewLocalTrack(namespace, trackName)
-	session.AddLocalTrack(track)
+// called by moqtransport for a SUBSCRIBE to a track that has no local track in the audience's session yet:
+// validate it, add a local track and accept. Objects are only written once the subscription is registered in subscribeAccepted.
+func (sm *sessionManager) HandleSubscription(subscriberSession *moqtransport.Session, s *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+	log.Printf("🔔 Subscription received: namespace(%s), trackName(%s), id(%v)", s.Namespace, s.TrackName, s.ID)
+	if code, err := sm.checkSubscription(s.Namespace, s.TrackName, s.ID); err != nil {
+		log.Printf("❌ Subscription(%d) of audience(%s) to %s/%s rejected: %s", s.ID, sm.audience.ID, s.Namespace, s.TrackName, err)
+		sm.forgetSubscribeToken(s.ID)
+		srw.Reject(code, err.Error())
+		return
+	}
+
+	track := moqtransport.NewLocalTrack(s.Namespace, s.TrackName)
+	if err := subscriberSession.AddLocalTrack(track); err != nil {
+		log.Printf("❌ error adding local track: %s", err)
+		srw.Reject(moqtransport.ErrorCodeInternal, "error adding local track")
+		return
+	}
+	if err := sm.audience.AddLocalTrack(track); err != nil {
+		log.Printf("❌ error saving local track: %s", err)
+	}
 	srw.Accept(track)
-	go func(local *moqtransport.LocalTrack) {
-		if err := local.WriteObject(context.Background(), moqtransport.Object{GroupID: groupID, ObjectID: objectID, PublisherPriority: publisherPriority, ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream, Payload: payload}); err != nil {
-			log.Printf("❌ error writing meta object to local track: %s", err)
-			return
-		}
-		log.Printf("📦 Meta Object written to track: GroupID: %v, ObjectID: %v, Payload: %v bytes", groupID, objectID, len(payload))
-	}(track)
 }
 
-func (sm *sessionManager) HandleSubscription(subscriberSession *moqtransport.Session, s *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
-	log.Printf("🔔 Subscription received: namespace(%s), trackName(%s), id(%v)", s.Namespace, s.TrackName, s.ID)
-	switch s.Namespace {
-	case "channels": //! S1: request for channel list []string from server
-		channelList := channelmanager.GetChannelNames() //TODO: return channel status later
-		channelListBytes, err := json.Marshal(channelList)
-		if err != nil {
-			log.Printf("❌ error marshalling channel list: %s", err)
-			srw.Reject(uint64(moqtransport.ErrorCodeInternal), "error marshalling channel list")
-			return
+// check a SUBSCRIBE before serving it: the directory's track name must be a valid filter, any other namespace must be a
+// channel the audience may watch with the track in its catalog. Returns the error code to reject the SUBSCRIBE with.
+func (sm *sessionManager) checkSubscription(namespace string, trackName string, subscribeID uint64) (uint64, error) {
+	if namespace == "channels" { //! S1 is always served, unless its filter can't be parsed
+		if _, err := directoryFilter(trackName, nil); err != nil {
+			return moqtransport.ErrorCodeTrackNotFound, err
 		}
+		return 0, nil
+	}
+	//! S2 & S0 need an existing channel
+	channel, err := sm.lifecycle.channels.GetChannelByName(namespace)
+	if err != nil {
+		return moqtransport.ErrorCodeTrackNotFound, err
+	}
+	if err := sm.authorizeChannel(channel, subscribeID); err != nil {
+		return moqtransport.ErrorCodeUnauthorized, err
+	}
+	if c := channel.GetCatalog(); trackName != "catalogTrack" && c != nil && c.GetTrackByName(trackName) == nil {
+		return moqtransport.ErrorCodeTrackNotFound, fmt.Errorf("track %s not in catalog of channel %s", trackName, namespace)
+	}
+	return 0, nil
+}
 
-		go writeMetaObject(sm.audience.Session, s.Namespace, s.TrackName, 0, 0, 0, channelListBytes, srw)
+// register a subscription once its SUBSCRIBE_OK is sent and start serving it, covers the subscriptions accepted by HandleSubscription
+// and those moqtransport accepts on its own because a local track for the same track was added by an earlier subscription.
+// A subscription that can't be served is ended with SUBSCRIBE_DONE, the SUBSCRIBE_OK is already out.
+func (sm *sessionManager) subscribeAccepted(msg controlMessage) {
+	sub := &audience.Subscription{ID: msg.SubscribeID, Namespace: msg.Namespace, TrackName: msg.TrackName}
+
+	// checked again, moqtransport accepts a SUBSCRIBE to an earlier subscribed track without HandleSubscription
+	if _, err := sm.checkSubscription(sub.Namespace, sub.TrackName, sub.ID); err != nil {
+		sm.refuseSubscription(sub, err)
+		return
+	}
+	local, err := sm.audience.GetLocalTrack(msg.Namespace, msg.TrackName)
+	if err != nil {
+		sm.refuseSubscription(sub, err)
+		return
+	}
+	sub.LocalTrack = local
+	if err := sm.audience.AddSubscription(sub); err != nil {
+		sm.refuseSubscription(sub, err)
+		return
+	}
+	log.Printf("🔔 Subscription(%d) to %s/%s added to audience(%s)", sub.ID, sub.Namespace, sub.TrackName, sm.audience.ID)
+
+	switch sub.Namespace {
+	case "channels": //! S1: live channel directory, a new group with the full channel status list on every change
+		filter, err := directoryFilter(msg.TrackName, msg.Parameters)
+		if err != nil { // only an invalid filter parameter gets here, the track name was checked by HandleSubscription
+			log.Printf("❌ error parsing channel directory filter parameter, listing all channels: %s", err)
+			filter, _ = directoryFilter(msg.TrackName, nil)
+		}
+		sm.lifecycle.channels.SubscribeDirectory(local, filter, sm.directoryVisible(sub.ID))
 
 	default:
-		switch s.TrackName {
-		case "catalogTrack": //! S2: request for catalogTracks of chosen channel(namespace)
-			log.Printf("🔔 CatalogTrack request: %s", s.TrackName)
-
-			channel, err := channelmanager.GetChannelByName(s.Namespace)
-			if err != nil {
-				log.Printf("❌ error getting channel: %s", err)
-				srw.Reject(http.StatusNotFound, "channel not found")
-				return
-			}
-			catalogTracksBytes, err := channel.Catalog.SerializeTracks()
-			if err != nil {
-				log.Printf("❌ error serializing catalog: %s", err)
-				srw.Reject(uint64(moqtransport.ErrorCodeInternal), "error serializing catalog")
-				return
+		channel, err := sm.lifecycle.channels.GetChannelByName(sub.Namespace)
+		if err != nil { // removed since checkSubscription
+			if _, removeErr := sm.audience.RemoveSubscription(sub.ID); removeErr == nil {
+				sm.refuseSubscription(sub, err)
 			}
+			return
+		}
 
-			go writeMetaObject(sm.audience.Session, s.Namespace, s.TrackName, 0, 1, 0, catalogTracksBytes, srw)
-
-		default: //! S0: regular track subscription
-			// TODO: handle media track sub change from default to other tracks
-			// 1. get the channel obj with the channel name & get the audience obj from sm
-			// 2. add the audience object to the channel's track audience list
-			// 3. track registration
-			// 4. bridge track from bridge sub to get the next new groups
-			// 5. write the object to the audience from the bridge track
-
-			// old method without bridge track ====================================
-			channel, err := channelmanager.GetChannelByName(s.Namespace)
-			if err != nil {
-				log.Printf("❌ error getting channel: %s", err)
-				srw.Reject(http.StatusNotFound, "channel not found")
-				return
-			}
-			channel.ListAudiencesSubscribedToTracks() //! test
-			addAudienceError := channel.AddAudienceToTrack(s.TrackName, sm.audience)
-			if addAudienceError != nil {
-				log.Printf("❌ error adding audience to track: %s", addAudienceError)
+		switch sub.TrackName {
+		case "catalogTrack": //! S2: catalogTracks of chosen channel(namespace), a new group with every catalog update
+			if err := channel.AddCatalogSubscriber(local); err != nil {
+				log.Printf("❌ error adding catalog subscriber: %s", err)
 			}
-			log.Printf("audience(%s) added to track %s", sm.audience.ID, s.TrackName)
-			channel.ListAudiencesSubscribedToTracks() //! test
 
-			track := moqtransport.NewLocalTrack(s.Namespace, s.TrackName)
-			error := sm.audience.Session.AddLocalTrack(track)
-			if error != nil && error.Error() != "duplicate entry" { //! ignore duplicate entry error (temporary fix)
-				log.Printf("❌ error adding local track: %s", error)
-				srw.Reject(http.StatusInternalServerError, "error adding local track")
-				return
+		default: //! S0: regular track subscription, replays the cached current group before live forwarding
+			if err := channel.AddAudienceToTrack(sub.TrackName, sm.audience, local); err != nil {
+				log.Printf("❌ error adding audience to track: %s", err)
 			}
-			sm.audience.SetChannel(s.Namespace)
-			sm.audience.SetLocalTrack(track)
-			srw.Accept(track)
-
-			// new method with bridge track ====================================
-			//! Deprecated: bridge track method
-			// // TODO: replace bridge track sub with moqtransport similar function
-			// var channel *channel.Channel
-			// var track *moqtransport.LocalTrack
-			// // prevent re-adding on bridgeSub
-			// // TODO: manage bridgeSubId
-			// if s.ID != 999 && s.ID != 1000 {
-			// 	var err error
-			// 	channel, err = channelmanager.GetChannelByName(s.Namespace)
-			// 	if err != nil {
-			// 		log.Printf("❌ error getting channel: %s", err)
-			// 		srw.Reject(http.StatusNotFound, "channel not found")
-			// 		return
-			// 	}
-			// 	channel.AddAudienceToTrack(s.TrackName, sm.audience)
-
-			// 	track = moqtransport.NewLocalTrack(s.Namespace, s.TrackName)
-			// e := sm.audience.Session.AddLocalTrack(track)
-			// if e != nil {
-			// 	log.Printf("❌ error adding local track: %s", e)
-			// 	srw.Reject(http.StatusInternalServerError, "error adding local track")
-			// 	return
-			// }
-
-			// 	log.Printf("🔔 Audience added to track: %s", s.TrackName)
-			// 	log.Printf("🔔 NewLocalTrack added to channel '%s'", channel.Name)
-			// }
-
-			// // TODO: manage bridgeSubId
-			// bridgeSubId := uint64(0)
-			// if s.TrackName == "audio" {
-			// 	bridgeSubId = 2 ^ 64 - 1
-			// } else {
-			// 	bridgeSubId = 2 ^ 64 - 2
-			// }
-
-			// // sub for bridge track on channel session
-			// // ? why I donot need to do another srw.Accept(channel.Tracks[trackName]) here for the bridge sub (it worked without doing so)?
-			// // ? No need to register this bridge sub on channel's session.
-			// bridge, err := channel.Session.Subscribe(context.Background(), bridgeSubId, bridgeSubId, s.Namespace, s.TrackName, "") // subscribe to channel's track
-			// if err != nil {
-			// 	log.Printf("❌ error subscribing to channel's track: %s", err)
-			// 	return
-			// }
-			// log.Printf("🔔 Bridge track subscription done: %s, subId: %v", s.TrackName, s.ID) // ? Only got s.ID = 2(audio) and 3 (hd)
-
-			// joinPoint := false
-			// joinPointGroupID := uint64(0)
-			// go func(remote *moqtransport.RemoteTrack, local *moqtransport.LocalTrack) {
-			// 	for {
-			// 		obj, err := remote.ReadObject(context.Background())
-			// 		if err != nil {
-			// 			log.Printf("❌ error reading remote track object: %s", err)
-			// 			return
-			// 		}
-			// 		if obj.ObjectID == 0 {
-			// 			joinPoint = true
-			// 			joinPointGroupID = obj.GroupID
-			// 		}
-			// 		if joinPoint && obj.GroupID >= joinPointGroupID {
-			// 			if err := local.WriteObject(context.Background(), obj); err != nil {
-			// 				log.Printf("❌ error writing to local track: %s", err)
-			// 				return
-			// 			}
-			// 			log.Printf("📦 Write Object to audience on track '%s': GroupID: %v, ObjectID: %v, Payload: %v bytes", s.TrackName, obj.GroupID, obj.ObjectID, len(obj.Payload))
-			// 		} else {
-			// 			log.Printf("📦 Discarding objs from last group on track '%s': GroupID: %v, ObjectID: %v, Payload: %v bytes", s.TrackName, obj.GroupID, obj.ObjectID, len(obj.Payload))
-			// 		}
-			// 	}
-			// }(bridge, track)
-
-			// srw.Accept(track)
+			channel.ListAudiencesSubscribedToTracks() //! test
 		}
 	}
 }
+
+// end a subscription moqtransport accepted but the server doesn't serve, so neither side keeps it open
+func (sm *sessionManager) refuseSubscription(sub *audience.Subscription, reason error) {
+	log.Printf("🚫 Subscription(%d) of audience(%s) to %s/%s not served: %s", sub.ID, sm.audience.ID, sub.Namespace, sub.TrackName, reason)
+	sm.lifecycle.endAudienceSubscription(sm.audience.ID, sub, reason.Error())
+}
+
+// stop serving exactly the subscription the audience unsubscribed from
+func (sm *sessionManager) unsubscribeReceived(subscribeID uint64) {
+	sm.forgetSubscribeToken(subscribeID)
+	sub, err := sm.audience.RemoveSubscription(subscribeID)
+	if err != nil {
+		log.Printf("❌ error unsubscribing: %s", err)
+		return
+	}
+	log.Printf("🔕 Subscription(%d) to %s/%s removed from audience(%s)", sub.ID, sub.Namespace, sub.TrackName, sm.audience.ID)
+
+	if sub.Namespace == "channels" {
+		sm.lifecycle.channels.UnsubscribeDirectory(sub.LocalTrack)
+		return
+	}
+	channel, err := sm.lifecycle.channels.GetChannelByName(sub.Namespace)
+	if err != nil {
+		return // channel already gone
+	}
+	sm.stopServing(channel, sub)
+}
+
+// stop writing the track of a subscription removed from the audience
+func (sm *sessionManager) stopServing(ch *channel.Channel, sub *audience.Subscription) {
+	if sub.TrackName == "catalogTrack" {
+		ch.RemoveCatalogSubscriber(sub.LocalTrack)
+		return
+	}
+	if _, err := ch.RemoveAudienceLocalTrack(sm.audience, sub.LocalTrack); err != nil {
+		log.Printf("❌ error removing audience from track: %s", err)
+	}
+	ch.ListAudiencesSubscribedToTracks() //! test
+}
+
+// get the filter of a "channels" subscription: the filter parameter if given, otherwise the query following "?" in the track name,
+// e.g. "channelListTrack?tag=music&status=live"
+func directoryFilter(trackName string, parameters map[uint64][]byte) (*channelmanager.DirectoryFilter, error) {
+	if query, ok := parameters[directoryFilterParameterKey]; ok {
+		return channelmanager.ParseDirectoryFilter(string(query))
+	}
+	_, query, _ := strings.Cut(trackName, "?")
+	return channelmanager.ParseDirectoryFilter(query)
+}
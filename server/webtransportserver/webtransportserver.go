@@ -1,149 +1,288 @@
 package webtransportserver
 
 import (
-	"errors"
+	"fmt"
 	"moqlivestream/utilities"
+	"net"
 	"net/http"
 	"os"
-	"regexp"
 
 	"moqlivestream/component/audiencemanager"
 	"moqlivestream/component/channelmanager"
+	"moqlivestream/server/auth"
+	"moqlivestream/server/config"
 
 	"github.com/mengelbart/moqtransport"
-	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	"github.com/quic-go/webtransport-go"
 )
 
 var log = utilities.NewCustomLogger()
 
-func StartServer() {
+// Server is one moq-live-stream server: an origin serving its streamers' channels, or an edge that also mirrors the channels
+// of an upstream origin (see config.RelayConfig). Several servers can run in one process, each with its own channels and
+// audiences.
+type Server struct {
+	cfg             *config.Config
+	channels        *channelmanager.ChannelManager
+	audiences       *audiencemanager.AudienceManager
+	connections     *ConnectionRegistry
+	lifecycle       *Lifecycle
+	wts             *webtransport.Server
+	streamerOrigins *auth.OriginPolicy
+	audienceOrigins *auth.OriginPolicy
+	streamAuth      *auth.StreamAuth // nil if streamers aren't authenticated
+	viewerAuth      *auth.ViewerAuth // nil without token secret, private channels can't be watched then
+	edge            *edge            // nil on an origin
+}
+
+func NewServer(cfg *config.Config, channels *channelmanager.ChannelManager, audiences *audiencemanager.AudienceManager) (*Server, error) {
+	if err := os.Setenv("QLOGDIR", cfg.Log.QlogDir); err != nil {
+		return nil, fmt.Errorf("error setting qlog dir: %v", err)
+	}
+	if _, err := os.Stat(cfg.Log.QlogDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(cfg.Log.QlogDir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating qlog dir: %v", err)
+		}
+	}
 
-	err := os.Setenv("QLOGDIR", "log/qlog")
+	streamAuth, err := cfg.StreamAuth()
 	if err != nil {
-		log.Fatalf("❌ error setting qlog dir: %v", err)
+		return nil, err
+	}
+	if streamAuth == nil {
+		log.Printf("⚠️ no stream keys or token secret set, any streamer may announce any channel")
+	} else {
+		log.Printf("🔑 streamers authenticated, %d stream keys loaded, tokens accepted: %t", streamAuth.Keys(), cfg.Auth.TokenSecret != "")
 	}
 
-	if _, err := os.Stat("log/qlog"); os.IsNotExist(err) {
-		os.Mkdir("log/qlog", 0755)
+	viewerAuth, err := cfg.ViewerAuth()
+	if err != nil {
+		return nil, err
 	}
 
-	TracerManager := NewTracerManager()
-	EntityManager := NewEntityManager()
-	wtS := webtransport.Server{
+	streamerOrigins, err := cfg.StreamerOrigins()
+	if err != nil {
+		return nil, err
+	}
+	audienceOrigins, err := cfg.AudienceOrigins()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🌐 allowed origins, streamer: %v, audience: %v, missing Origin: %t", cfg.Origin.Streamer, cfg.Origin.Audience, cfg.Origin.AllowMissing)
+
+	s := &Server{
+		cfg:             cfg,
+		streamAuth:      streamAuth,
+		viewerAuth:      viewerAuth,
+		channels:        channels,
+		audiences:       audiences,
+		connections:     NewConnectionRegistry(),
+		streamerOrigins: streamerOrigins,
+		audienceOrigins: audienceOrigins,
+	}
+	s.lifecycle = NewLifecycle(channels, audiences, s.connections)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webtransport/streamer", s.handleStreamer) // webtransport endpoint for the streamer
+	mux.HandleFunc("/webtransport/audience", s.handleAudience) // webtransport endpoint for the audience
+	s.wts = &webtransport.Server{
 		H3: http3.Server{
-			Addr:       "10.0.2.1:443",
-			TLSConfig:  utilities.LoadTLSConfig(),
-			QUICConfig: NewQuicConfig(TracerManager, EntityManager),
+			Addr:       cfg.ListenAddr,
+			Handler:    mux,
+			TLSConfig:  utilities.LoadTLSConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile),
+			QUICConfig: NewQuicConfig(cfg, s.connections, channels),
 		},
-		CheckOrigin: func(r *http.Request) bool { return true },
+		CheckOrigin: func(r *http.Request) bool { return true }, // checked per endpoint by upgradeSession
 	}
 
-	// webtransport endpoint for the streamer
-	http.HandleFunc("/webtransport/streamer", func(w http.ResponseWriter, r *http.Request) {
-		session, err := originCheckAndSessionUpgrade(&wtS, w, r)
-		if err != nil {
-			log.Printf("❌ error upgrading session: %v", err)
-			return
-		}
+	if cfg.IsEdge() {
+		s.edge = newEdge(cfg.Relay, channels, s.lifecycle, viewerAuth)
+	}
+	return s, nil
+}
 
-		// init with uuid string as name, updated when the streamer sends the ANNOUNCE(channel name) message
-		streamer, err := channelmanager.InitStreamer()
-		if err != nil {
-			log.Printf("❌ error creating streamer: %v", err)
-		}
-		log.Printf("🆕 Streamer & channel created: %s", streamer.Channel.Name)
-
-		sm := newSessionManager(streamer, nil) // save current streamer to the session manager for easier retrieval
-		moqSession := &moqtransport.Session{
-			Conn:                webtransportmoq.New(session),
-			EnableDatagrams:     false,
-			LocalRole:           moqtransport.RoleSubscriber,
-			RemoteRole:          moqtransport.RolePublisher,
-			AnnouncementHandler: sm,
-			SubscriptionHandler: nil,
-		}
-		if err := moqSession.RunServer(r.Context()); err != nil {
-			log.Printf("failed to run streamer server: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		streamer.Channel.SetSession(moqSession)
-		log.Println("🪵 streamer moqt session initialized & running")
+// the server's channels, mirrored ones included on an edge
+func (s *Server) Channels() *channelmanager.ChannelManager {
+	return s.channels
+}
+
+// the server's audiences, edges relaying its channels included
+func (s *Server) Audiences() *audiencemanager.AudienceManager {
+	return s.audiences
+}
+
+// the server's open connections with the session & streamer or audience on each
+func (s *Server) Connections() *ConnectionRegistry {
+	return s.connections
+}
 
-		EntityManager.AddEntity(streamer)
+// the server's session lifecycle, e.g. to observe teardowns
+func (s *Server) Lifecycle() *Lifecycle {
+	return s.lifecycle
+}
+
+// listen on cfg.ListenAddr until the server is closed
+func (s *Server) ListenAndServe() error {
+	s.startEdge()
+	return s.wts.ListenAndServe()
+}
+
+// serve on an existing UDP socket until the server is closed, e.g. one bound to a free loopback port
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.startEdge()
+	return s.wts.Serve(conn)
+}
+
+// stop the edge's session to its origin and close the listener, sessions are torn down as they terminate
+func (s *Server) Close() error {
+	if s.edge != nil {
+		s.edge.stop()
+	}
+	return s.wts.Close()
+}
+
+func (s *Server) startEdge() {
+	if s.edge != nil {
+		go s.edge.run()
+	}
+}
+
+func (s *Server) handleStreamer(w http.ResponseWriter, r *http.Request) {
+	session := upgradeSession(s.wts, s.streamerOrigins, "streamer", w, r)
+	if session == nil {
+		return
+	}
+
+	// init with uuid string as name, updated when the streamer sends the ANNOUNCE(channel name) message
+	streamer, err := s.channels.InitStreamer()
+	if err != nil {
+		log.Printf("❌ error creating streamer: %v", err)
+		session.CloseWithError(0, "streamer creation failed")
+		return
+	}
+	log.Printf("🆕 Streamer & channel created: %s", streamer.Channel.Name)
+
+	sm := newSessionManager(streamer, nil, s.lifecycle) // save current streamer to the session manager for easier retrieval
+	sm.requireStreamKey(s.streamAuth, r.URL.Query().Get("key"))
+	sm.viewerAuth = s.viewerAuth // to reject private channels nobody could watch
+	conn := newMoqConnection(session)
+	conn.setHooks(controlMessageHooks{
+		announceReceived: sm.announceReceived,
 	})
+	moqSession := &moqtransport.Session{
+		Conn:                conn,
+		EnableDatagrams:     true, // receive the objects of datagram tracks
+		LocalRole:           moqtransport.RoleSubscriber,
+		RemoteRole:          moqtransport.RolePublisher,
+		AnnouncementHandler: sm,
+		SubscriptionHandler: nil,
+	}
+	streamer.Channel.SetSession(moqSession) // before the ANNOUNCE is handled, its catalogTrack is subscribed over the session
 
-	// webtransport endpoint for the audience
-	http.HandleFunc("/webtransport/audience", func(w http.ResponseWriter, r *http.Request) {
-		session, err := originCheckAndSessionUpgrade(&wtS, w, r)
-		if err != nil {
-			log.Printf("❌ error upgrading session: %v", err)
-			return
-		}
+	// tear down streamer & channel once the session terminates
+	tracingID, _ := r.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+	p := &peer{kind: PeerStreamer, streamer: streamer, sm: sm, conn: conn, tracingID: tracingID}
+	if err := s.connections.bind(tracingID, session, moqSession, p); err != nil {
+		log.Printf("❌ error binding streamer(%s) to its connection: %v", streamer.ID, err)
+	}
+	s.lifecycle.watch(session, p)
 
-		// init with uuid string as name, can be updated later if needed
-		audience, err := audiencemanager.NewAudience()
-		if err != nil {
-			log.Printf("❌ error creating audience: %v", err)
-			return
-		}
-		log.Printf("🆕 Audience created: %s,", audience.Name)
-
-		sm := newSessionManager(nil, audience) // save current audience to the session manager for easier retrieval
-		moqSession := &moqtransport.Session{
-			Conn:                webtransportmoq.New(session),
-			EnableDatagrams:     false,
-			LocalRole:           moqtransport.RolePublisher,
-			RemoteRole:          moqtransport.RoleSubscriber,
-			AnnouncementHandler: nil,
-			SubscriptionHandler: sm,
-		}
-		if err := moqSession.RunServer(r.Context()); err != nil {
-			log.Printf("failed to run audience server: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		} else {
-			log.Println("🪵 moqt audience client running...")
-		}
-		audience.SetSession(moqSession)
-		log.Println("🪵 audience moqt session initialized & running")
+	if err := moqSession.RunServer(r.Context()); err != nil {
+		log.Printf("failed to run streamer server: %v", err)
+		session.CloseWithError(0, "moqt session setup failed")
+		return
+	}
+	log.Println("🪵 streamer moqt session initialized & running")
+}
 
-		EntityManager.AddEntity(audience)
+func (s *Server) handleAudience(w http.ResponseWriter, r *http.Request) {
+	session := upgradeSession(s.wts, s.audienceOrigins, "audience", w, r)
+	if session == nil {
+		return
+	}
 
-		if err := moqSession.Announce(r.Context(), "channels"); err != nil {
-			log.Printf("❌ error announcing ns 'channels': %v", err)
-		} else {
-			log.Println("📢 Announced namespace: channels")
-		}
+	// init with uuid string as name, can be updated later if needed
+	audience, err := s.audiences.NewAudience()
+	if err != nil {
+		log.Printf("❌ error creating audience: %v", err)
+		return
+	}
+	log.Printf("🆕 Audience created: %s,", audience.Name)
+
+	sm := newSessionManager(nil, audience, s.lifecycle) // save current audience to the session manager for easier retrieval
+	sm.acceptViewerTokens(s.viewerAuth, r.URL.Query().Get("token"))
+	conn := newMoqConnection(session)
+	conn.setHooks(controlMessageHooks{
+		subscribeReceived:   sm.subscribeReceived,
+		subscribeAccepted:   sm.subscribeAccepted,
+		unsubscribeReceived: sm.unsubscribeReceived,
 	})
+	moqSession := &moqtransport.Session{
+		Conn:                conn,
+		EnableDatagrams:     false, // only enables receiving, objects of datagram tracks are sent regardless
+		LocalRole:           moqtransport.RolePublisher,
+		RemoteRole:          moqtransport.RoleSubscriber,
+		AnnouncementHandler: nil,
+		SubscriptionHandler: sm,
+	}
+
+	// tear down audience & its subscriptions once the session terminates
+	tracingID, _ := r.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+	p := &peer{kind: PeerAudience, audience: audience, sm: sm, conn: conn, tracingID: tracingID}
+	if err := s.connections.bind(tracingID, session, moqSession, p); err != nil {
+		log.Printf("❌ error binding audience(%s) to its connection: %v", audience.ID, err)
+	}
+	s.lifecycle.watch(session, p)
 
-	if err := wtS.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	if err := moqSession.RunServer(r.Context()); err != nil {
+		log.Printf("failed to run audience server: %v", err)
+		session.CloseWithError(0, "moqt session setup failed")
+		return
+	} else {
+		log.Println("🪵 moqt audience client running...")
+	}
+	audience.SetSession(moqSession)
+	log.Println("🪵 audience moqt session initialized & running")
+
+	if err := moqSession.Announce(r.Context(), "channels"); err != nil {
+		log.Printf("❌ error announcing ns 'channels': %v", err)
+	} else {
+		log.Println("📢 Announced namespace: channels")
 	}
 }
 
-func originCheckAndSessionUpgrade(wtS *webtransport.Server, w http.ResponseWriter, r *http.Request) (*webtransport.Session, error) {
+// check the request's Origin against the endpoint's policy, then upgrade it to a webtransport session, nil if rejected
+// or a CORS preflight. Nothing is written before the upgrade: it sends the 200 itself, a rejected or failed upgrade is
+// answered with an error status instead.
+func upgradeSession(wtS *webtransport.Server, origins *auth.OriginPolicy, endpoint string, w http.ResponseWriter, r *http.Request) *webtransport.Session {
 	origin := r.Header.Get("Origin")
-	matchOrigin, _ := regexp.MatchString(`^https://(10\.0\.\d+\.\d+|localhost)`, origin)
-	if origin == "" || matchOrigin {
+	if err := origins.Check(origin); err != nil {
+		log.Printf("🚫 %s session from %s rejected: %v", endpoint, r.RemoteAddr, err)
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil
+	}
+	if origin != "" {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Add("Vary", "Origin")
+	}
+	if r.Method == http.MethodOptions {
+		// CORS preflight, the session is established by the CONNECT that follows
+		w.Header().Set("Access-Control-Allow-Methods", "CONNECT, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		w.WriteHeader(http.StatusOK)
-	} else {
-		log.Printf("❌ Origin not allowed: %s", origin)
-		http.Error(w, "Origin not allowed", http.StatusForbidden)
-		return nil, errors.New("origin not allowed")
+		w.WriteHeader(http.StatusNoContent)
+		return nil
 	}
 
 	session, err := wtS.Upgrade(w, r)
 	if err != nil {
-		log.Printf("❌ wts upgrading failed: %s", err)
-		return nil, errors.New("wts upgrading failed")
+		log.Printf("❌ %s session from %s: wts upgrading failed: %v", endpoint, r.RemoteAddr, err)
+		w.Header().Del("Access-Control-Allow-Origin")
+		w.Header().Del("Access-Control-Allow-Credentials")
+		http.Error(w, "webtransport upgrade failed", http.StatusBadRequest)
+		return nil
 	}
-
-	return session, nil
+	return session
 }
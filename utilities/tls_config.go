@@ -13,9 +13,9 @@ import (
 
 var logger = NewCustomLogger()
 
-func LoadTLSConfig() *tls.Config {
+func LoadTLSConfig(certFile, keyFile string) *tls.Config {
 	// load key and cert from files
-	cert, err := tls.LoadX509KeyPair("./utilities/cert.pem", "./utilities/key.pem")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
 		logger.Fatal(err)
 	}